@@ -5,9 +5,15 @@ import (
 	"os"
 
 	"github.com/uzulla/envault/internal/cli"
+	"github.com/uzulla/envault/pkg/secret"
 )
 
 func main() {
+	// クラッシュ時のコアダンプにパスワードや復号化した内容が含まれないようにする
+	if err := secret.DisableCoreDumps(); err != nil && os.Getenv("ENVAULT_DEBUG") != "" {
+		fmt.Fprintf(os.Stderr, "[debug] コアダンプを無効にできませんでした: %v\n", err)
+	}
+
 	cli := cli.NewCLI()
 	
 	if err := cli.Run(os.Args[1:]); err != nil {
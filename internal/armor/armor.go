@@ -0,0 +1,202 @@
+// Package armor は暗号化ファイルをチャットやチケット、YAMLなどに貼り付けられる
+// ASCII armor形式（PEMに似たbase64のブロック）に変換します
+//
+//	-----BEGIN ENVAULT-----
+//	RU5WQVVMVDIAAAGHeyJ2ZXJzaW9uIjoyLCJjaXBoZXIiOiJhZXMtMjU2LWdjbSIs
+//	...
+//	=Qx7b
+//	-----END ENVAULT-----
+//
+// 本文は64文字ごとに改行し、最後の「=」で始まる行にCRC-24（OpenPGPと同じ方式）のチェックサムを付けます
+package armor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	BeginLine = "-----BEGIN ENVAULT-----"
+	EndLine   = "-----END ENVAULT-----"
+
+	// 本文の1行の文字数
+	lineLength = 64
+
+	crc24Init = 0xb704ce
+	crc24Poly = 0x1864cfb
+)
+
+var (
+	ErrInvalidArmor     = errors.New("ASCII armor形式として読み取れません")
+	ErrChecksumMismatch = errors.New("ASCII armorのチェックサムが一致しません（コピー時に内容が欠けているか、変更されています）")
+)
+
+// Encode はデータをASCII armor形式に変換します
+func Encode(data []byte) []byte {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write(data) // bytes.Buffer への書き込みは失敗しない
+	w.Close()
+	return buf.Bytes()
+}
+
+// NewWriter は書き込まれたデータをASCII armor形式に変換して w に書き込む WriteCloser を返します
+// チェックサムと終了行は Close で書き込まれます。Close は w を閉じません
+func NewWriter(w io.Writer) io.WriteCloser {
+	lines := &lineWriter{w: w}
+	return &encoder{
+		w:      w,
+		lines:  lines,
+		base64: base64.NewEncoder(base64.StdEncoding, lines),
+		crc:    crc24Init,
+	}
+}
+
+type encoder struct {
+	w       io.Writer
+	lines   *lineWriter
+	base64  io.WriteCloser
+	crc     uint32
+	started bool
+}
+
+func (e *encoder) Write(p []byte) (int, error) {
+	if err := e.begin(); err != nil {
+		return 0, err
+	}
+	e.crc = crc24Update(e.crc, p)
+	return e.base64.Write(p)
+}
+
+func (e *encoder) Close() error {
+	if err := e.begin(); err != nil {
+		return err
+	}
+	if err := e.base64.Close(); err != nil {
+		return err
+	}
+	if e.lines.column > 0 {
+		if _, err := io.WriteString(e.w, "\n"); err != nil {
+			return err
+		}
+	}
+	checksum := []byte{byte(e.crc >> 16), byte(e.crc >> 8), byte(e.crc)}
+	_, err := io.WriteString(e.w, "="+base64.StdEncoding.EncodeToString(checksum)+"\n"+EndLine+"\n")
+	return err
+}
+
+func (e *encoder) begin() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	_, err := io.WriteString(e.w, BeginLine+"\n")
+	return err
+}
+
+// lineWriter はbase64の出力を lineLength 文字ごとに改行します
+type lineWriter struct {
+	w      io.Writer
+	column int
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		m := min(lineLength-l.column, len(p))
+		if _, err := l.w.Write(p[:m]); err != nil {
+			return n, err
+		}
+		n += m
+		p = p[m:]
+		l.column += m
+		if l.column == lineLength {
+			if _, err := io.WriteString(l.w, "\n"); err != nil {
+				return n, err
+			}
+			l.column = 0
+		}
+	}
+	return n, nil
+}
+
+// IsArmored はデータがASCII armor形式かどうかを返します
+// 先頭の空白や改行は無視されます
+func IsArmored(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte(BeginLine))
+}
+
+// Decode はASCII armor形式のデータを元のバイト列に戻します
+// 貼り付け時に加わった行頭・行末の空白やCRLFの改行は無視されます
+func Decode(data []byte) ([]byte, error) {
+	lines := strings.Split(string(data), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+
+	// 前後の空行を除く
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(lines) < 3 || lines[0] != BeginLine {
+		return nil, fmt.Errorf("%w: %s がありません", ErrInvalidArmor, BeginLine)
+	}
+	if lines[len(lines)-1] != EndLine {
+		return nil, fmt.Errorf("%w: %s がありません", ErrInvalidArmor, EndLine)
+	}
+	body := lines[1 : len(lines)-1]
+
+	checksumLine := body[len(body)-1]
+	if !strings.HasPrefix(checksumLine, "=") {
+		return nil, fmt.Errorf("%w: チェックサムがありません", ErrInvalidArmor)
+	}
+	checksum, err := base64.StdEncoding.DecodeString(checksumLine[1:])
+	if err != nil || len(checksum) != 3 {
+		return nil, fmt.Errorf("%w: チェックサムを読み取れません", ErrInvalidArmor)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.Join(body[:len(body)-1], ""))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArmor, err)
+	}
+	if !bytes.Equal(crc24Bytes(decoded), checksum) {
+		return nil, ErrChecksumMismatch
+	}
+	return decoded, nil
+}
+
+// DecodeIfArmored はASCII armor形式のデータであれば元のバイト列に戻し、そうでなければそのまま返します
+func DecodeIfArmored(data []byte) ([]byte, error) {
+	if !IsArmored(data) {
+		return data, nil
+	}
+	return Decode(data)
+}
+
+// CRC-24（RFC 4880 6.1節）を3バイトのビッグエンディアンで返します
+func crc24Bytes(data []byte) []byte {
+	crc := crc24Update(crc24Init, data)
+	return []byte{byte(crc >> 16), byte(crc >> 8), byte(crc)}
+}
+
+// CRC-24 の途中の値に data を加えた値を返します
+func crc24Update(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= crc24Poly
+			}
+		}
+	}
+	return crc & 0xffffff
+}
@@ -0,0 +1,103 @@
+package armor
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	for _, size := range []int{0, 1, 47, 48, 49, 200} {
+		data := bytes.Repeat([]byte{0x00, 0xff, 'E', 0x7f}, size)[:size]
+
+		armored := Encode(data)
+		if !IsArmored(armored) {
+			t.Fatalf("size=%d: IsArmored() = false", size)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(armored)), "\n") {
+			if len(line) > lineLength {
+				t.Errorf("size=%d: 行が長すぎます: %q", size, line)
+			}
+		}
+
+		decoded, err := Decode(armored)
+		if err != nil {
+			t.Fatalf("size=%d: Decode() error = %v", size, err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("size=%d: Decode() = %x, want %x", size, decoded, data)
+		}
+	}
+}
+
+func TestNewWriter(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	// 書き込みを分割しても Encode と同じ出力になること
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i := 0; i < len(data); i += 7 {
+		if _, err := w.Write(data[i:min(i+7, len(data))]); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), Encode(data)) {
+		t.Errorf("NewWriter() の出力が Encode() と一致しません:\n%s", buf.Bytes())
+	}
+}
+
+func TestCRC24(t *testing.T) {
+	// RFC 4880 のCRC-24の既知の値
+	if got := crc24Bytes([]byte("123456789")); !bytes.Equal(got, []byte{0x21, 0xcf, 0x02}) {
+		t.Errorf("crc24Bytes(\"123456789\") = %x, want 21cf02", got)
+	}
+}
+
+func TestDecodePasted(t *testing.T) {
+	data := []byte("ENVAULT2 pasted content")
+	armored := string(Encode(data))
+
+	// YAMLのブロックに貼り付けた場合のインデントやCRLFの改行を許容すること
+	indented := "\n  " + strings.ReplaceAll(strings.TrimSpace(armored), "\n", "\r\n  ") + "\r\n\n"
+	decoded, err := Decode([]byte(indented))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Errorf("Decode() = %q, want %q", decoded, data)
+	}
+
+	if _, err := DecodeIfArmored(data); err != nil {
+		t.Errorf("DecodeIfArmored(平文) error = %v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	armored := string(Encode([]byte("ENVAULT2 pasted content")))
+	lines := strings.Split(armored, "\n")
+
+	corrupted := append([]string{}, lines...)
+	corrupted[1] = strings.Replace(corrupted[1], "R", "S", 1)
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{"本文の破損", strings.Join(corrupted, "\n"), ErrChecksumMismatch},
+		{"終了行なし", strings.Join(lines[:len(lines)-2], "\n"), ErrInvalidArmor},
+		{"チェックサムなし", strings.Join(append(lines[:2:2], lines[3:]...), "\n"), ErrInvalidArmor},
+		{"開始行なし", strings.Join(lines[1:], "\n"), ErrInvalidArmor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode([]byte(tt.input)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decode() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/uzulla/envault/internal/armor"
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+// armor コマンドを作成
+func (c *CLI) newArmorCommand() *cobra.Command {
+	var output string
+	armorCmd := &cobra.Command{
+		Use:   "armor [オプション] [入力ファイル]",
+		Short: "暗号化ファイルをASCII armor形式に変換",
+		Long: `暗号化ファイルを、チャットやチケット、YAMLに貼り付けられるASCII armor形式（-----BEGIN ENVAULT-----）に変換します。
+入力ファイルを省略すると -f で指定したファイル（デフォルトは .env.vaulted）、「-」を指定すると標準入力から読み込みます。
+ASCII armor形式のファイルはそのまま export や dump で使用できます。
+- 標準出力に表示: envault armor
+- ファイルに保存: envault armor -o .env.vaulted.asc`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := c.readArmorInput(args)
+			if err != nil {
+				return err
+			}
+			if armor.IsArmored(data) {
+				return errors.New("既にASCII armor形式です")
+			}
+			if crypto.DetectFormat(data) == crypto.FormatUnknown {
+				return fmt.Errorf("%w: envaultの暗号化ファイルではありません", crypto.ErrInvalidFile)
+			}
+			return writeArmorOutput(armor.Encode(data), output)
+		},
+	}
+	armorCmd.Flags().StringVarP(&output, "output", "o", "", "出力先（省略時は標準出力）")
+	return armorCmd
+}
+
+// dearmor コマンドを作成
+func (c *CLI) newDearmorCommand() *cobra.Command {
+	var output string
+	dearmorCmd := &cobra.Command{
+		Use:   "dearmor [オプション] [入力ファイル]",
+		Short: "ASCII armor形式の暗号化ファイルを元の形式に戻す",
+		Long: `ASCII armor形式（-----BEGIN ENVAULT-----）の暗号化ファイルを元のバイナリ形式に戻します。
+チェックサムにより、貼り付け時の欠けや変更を検出します。
+- 貼り付けた内容から復元: envault dearmor - -o .env.vaulted
+- ファイルから復元: envault dearmor vault.asc -o .env.vaulted`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := c.readArmorInput(args)
+			if err != nil {
+				return err
+			}
+			if !armor.IsArmored(data) {
+				return fmt.Errorf("%w: %s がありません", armor.ErrInvalidArmor, armor.BeginLine)
+			}
+			decoded, err := armor.Decode(data)
+			if err != nil {
+				return err
+			}
+			return writeArmorOutput(decoded, output)
+		},
+	}
+	dearmorCmd.Flags().StringVarP(&output, "output", "o", "", "出力先（省略時は標準出力）")
+	return dearmorCmd
+}
+
+// armor / dearmor の入力を読み込む（「-」は標準入力）
+// armorの有無を判別するため、ReadVaultedFile ではなくファイルの内容をそのまま返す
+func (c *CLI) readArmorInput(args []string) ([]byte, error) {
+	path := c.vaultedFilePath()
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ファイルの読み込みに失敗しました: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, file.ErrEmptyFile
+	}
+	return data, nil
+}
+
+func writeArmorOutput(data []byte, output string) error {
+	if output == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := file.WriteVaultedFile(data, output); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "ファイルを作成しました: %s\n", output)
+	return nil
+}
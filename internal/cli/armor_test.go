@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uzulla/envault/internal/armor"
+	"github.com/uzulla/envault/internal/file"
+)
+
+func TestEncryptArmorAndDearmor(t *testing.T) {
+	tempDir := t.TempDir()
+	envPath := filepath.Join(tempDir, ".env")
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	binaryPath := filepath.Join(tempDir, "binary.vaulted")
+	content := "TEST_VAR1=value1\n"
+
+	if err := os.WriteFile(envPath, []byte(content), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	withStdin(t, "test-password\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"encrypt", envPath, "--armor", "-p", "-f", vaultPath})
+	}); err != nil {
+		t.Fatalf("Run(encrypt --armor) error = %v", err)
+	}
+	armored, err := os.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatalf("暗号化ファイルの読み込みに失敗しました: %v", err)
+	}
+	if !strings.HasPrefix(string(armored), armor.BeginLine+"\n") {
+		t.Fatalf("ASCII armor形式で書き出されていません: %q", armored)
+	}
+
+	// armor形式のまま復号化できること
+	withStdin(t, "test-password\n")
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-p", "-f", vaultPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(dump) error = %v", err)
+	}
+	if output != content {
+		t.Errorf("Run(dump) = %q, want %q", output, content)
+	}
+
+	// 貼り付けた内容（インデント付き）を標準入力から dearmor し、再び armor すると元に戻ること
+	withStdin(t, "  "+strings.ReplaceAll(string(armored), "\n", "\n  "))
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dearmor", "-", "-o", binaryPath})
+	}); err != nil {
+		t.Fatalf("Run(dearmor) error = %v", err)
+	}
+	binary, err := os.ReadFile(binaryPath)
+	if err != nil {
+		t.Fatalf("復元したファイルの読み込みに失敗しました: %v", err)
+	}
+	if armor.IsArmored(binary) || !strings.HasPrefix(string(binary), "ENVAULT2") {
+		t.Errorf("dearmor の結果が元の形式ではありません: %q", binary)
+	}
+
+	output, err = captureOutput(func() error {
+		return NewCLI().Run([]string{"armor", binaryPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(armor) error = %v", err)
+	}
+	if output != string(armored) {
+		t.Errorf("Run(armor) = %q, want %q", output, armored)
+	}
+
+	if err := NewCLI().Run([]string{"armor", vaultPath}); err == nil {
+		t.Errorf("armor形式のファイルを二重にarmorできてしまいました")
+	}
+	if err := NewCLI().Run([]string{"armor", envPath}); err == nil {
+		t.Errorf("暗号化ファイルではないファイルをarmorできてしまいました")
+	}
+
+	// パスワードを変更してもarmor形式のまま残ること
+	withStdin(t, "test-password\nnew-password\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"passwd", "-p", "-f", vaultPath})
+	}); err != nil {
+		t.Fatalf("Run(passwd) error = %v", err)
+	}
+	updated, err := os.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatalf("暗号化ファイルの読み込みに失敗しました: %v", err)
+	}
+	if !armor.IsArmored(updated) {
+		t.Errorf("passwd でarmor形式が失われました")
+	}
+}
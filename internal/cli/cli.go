@@ -1,23 +1,33 @@
 package cli
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/uzulla/envault/internal/armor"
 	"github.com/uzulla/envault/internal/crypto"
 	"github.com/uzulla/envault/internal/env"
 	"github.com/uzulla/envault/internal/file"
 	"github.com/uzulla/envault/internal/tui"
+	"github.com/uzulla/envault/pkg/secret"
 	"github.com/uzulla/envault/pkg/utils"
 )
 
 const (
 	Version = "0.2.0"
+
+	// 暗号化ファイルの形式
+	FormatEnvault    = "envault"
+	FormatAge        = "age"
+	FormatStructured = "structured"
 )
 
 var (
@@ -33,15 +43,43 @@ const (
 )
 
 type CLI struct {
-	rootCmd       *cobra.Command
-	passwordStdin bool
-	vaultedFile   string
-	newShell      bool
-	selectVars    bool // 環境変数を選択するオプション
+	rootCmd         *cobra.Command
+	passwordStdin   bool
+	vaultedFile     string
+	newShell        bool
+	selectVars      bool // 環境変数を選択するオプション
+	recursive       bool // ディレクトリ以下の暗号化ファイルを再帰的に処理するオプション
+	kdfOptions      crypto.Options
+	identities      []string // 復号化に使用する秘密鍵ファイル
+	recipients      []string // 暗号化の受信者（公開鍵）
+	format          string   // 暗号化ファイルの形式（envault、age または structured）
+	cipher          string   // 本文の暗号方式（aes-256-gcm または xchacha20-poly1305）
+	recipientsFiles []string // 暗号化の受信者を列挙したファイル
+	skipRecipients  bool     // 暗号化ファイルと同じディレクトリの受信者ファイルを使用しないオプション
+	sshRecipients   []string // 暗号化の受信者（SSH公開鍵）
+	sshIdentities   []string // 復号化に使用するSSH秘密鍵
+	keyFile         string   // パスワードと組み合わせるキーファイル
+	rawKeyString    string   // KDFを使用しない鍵文字列（envault_key_...）
+	generateKey     bool     // 暗号化時に鍵文字列のスロットを追加するオプション
+	hashKeys        bool     // 構造化形式でキー名をHMACで隠すオプション
+	armor           bool     // 暗号化ファイルをASCII armor形式で書き出すオプション
+	creator         string   // メタデータに記録する作成者
+	environment     string   // メタデータに記録する環境名
+	description     string   // メタデータに記録する説明
+	listKeys        bool     // メタデータに変数名の一覧を記録するオプション
+	requireSigned   string   // 信頼された署名者の署名がないファイルの扱い（error または warn）
+	signersFile     string   // 信頼された署名者ファイル
+	signatureFile   string   // 分離署名ファイル
+	configFile      string   // プロジェクト設定ファイル
+	strict          bool     // .envファイルの書式にエラーがある場合に暗号化しないオプション
+	noInterpolate   bool     // 値の中の変数参照を展開しないオプション
+	interpolateEnv  bool     // 変数参照の展開にプロセスの環境変数も使用するオプション
+
+	secrets []*secret.Buffer // コマンドの終了時に消去するパスワード
 }
 
 func NewCLI() *CLI {
-	cli := &CLI{}
+	cli := &CLI{kdfOptions: crypto.DefaultOptions()}
 	cli.setupCommands()
 	return cli
 }
@@ -54,6 +92,9 @@ func (c *CLI) setupCommands() {
 		Version: Version,
 		Long: `envault は環境変数を安全に管理するためのツールです。
 .env ファイルを暗号化し、必要に応じて環境変数をエクスポート/アンセットします。`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return c.applyKDFConfig(cmd)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// ヘルプを表示
 			return cmd.Help()
@@ -64,6 +105,11 @@ func (c *CLI) setupCommands() {
 	// 共通フラグ
 	c.rootCmd.PersistentFlags().BoolVarP(&c.passwordStdin, "password-stdin", "p", false, "stdinからパスワードを読み込む")
 	c.rootCmd.PersistentFlags().StringVarP(&c.vaultedFile, "file", "f", "", "使用する.env.vaultedファイルのパス")
+	c.rootCmd.PersistentFlags().StringArrayVarP(&c.identities, "identity", "i", nil, "復号化に使用する秘密鍵ファイル（パスワードの代わり）")
+	c.rootCmd.PersistentFlags().StringVar(&c.rawKeyString, "key", "", "復号化に使用する鍵文字列（envault_key_...、環境変数 ENVAULT_KEY でも指定可）")
+	c.rootCmd.PersistentFlags().StringVar(&c.keyFile, "key-file", "", "パスワードと組み合わせる（またはパスワードの代わりに使用する）キーファイル")
+	c.rootCmd.PersistentFlags().StringArrayVar(&c.sshIdentities, "ssh-identity", nil, "復号化に使用するSSH秘密鍵（ed25519またはRSA、複数指定可）")
+	c.rootCmd.PersistentFlags().StringVar(&c.configFile, "config", "", "プロジェクト設定ファイルのパス（省略時は "+ProjectConfigFileName+"）")
 	
 	// encrypt コマンド
 	encryptCmd := &cobra.Command{
@@ -71,13 +117,39 @@ func (c *CLI) setupCommands() {
 		Short: ".envファイルを暗号化して.env.vaultedファイルを作成",
 		Long: `.envファイルを暗号化して.env.vaultedファイルを作成します。
 - 基本的な暗号化: envault encrypt .env
-- カスタム出力パス: envault encrypt .env -f custom.vaulted`,
+- カスタム出力パス: envault encrypt .env -f custom.vaulted
+- 公開鍵で暗号化: envault encrypt .env --recipient envault-pub-...
+- SSH公開鍵で暗号化: envault encrypt .env --ssh-recipient ~/.ssh/id_ed25519.pub
+- age形式で暗号化: envault encrypt .env --format age
+- CI用の鍵文字列も追加: envault encrypt .env --generate-key
+- 値ごとに暗号化（gitの差分で変更された変数が分かる）: envault encrypt .env --format structured
+- ASCII armor形式で書き出す: envault encrypt .env --armor
+- XChaCha20-Poly1305で暗号化: envault encrypt .env --cipher xchacha20-poly1305
+- メタデータを記録: envault encrypt .env --environment production --description "本番用"
+- Argon2idのパラメータを指定: envault encrypt .env --kdf-time 3 --kdf-memory 262144
+- 書式にエラーがあれば暗号化しない: envault encrypt .env --strict`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// 第1引数は .env ファイルパス
 			return c.runEncrypt(args[0])
 		},
 	}
+
+	encryptCmd.Flags().StringArrayVar(&c.recipients, "recipient", nil, "暗号化の受信者の公開鍵（複数指定可、パスワードの代わり）")
+	encryptCmd.Flags().StringArrayVar(&c.recipientsFiles, "recipients-file", nil, "受信者の公開鍵を列挙したファイル（複数指定可）")
+	encryptCmd.Flags().BoolVar(&c.skipRecipients, "no-recipients-file", false, "出力先と同じディレクトリの"+RecipientsFileName+"があっても使用しない（パスワードで暗号化する）")
+	encryptCmd.Flags().StringArrayVar(&c.sshRecipients, "ssh-recipient", nil, "暗号化の受信者のSSH公開鍵ファイルまたはauthorized_keysファイル（複数指定可）")
+	encryptCmd.Flags().BoolVar(&c.generateKey, "generate-key", false, "CI用の鍵文字列（envault_key_...）を生成してスロットに追加し、標準出力に表示")
+	encryptCmd.Flags().StringVar(&c.format, "format", FormatEnvault, "暗号化ファイルの形式（envault、age または structured）")
+	encryptCmd.Flags().BoolVar(&c.hashKeys, "hash-keys", false, "structured形式でキー名もHMACで隠す")
+	encryptCmd.Flags().StringVar(&c.cipher, "cipher", crypto.CipherAES256GCM, "本文の暗号方式（"+strings.Join(crypto.CipherNames(), " または ")+"）")
+	encryptCmd.Flags().BoolVar(&c.armor, "armor", false, "チャットやYAMLに貼り付けられるASCII armor形式（-----BEGIN ENVAULT-----）で書き出す")
+	encryptCmd.Flags().StringVar(&c.environment, "environment", "", "メタデータに記録する環境名（production など）")
+	encryptCmd.Flags().StringVar(&c.description, "description", "", "メタデータに記録する説明")
+	encryptCmd.Flags().StringVar(&c.creator, "creator", "", "メタデータに記録する作成者（省略時は ユーザー名@ホスト名）")
+	encryptCmd.Flags().BoolVar(&c.listKeys, "list-keys", false, "メタデータに変数名の一覧を記録する（値は記録しない）")
+	encryptCmd.Flags().BoolVar(&c.strict, "strict", false, ".envファイルの書式にエラーがある場合は暗号化しない")
+	c.addKDFFlags(encryptCmd)
 	c.rootCmd.AddCommand(encryptCmd)
 
 	// export コマンド
@@ -87,7 +159,10 @@ func (c *CLI) setupCommands() {
 		Long: `暗号化された .env.vaulted ファイルから環境変数をエクスポートします。
 - スクリプト評価方式: eval $(envault export -o)
 - 新しいシェル方式: envault export -n
-- コマンド実行方式: envault export -- node app.js`,
+- コマンド実行方式: envault export -- node app.js
+値の中の ${VAR}、$VAR、${VAR:-default}、${VAR:?message} は同じファイル内のキーの値に展開されます。
+- 展開しない: envault export -o --no-interpolate
+- ファイルにないキーはプロセスの環境変数から展開: envault export -o --interpolate-env`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			var cmdArgs []string
 			if cmd.ArgsLenAtDash() != -1 {
@@ -102,6 +177,9 @@ func (c *CLI) setupCommands() {
 	exportCmd.Flags().BoolVarP(&c.selectVars, "select", "s", false, "適用する環境変数をTUIで選択する")
 	exportCmd.Flags().BoolP("output-script-only", "o", false, "スクリプトのみを出力（情報メッセージなし）")
 	exportCmd.Flags().BoolVarP(&c.newShell, "new-shell", "n", false, "新しいbashセッションを起動して環境変数を設定")
+	exportCmd.PersistentFlags().BoolVar(&c.noInterpolate, "no-interpolate", false, "値の中の ${VAR} などの変数参照を展開しない")
+	exportCmd.PersistentFlags().BoolVar(&c.interpolateEnv, "interpolate-env", false, "ファイルにないキーの参照をプロセスの環境変数から展開する")
+	c.addSignatureFlags(exportCmd)
 	c.rootCmd.AddCommand(exportCmd)
 
 	// select サブコマンド
@@ -140,6 +218,7 @@ func (c *CLI) setupCommands() {
 
 	unsetCmd.Flags().BoolVarP(&c.selectVars, "select", "s", false, "適用する環境変数をTUIで選択する")
 	unsetCmd.Flags().BoolP("output-script-only", "o", false, "スクリプトのみを出力（情報メッセージなし）")
+	c.addSignatureFlags(unsetCmd)
 	c.rootCmd.AddCommand(unsetCmd)
 
 	// dump コマンド
@@ -152,8 +231,74 @@ func (c *CLI) setupCommands() {
 			return c.runDump()
 		},
 	}
+	c.addSignatureFlags(dumpCmd)
 	c.rootCmd.AddCommand(dumpCmd)
 
+	// upgrade コマンド
+	upgradeCmd := &cobra.Command{
+		Use:   "upgrade [オプション] [パス...]",
+		Short: ".env.vaultedファイルを新しい形式・パラメータで再暗号化",
+		Long: `既存の .env.vaulted ファイルを復号化し、新しいArgon2idパラメータで再暗号化します。
+元のファイルは <ファイル名>.bak として保存されます。
+- 単一ファイルの移行: envault upgrade -f custom.vaulted
+- ディレクトリ以下を一括移行: envault upgrade --recursive .
+- パラメータの指定: envault upgrade --kdf-time 3 --kdf-memory 131072`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.runUpgrade(args)
+		},
+	}
+
+	upgradeCmd.Flags().BoolVarP(&c.recursive, "recursive", "r", false, "ディレクトリ以下の*.vaultedファイルを再帰的に処理する")
+	c.addKDFFlags(upgradeCmd)
+	c.rootCmd.AddCommand(upgradeCmd)
+
+	// keygen コマンド
+	keygenCmd := &cobra.Command{
+		Use:   "keygen [オプション]",
+		Short: "公開鍵暗号用の秘密鍵を生成",
+		Long: `X25519の秘密鍵を生成します。公開鍵は標準エラー出力に表示されます。
+- ファイルに保存: envault keygen -o ~/.config/envault/key.txt
+- 標準出力に表示: envault keygen
+- 署名鍵（Ed25519）を生成: envault keygen --signing -o ~/.config/envault/signer.key`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, _ := cmd.Flags().GetString("output")
+			signing, _ := cmd.Flags().GetBool("signing")
+			return c.runKeygen(output, signing)
+		},
+	}
+
+	keygenCmd.Flags().StringP("output", "o", "", "秘密鍵の保存先（省略時は標準出力）")
+	keygenCmd.Flags().Bool("signing", false, "暗号化ファイルに署名するためのEd25519署名鍵を生成する")
+	c.rootCmd.AddCommand(keygenCmd)
+
+	// recipients コマンド
+	c.rootCmd.AddCommand(c.newRecipientsCommand())
+
+	// slot コマンド
+	c.rootCmd.AddCommand(c.newSlotCommand())
+
+	// passwd コマンド
+	c.rootCmd.AddCommand(c.newPasswdCommand())
+
+	// keyfile コマンド
+	c.rootCmd.AddCommand(c.newKeyfileCommand())
+
+	// armor / dearmor コマンド
+	c.rootCmd.AddCommand(c.newArmorCommand(), c.newDearmorCommand())
+
+	// info コマンド
+	c.rootCmd.AddCommand(c.newInfoCommand())
+
+	// sign / verify / signers コマンド
+	c.rootCmd.AddCommand(c.newSignCommand(), c.newVerifyCommand(), c.newSignersCommand())
+
+	// recovery コマンド
+	c.rootCmd.AddCommand(c.newRecoveryCommand())
+
+	// kdf コマンド
+	c.rootCmd.AddCommand(c.newKDFCommand())
+
 	// version コマンド
 	versionCmd := &cobra.Command{
 		Use:   "version",
@@ -167,39 +312,44 @@ func (c *CLI) setupCommands() {
 	// ヘルプとバージョン情報は cobra が自動的に処理
 }
 
+// Argon2idのパラメータを指定するフラグを追加
+// 省略したフラグにはプロジェクト設定ファイルの値が使用され、実行前に下限を満たしているか確認される（applyKDFConfig）
+func (c *CLI) addKDFFlags(cmd *cobra.Command) {
+	cmd.Flags().Uint32Var(&c.kdfOptions.ArgonTime, "kdf-time", crypto.ArgonTime, "Argon2idの反復回数")
+	cmd.Flags().Uint32Var(&c.kdfOptions.ArgonMemory, "kdf-memory", crypto.ArgonMemory, "Argon2idのメモリ使用量（KiB）")
+	cmd.Flags().Uint8Var(&c.kdfOptions.ArgonThreads, "kdf-threads", crypto.ArgonThreads, "Argon2idの並列度")
+}
+
 func (c *CLI) Run(args []string) error {
+	defer c.destroySecrets()
 	c.rootCmd.SetArgs(args)
 	return c.rootCmd.Execute()
 }
 
-func (c *CLI) runEncrypt(envFilePath string) error {
-	data, err := file.ReadEnvFile(envFilePath)
-	if err != nil {
-		return fmt.Errorf(".envファイルの読み込みに失敗しました: %w", err)
-	}
+// パスワードをコマンドの終了時に消去するよう登録する
+// Identityや受信者はパスワードをコピーせずに参照するため、使用し終わるコマンドの終了まで保持する
+func (c *CLI) keepSecret(s *secret.Buffer) *secret.Buffer {
+	c.secrets = append(c.secrets, s)
+	return s
+}
 
-	var password string
-	if c.passwordStdin {
-		password, err = utils.GetPasswordFromStdin()
-	} else {
-		password, err = utils.GetPasswordInteractive("暗号化用パスワードを入力してください: ")
-		if err == nil {
-			confirmPassword, confirmErr := utils.GetPasswordInteractive("パスワードを再入力してください: ")
-			if confirmErr != nil {
-				return confirmErr
-			}
-			if password != confirmPassword {
-				return errors.New("パスワードが一致しません")
-			}
-		}
+// 登録したパスワードを消去する
+func (c *CLI) destroySecrets() {
+	for _, s := range c.secrets {
+		s.Destroy()
 	}
+	c.secrets = nil
+}
+
+func (c *CLI) runEncrypt(envFilePath string) error {
+	src, err := file.OpenEnvFile(envFilePath)
 	if err != nil {
-		return err
+		return fmt.Errorf(".envファイルの読み込みに失敗しました: %w", err)
 	}
+	defer src.Close()
 
-	encryptedData, err := crypto.Encrypt(data, password)
-	if err != nil {
-		return fmt.Errorf("暗号化に失敗しました: %w", err)
+	if c.format != FormatEnvault && c.format != FormatAge && c.format != FormatStructured {
+		return fmt.Errorf("未対応の形式です: %s（envault、age または structured を指定してください）", c.format)
 	}
 
 	outputPath := c.vaultedFile
@@ -212,10 +362,120 @@ func (c *CLI) runEncrypt(envFilePath string) error {
 		}
 	}
 
-	if err := file.WriteVaultedFile(encryptedData, outputPath); err != nil {
+	if _, err := crypto.CipherSuiteByName(c.cipher); err != nil {
+		return err
+	}
+	if c.format == FormatAge && c.cipher != crypto.CipherAES256GCM {
+		return errors.New("age形式では暗号方式を指定できません（ChaCha20-Poly1305が使用されます）")
+	}
+
+	// パスワードを入力させる前に書式を確認する
+	checked := secret.New(0)
+	defer checked.Destroy()
+	input, err := c.checkEnvSource(envFilePath, src, checked)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := c.buildMetadata(envFilePath, outputPath)
+	if err != nil {
+		return err
+	}
+	if metadata != nil && c.format == FormatAge {
+		return errors.New("age形式のファイルにはメタデータを記録できません")
+	}
+
+	recipients, err := c.loadRecipients(outputPath)
+	if err != nil {
+		return err
+	}
+
+	// パスワードのみで暗号化する場合、既存の構造化形式のファイルを開くために使用する
+	var passwordIdentities []crypto.Identity
+	if len(recipients) == 0 {
+		keyFile, err := readKeyFile(c.keyFile)
+		if err != nil {
+			return err
+		}
+		prompt := "暗号化用パスワードを入力してください: "
+		if keyFile != nil {
+			prompt = "暗号化用パスワードを入力してください（キーファイルのみで暗号化する場合は空のまま Enter）: "
+		}
+		password, err := c.readNewPassword(prompt)
+		if err != nil {
+			return err
+		}
+		recipients = []crypto.Recipient{newPasswordRecipient(password, keyFile, c.kdfOptions)}
+		passwordIdentities = []crypto.Identity{newPasswordIdentity(password, keyFile)}
+	}
+
+	var generatedKey *crypto.RawKey
+	if c.generateKey {
+		generatedKey, err = crypto.GenerateRawKey()
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, generatedKey)
+	}
+
+	// envault形式とage形式はチャンクごとに暗号化しながら書き込むため、.envファイル全体をメモリに読み込まない
+	var encrypt func(w io.Writer) error
+	switch c.format {
+	case FormatAge:
+		encrypt = func(w io.Writer) error {
+			if err := crypto.EncryptAgeStream(w, input, recipients); err != nil {
+				return fmt.Errorf("暗号化に失敗しました: %w", err)
+			}
+			return nil
+		}
+	case FormatStructured:
+		// 値ごとに暗号化するため、.envファイル全体を読み込む
+		data := secret.New(0)
+		defer data.Destroy()
+		if _, err := data.ReadFrom(input); err != nil {
+			return fmt.Errorf(".envファイルの読み込みに失敗しました: %w", err)
+		}
+		if generatedKey != nil {
+			passwordIdentities = nil
+		}
+		encryptedData, err := c.encryptStructured(data.Bytes(), recipients, outputPath, passwordIdentities, metadata)
+		if err != nil {
+			return fmt.Errorf("暗号化に失敗しました: %w", err)
+		}
+		encrypt = func(w io.Writer) error {
+			_, err := w.Write(encryptedData)
+			return err
+		}
+	default:
+		encrypt = func(w io.Writer) error {
+			opts := crypto.EncryptOptions{Cipher: c.cipher, Metadata: metadata}
+			if err := crypto.EncryptStream(w, input, recipients, opts); err != nil {
+				return fmt.Errorf("暗号化に失敗しました: %w", err)
+			}
+			return nil
+		}
+	}
+
+	err = file.WriteVaultedFileStream(outputPath, func(w io.Writer) error {
+		if !c.armor {
+			return encrypt(w)
+		}
+		armored := armor.NewWriter(w)
+		if err := encrypt(armored); err != nil {
+			return err
+		}
+		return armored.Close()
+	})
+	if err != nil {
 		return fmt.Errorf("暗号化ファイルの書き込みに失敗しました: %w", err)
 	}
 
+	if generatedKey != nil {
+		fmt.Fprintf(os.Stderr, "暗号化されたファイルを作成しました: %s\n", outputPath)
+		printGeneratedKey(generatedKey)
+		return nil
+	}
+
 	fmt.Printf("暗号化されたファイルを作成しました: %s\n", outputPath)
 	return nil
 }
@@ -229,41 +489,49 @@ func (c *CLI) runWithVaultedFile(mode CommandMode, outputScriptOnly bool, cmdArg
 	}
 
 	// 暗号化ファイルの読み込みと復号化
-	data, err := file.ReadVaultedFile(c.vaultedFile)
-	if err != nil {
-		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
-	}
-
-	var password string
-	if c.passwordStdin {
-		password, err = utils.GetPasswordFromStdin()
-	} else {
-		password, err = utils.GetPasswordInteractive("復号化用パスワードを入力してください: ")
-	}
-	if err != nil {
+	decrypted := secret.New(0)
+	defer decrypted.Destroy()
+	if err := c.decryptVaultTo(decrypted, c.vaultedFile); err != nil {
 		return err
 	}
-
-	decryptedData, err := crypto.Decrypt(data, password)
+	entries, err := c.parseEnvEntries(mode, decrypted.Bytes())
 	if err != nil {
-		return fmt.Errorf("復号化に失敗しました: %w", err)
+		return err
 	}
 
 	// 処理モードによって動作を変更
 	if c.selectVars {
-		return c.processWithTUI(mode, decryptedData, outputScriptOnly, cmdArgs)
+		return c.processWithTUI(mode, entries, outputScriptOnly, cmdArgs)
 	} else {
-		return c.processWithoutTUI(mode, decryptedData, outputScriptOnly, cmdArgs)
+		return c.processWithoutTUI(mode, entries, outputScriptOnly, cmdArgs)
 	}
 }
 
-// TUIを使用して環境変数を処理
-func (c *CLI) processWithTUI(mode CommandMode, decryptedData []byte, outputScriptOnly bool, cmdArgs []string) error {
-	// コメント付きで環境変数を解析
-	envVarList, err := env.ParseEnvContentWithComments(decryptedData)
+// 復号化した内容を解析し、エクスポートする場合は値の中の変数参照を展開する
+func (c *CLI) parseEnvEntries(mode CommandMode, decryptedData []byte) ([]env.Entry, error) {
+	entries, err := env.Parse(decryptedData)
 	if err != nil {
-		return fmt.Errorf("環境変数の解析に失敗しました: %w", err)
+		return nil, fmt.Errorf("環境変数の解析に失敗しました: %w", err)
 	}
+	if mode != ExportMode || c.noInterpolate {
+		return entries, nil
+	}
+
+	var opts env.InterpolateOptions
+	if c.interpolateEnv {
+		opts.LookupEnv = os.LookupEnv
+	}
+	entries, err = env.Interpolate(entries, opts)
+	if err != nil {
+		return nil, fmt.Errorf("変数参照の展開に失敗しました（展開しない場合は --no-interpolate を指定してください）: %w", err)
+	}
+	return entries, nil
+}
+
+// TUIを使用して環境変数を処理
+func (c *CLI) processWithTUI(mode CommandMode, entries []env.Entry, outputScriptOnly bool, cmdArgs []string) error {
+	// コメント付きの環境変数リストを作成
+	envVarList := env.EnvVarList(entries)
 
 	// TUIで環境変数を選択
 	selectedEnvVars, err := c.selectEnvironmentVariables(envVarList)
@@ -290,22 +558,30 @@ func (c *CLI) processWithTUI(mode CommandMode, decryptedData []byte, outputScrip
 			return c.runNewShell(envVars, enabledCount)
 		} else if len(cmdArgs) > 0 {
 			return c.runCommand(envVars, cmdArgs, enabledCount)
-		} else if outputScriptOnly {
-			script := env.GenerateExportScriptFromEnvVarList(selectedEnvVars)
-			fmt.Print(script)
 		} else {
-			script := env.GenerateExportScriptFromEnvVarList(selectedEnvVars)
-			if err := utils.ExecuteScript(script); err != nil {
+			script, err := env.GenerateExportScriptFromEnvVarList(selectedEnvVars)
+			if err != nil {
+				return err
+			}
+			defer script.Destroy()
+			if outputScriptOnly {
+				os.Stdout.Write(script.Bytes())
+				return nil
+			}
+			if err := utils.ExecuteScript(script.Bytes()); err != nil {
 				return fmt.Errorf("環境変数のエクスポートに失敗しました: %w", err)
 			}
 			fmt.Fprintf(os.Stderr, "%d個の環境変数をエクスポートしました\n", enabledCount)
 		}
 	case UnsetMode:
-		script := env.GenerateUnsetScriptFromEnvVarList(selectedEnvVars)
+		script, err := env.GenerateUnsetScriptFromEnvVarList(selectedEnvVars)
+		if err != nil {
+			return err
+		}
 		if outputScriptOnly {
 			fmt.Print(script)
 		} else {
-			if err := utils.ExecuteScript(script); err != nil {
+			if err := utils.ExecuteScript([]byte(script)); err != nil {
 				return fmt.Errorf("環境変数のアンセットに失敗しました: %w", err)
 			}
 			fmt.Fprintf(os.Stderr, "%d個の環境変数をアンセットしました\n", enabledCount)
@@ -316,12 +592,8 @@ func (c *CLI) processWithTUI(mode CommandMode, decryptedData []byte, outputScrip
 }
 
 // TUIを使用せずに環境変数を処理
-func (c *CLI) processWithoutTUI(mode CommandMode, decryptedData []byte, outputScriptOnly bool, cmdArgs []string) error {
-	// 従来の方法で環境変数を解析
-	envVars, err := env.ParseEnvContent(decryptedData)
-	if err != nil {
-		return fmt.Errorf("環境変数の解析に失敗しました: %w", err)
-	}
+func (c *CLI) processWithoutTUI(mode CommandMode, entries []env.Entry, outputScriptOnly bool, cmdArgs []string) error {
+	envVars := env.EnvMap(entries)
 
 	envVarCount := len(envVars)
 
@@ -332,22 +604,30 @@ func (c *CLI) processWithoutTUI(mode CommandMode, decryptedData []byte, outputSc
 			return c.runNewShell(envVars, envVarCount)
 		} else if len(cmdArgs) > 0 {
 			return c.runCommand(envVars, cmdArgs, envVarCount)
-		} else if outputScriptOnly {
-			script := env.GenerateExportScript(envVars)
-			fmt.Print(script)
 		} else {
-			script := env.GenerateExportScript(envVars)
-			if err := utils.ExecuteScript(script); err != nil {
+			script, err := env.GenerateExportScript(envVars)
+			if err != nil {
+				return err
+			}
+			defer script.Destroy()
+			if outputScriptOnly {
+				os.Stdout.Write(script.Bytes())
+				return nil
+			}
+			if err := utils.ExecuteScript(script.Bytes()); err != nil {
 				return fmt.Errorf("環境変数のエクスポートに失敗しました: %w", err)
 			}
 			fmt.Fprintf(os.Stderr, "%d個の環境変数をエクスポートしました\n", envVarCount)
 		}
 	case UnsetMode:
-		script := env.GenerateUnsetScript(envVars)
+		script, err := env.GenerateUnsetScript(envVars)
+		if err != nil {
+			return err
+		}
 		if outputScriptOnly {
 			fmt.Print(script)
 		} else {
-			if err := utils.ExecuteScript(script); err != nil {
+			if err := utils.ExecuteScript([]byte(script)); err != nil {
 				return fmt.Errorf("環境変数のアンセットに失敗しました: %w", err)
 			}
 			fmt.Fprintf(os.Stderr, "%d個の環境変数をアンセットしました\n", envVarCount)
@@ -416,31 +696,341 @@ func (c *CLI) runCommand(envVars map[string]string, cmdArgs []string, count int)
 }
 
 func (c *CLI) runDump() error {
-	data, err := file.ReadVaultedFile(c.vaultedFile)
+	return c.decryptVaultTo(os.Stdout, c.vaultedFile)
+}
+
+func (c *CLI) selectEnvironmentVariables(envVars []tui.EnvVar) ([]tui.EnvVar, error) {
+	// デフォルトではBubbleteaを使用
+	return tui.EnvVarSelection(envVars, tui.BubbleteaTUI)
+}
+
+// 暗号化用の新しいパスワードを読み込む（対話モードでは確認のため2回入力させる）
+// パスワードはコマンドの終了時に消去される
+func (c *CLI) readNewPassword(prompt string) (*secret.Buffer, error) {
+	if c.passwordStdin {
+		return c.readPassword(prompt)
+	}
+
+	password, err := c.readPassword(prompt)
 	if err != nil {
-		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+		return nil, err
+	}
+	confirmPassword, err := utils.GetPasswordInteractive("パスワードを再入力してください: ")
+	if err != nil {
+		return nil, err
+	}
+	defer confirmPassword.Destroy()
+	if !password.Equal(confirmPassword) {
+		return nil, errors.New("パスワードが一致しません")
 	}
+	return password, nil
+}
 
-	var password string
+// パスワードを読み込む（--password-stdin の場合は標準入力から）
+// パスワードはコマンドの終了時に消去される
+func (c *CLI) readPassword(prompt string) (*secret.Buffer, error) {
+	var password *secret.Buffer
+	var err error
 	if c.passwordStdin {
 		password, err = utils.GetPasswordFromStdin()
 	} else {
-		password, err = utils.GetPasswordInteractive("復号化用パスワードを入力してください: ")
+		password, err = utils.GetPasswordInteractive(prompt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.keepSecret(password), nil
+}
+
+// ファイルからパスワードを読み込む。パスワードはコマンドの終了時に消去される
+func (c *CLI) readPasswordFile(path string) (*secret.Buffer, error) {
+	password, err := utils.GetPasswordFromFile(path)
+	if err != nil {
+		return nil, err
 	}
+	return c.keepSecret(password), nil
+}
+
+func (c *CLI) runUpgrade(args []string) error {
+	targets, err := c.collectUpgradeTargets(args)
 	if err != nil {
 		return err
 	}
+	if len(targets) == 0 {
+		return errors.New("移行対象の暗号化ファイルが見つかりません")
+	}
 
-	decryptedData, err := crypto.Decrypt(data, password)
+	keyFile, err := readKeyFile(c.keyFile)
 	if err != nil {
-		return fmt.Errorf("復号化に失敗しました: %w", err)
+		return err
+	}
+	password, err := c.readPassword("復号化用パスワードを入力してください: ")
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, target := range targets {
+		if err := c.upgradeFile(target, password, keyFile); err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "失敗: %s: %v\n", target, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "成功: %s\n", target)
 	}
 
-	fmt.Print(string(decryptedData))
+	fmt.Fprintf(os.Stderr, "%d個中%d個のファイルを移行しました\n", len(targets), len(targets)-failed)
+	if failed > 0 {
+		return fmt.Errorf("%d個のファイルの移行に失敗しました", failed)
+	}
 	return nil
 }
 
-func (c *CLI) selectEnvironmentVariables(envVars []tui.EnvVar) ([]tui.EnvVar, error) {
-	// デフォルトではBubbleteaを使用
-	return tui.EnvVarSelection(envVars, tui.BubbleteaTUI)
-}
\ No newline at end of file
+// upgrade コマンドの対象ファイルを列挙
+func (c *CLI) collectUpgradeTargets(args []string) ([]string, error) {
+	if len(args) == 0 {
+		if c.recursive {
+			args = []string{"."}
+		} else {
+			args = []string{c.vaultedFile}
+		}
+	}
+
+	if !c.recursive {
+		for i, arg := range args {
+			if arg == "" {
+				args[i] = file.DefaultVaultedFileName
+			}
+		}
+		return args, nil
+	}
+
+	var targets []string
+	for _, root := range args {
+		paths, err := file.FindVaultedFiles(root)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, paths...)
+	}
+	return targets, nil
+}
+
+// 1つの暗号化ファイルを復号化して再暗号化し、バックアップを残して置き換える
+func (c *CLI) upgradeFile(path string, password *secret.Buffer, keyFile []byte) error {
+	data, err := file.ReadVaultedFile(path)
+	if err != nil {
+		return err
+	}
+
+	// パスワードスロットを新しいパラメータで作り直す（他のスロットはそのまま残る）
+	encryptedData, err := crypto.UpdatePasswordSlotParams(data, newPasswordIdentity(password, keyFile), c.kdfOptions)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.BackupFile(path); err != nil {
+		return err
+	}
+
+	return file.ReplaceVaultedFile(path, encryptedData)
+}
+
+// 暗号化ファイルを復号化しながら w に書き込む
+// チャンク形式のファイルは全体をメモリに読み込まずに復号化する
+func (c *CLI) decryptVaultTo(w io.Writer, path string) error {
+	f, signatures, err := file.OpenSignedVaultedFile(path)
+	if err != nil {
+		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+	defer f.Close()
+
+	// 署名の確認は平文を出力する前に行う
+	// 確認した内容とは別に読み直すと、その間にファイルを差し替えられるため、全体を読み込んで同じ内容を復号化する
+	var src io.Reader = f
+	if c.requireSigned != "" {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+		}
+		if err := c.checkSignature(path, data, signatures); err != nil {
+			return err
+		}
+		src = bytes.NewReader(data)
+	}
+
+	// 必要な鍵を判断するため、先にヘッダだけを読み取る
+	head, body, err := crypto.ReadHead(src)
+	if err != nil {
+		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+
+	identities, err := c.unlockIdentities(head, "復号化用パスワードを入力してください: ")
+	if err != nil {
+		return fmt.Errorf("復号化に失敗しました: %w", err)
+	}
+	if err := crypto.DecryptStream(w, io.MultiReader(bytes.NewReader(head), body), identities); err != nil {
+		return fmt.Errorf("復号化に失敗しました: %w", err)
+	}
+	return nil
+}
+
+// 暗号化ファイルを開くためのIdentityを用意する
+// 鍵文字列が指定されている場合はそれを使用する
+// 秘密鍵ファイルやSSH秘密鍵が指定されている、またはパスワードでは開けないファイルの場合は秘密鍵を、それ以外はパスワードを使用する
+func (c *CLI) unlockIdentities(data []byte, prompt string) ([]crypto.Identity, error) {
+	// 鍵文字列が指定されている場合はKDFを使用せずに開く
+	rawKey, err := c.rawKey()
+	if err != nil {
+		return nil, err
+	}
+	if rawKey != nil {
+		return []crypto.Identity{rawKey}, nil
+	}
+	if crypto.RequiresRawKey(data) {
+		return nil, fmt.Errorf("このファイルの復号化には鍵文字列が必要です（--key または %s で指定してください）", RawKeyEnvName)
+	}
+
+	if len(c.identities) > 0 || len(c.sshIdentities) > 0 || !crypto.AcceptsPassword(data) {
+		return c.resolveIdentities()
+	}
+
+	keyFile, err := readKeyFile(c.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if keyFile == nil && crypto.RequiresKeyFile(data) {
+		return nil, fmt.Errorf("%w（--key-file で指定してください）", crypto.ErrKeyFileRequired)
+	}
+	if keyFile != nil && crypto.AcceptsKeyFileOnly(data) {
+		return []crypto.Identity{newPasswordIdentity(nil, keyFile)}, nil
+	}
+
+	password, err := c.readPassword(prompt)
+	if err != nil {
+		return nil, err
+	}
+	return []crypto.Identity{newPasswordIdentity(password, keyFile)}, nil
+}
+
+// --recipient と --recipients-file で指定された受信者を読み込む
+// 受信者が1つも指定されていない場合は、出力先と同じディレクトリの受信者ファイル（.envault-recipients）を使用する
+func (c *CLI) loadRecipients(outputPath string) ([]crypto.Recipient, error) {
+	var recipients []crypto.Recipient
+	for _, s := range c.recipients {
+		r, err := crypto.ParseX25519Recipient(s)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+
+	for _, path := range c.recipientsFiles {
+		fileRecipients, err := readRecipientsFile(path)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, fileRecipients...)
+	}
+
+	sshRecipients, err := loadSSHRecipients(c.sshRecipients)
+	if err != nil {
+		return nil, err
+	}
+	recipients = append(recipients, sshRecipients...)
+
+	if len(recipients) == 0 && !c.skipRecipients {
+		path := filepath.Join(filepath.Dir(outputPath), RecipientsFileName)
+		if _, err := os.Stat(path); err == nil {
+			recipients, err = readRecipientsFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if len(recipients) > 0 {
+				fmt.Fprintf(os.Stderr, "受信者ファイル %s の%d件の受信者で暗号化します（パスワードで暗号化する場合は --no-recipients-file を指定してください）\n", path, len(recipients))
+			}
+		}
+	}
+
+	return recipients, nil
+}
+
+// 受信者ファイルを読み込み、受信者のリストを返す
+func readRecipientsFile(path string) ([]crypto.Recipient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("受信者ファイルの読み込みに失敗しました: %w", err)
+	}
+	recipients, err := crypto.ParseRecipients(data)
+	if err != nil {
+		return nil, fmt.Errorf("受信者ファイル %s の解析に失敗しました: %w", path, err)
+	}
+	return recipients, nil
+}
+
+// 秘密鍵ファイルを読み込む
+func loadIdentities(paths []string) ([]crypto.Identity, error) {
+	var identities []crypto.Identity
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("秘密鍵ファイルの読み込みに失敗しました: %w", err)
+		}
+		fileIdentities, err := crypto.ParseIdentities(data)
+		if err != nil {
+			return nil, fmt.Errorf("秘密鍵ファイル %s の解析に失敗しました: %w", path, err)
+		}
+		identities = append(identities, fileIdentities...)
+	}
+	return identities, nil
+}
+
+// DefaultIdentityPath はデフォルトの秘密鍵ファイルのパスを返します
+// $XDG_CONFIG_HOME が設定されていればその下、なければ ~/.config 以下を使用します
+func DefaultIdentityPath() string {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return filepath.Join(".config", "envault", "key.txt")
+		}
+		configDir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configDir, "envault", "key.txt")
+}
+
+func (c *CLI) runKeygen(outputPath string, signing bool) error {
+	var content, publicKey string
+	if signing {
+		var err error
+		content, publicKey, err = generateSigningKeyContent()
+		if err != nil {
+			return err
+		}
+	} else {
+		id, err := crypto.GenerateX25519Identity()
+		if err != nil {
+			return err
+		}
+		publicKey = id.Recipient().String()
+		content = fmt.Sprintf("# created: %s\n# public key: %s\n%s\n",
+			time.Now().Format(time.RFC3339), publicKey, id.String())
+	}
+
+	if outputPath == "" {
+		fmt.Print(content)
+	} else {
+		if _, err := os.Stat(outputPath); err == nil {
+			return fmt.Errorf("ファイル '%s' は既に存在します", outputPath)
+		}
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0700); err != nil {
+			return fmt.Errorf("ディレクトリの作成に失敗しました: %w", err)
+		}
+		if err := file.WriteFileAtomic(outputPath, []byte(content), 0600); err != nil {
+			return fmt.Errorf("秘密鍵の書き込みに失敗しました: %w", err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "公開鍵: %s\n", publicKey)
+	return nil
+}
@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+// info コマンドを作成
+func (c *CLI) newInfoCommand() *cobra.Command {
+	var jsonOutput bool
+	infoCmd := &cobra.Command{
+		Use:   "info [オプション] [暗号化ファイル]",
+		Short: "暗号化ファイルの形式・キースロット・メタデータを表示（パスワード不要）",
+		Long: `暗号化ファイルを復号化せずに、ヘッダの内容（形式とバージョン、KDFのパラメータ、ソルト長、
+キースロットとフィンガープリント、暗号文のサイズ）とメタデータ（作成者、作成・更新日時、環境名、説明、変数名の一覧）を表示します。
+暗号化ファイルを省略すると -f で指定したファイル（デフォルトは .env.vaulted）を使用します。
+メタデータは改ざんされると復号化に失敗するため、復号化できるファイルであれば表示内容は信頼できます。
+- 人が読む形式で表示: envault info
+- JSONで出力: envault info --json`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := c.vaultedFilePath()
+			if len(args) > 0 {
+				path = args[0]
+			}
+			return runInfo(os.Stdout, path, jsonOutput)
+		},
+	}
+	infoCmd.Flags().BoolVar(&jsonOutput, "json", false, "JSON形式で出力")
+	return infoCmd
+}
+
+func runInfo(w io.Writer, path string, jsonOutput bool) error {
+	// ASCII armor形式かどうかも表示するため、armorを外さずに読み込む
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s: %w", path, file.ErrFileNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("ファイルの読み込みに失敗しました: %w", err)
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("%s: %w", path, file.ErrEmptyFile)
+	}
+
+	info, err := crypto.Inspect(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if jsonOutput {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+
+	format := info.Format
+	if info.Armored {
+		format += " (ASCII armor)"
+	}
+	fmt.Fprintf(w, "ファイル: %s\n", path)
+	fmt.Fprintf(w, "形式: %s\n", format)
+	fmt.Fprintf(w, "バージョン: %d\n", info.Version)
+	fmt.Fprintf(w, "暗号方式: %s\n", info.Cipher)
+	fmt.Fprintf(w, "ヘッダ: %d バイト\n", info.HeaderSize)
+	if info.ChunkSize > 0 {
+		fmt.Fprintf(w, "暗号文: %d バイト（%d KiBごとのチャンク）\n", info.CiphertextSize, info.ChunkSize/1024)
+	} else {
+		fmt.Fprintf(w, "暗号文: %d バイト\n", info.CiphertextSize)
+	}
+	if info.Format == crypto.FormatStructured.String() {
+		entries := fmt.Sprintf("%d個", info.Entries)
+		if info.HashedKeys {
+			entries += "（キー名はHMACで隠されています）"
+		}
+		fmt.Fprintf(w, "変数: %s\n", entries)
+	}
+	if info.KDF != nil {
+		fmt.Fprintf(w, "KDF: %s（パスワードで直接暗号化された旧形式）\n", describeKDFInfo(info.KDF))
+	}
+
+	if len(info.Slots) > 0 {
+		fmt.Fprintf(w, "キースロット: %d個\n", len(info.Slots))
+		for i, slot := range info.Slots {
+			fmt.Fprintf(w, "  %d: %s\n", i, describeSlotInfo(&slot))
+		}
+	}
+
+	if len(info.Signers) > 0 {
+		fmt.Fprintf(w, "埋め込み署名: %s（未検証、envault verify で検証できます）\n", strings.Join(info.Signers, ", "))
+	}
+
+	if info.Metadata == nil {
+		fmt.Fprintln(w, "メタデータ: なし")
+		return nil
+	}
+	fmt.Fprintln(w, "メタデータ:")
+	printMetadata(w, info.Metadata)
+	return nil
+}
+
+// キースロットの種類・フィンガープリント・KDFのパラメータを表す文字列を返す
+func describeSlotInfo(slot *crypto.SlotInfo) string {
+	slotType := slot.Type
+	if slot.Type == crypto.SlotTypePassword && slot.KDF != nil && slot.KDF.KeyFile {
+		slotType += "+keyfile"
+	}
+
+	parts := []string{slotType}
+	if slot.Fingerprint != "" {
+		parts = append(parts, slot.Fingerprint)
+	}
+	if slot.KDF != nil {
+		parts = append(parts, "("+describeKDFInfo(slot.KDF)+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+func describeKDFInfo(kdf *crypto.KDFInfo) string {
+	if kdf.ID == "scrypt" {
+		return fmt.Sprintf("scrypt logN=%d salt=%dバイト", kdf.LogN, kdf.SaltLength)
+	}
+	return fmt.Sprintf("%s time=%d memory=%dKiB threads=%d salt=%dバイト",
+		kdf.ID, kdf.Time, kdf.Memory, kdf.Threads, kdf.SaltLength)
+}
+
+func printMetadata(w io.Writer, m *crypto.Metadata) {
+	printField := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "  %s: %s\n", label, value)
+		}
+	}
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Local().Format(time.RFC3339)
+	}
+
+	printField("作成者", m.Creator)
+	printField("作成日時", formatTime(m.CreatedAt))
+	printField("更新日時", formatTime(m.UpdatedAt))
+	printField("環境", m.Environment)
+	printField("説明", m.Description)
+	if len(m.Keys) > 0 {
+		printField("変数", fmt.Sprintf("%d個 (%s)", len(m.Keys), strings.Join(m.Keys, ", ")))
+	}
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+func TestInfoCommand(t *testing.T) {
+	tempDir := t.TempDir()
+	envPath := filepath.Join(tempDir, ".env")
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+
+	if err := os.WriteFile(envPath, []byte("TEST_VAR1=value1\n"), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+	withStdin(t, "test-password\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"encrypt", envPath, "-p", "-f", vaultPath, "--armor", "--environment", "staging"})
+	}); err != nil {
+		t.Fatalf("Run(encrypt) error = %v", err)
+	}
+
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"info", "-f", vaultPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(info) error = %v", err)
+	}
+	for _, want := range []string{"形式: envault2 (ASCII armor)", "キースロット: 1個", "0: password (argon2id", "salt=16バイト", "環境: staging"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Run(info) の出力に %q が含まれていません:\n%s", want, output)
+		}
+	}
+
+	output, err = captureOutput(func() error {
+		return NewCLI().Run([]string{"info", "--json", vaultPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(info --json) error = %v", err)
+	}
+	var info crypto.VaultInfo
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		t.Fatalf("JSONとして読み取れません: %v\n%s", err, output)
+	}
+	if info.Format != "envault2" || !info.Armored || len(info.Slots) != 1 || info.Metadata == nil || info.Metadata.Environment != "staging" {
+		t.Errorf("Run(info --json) = %+v", info)
+	}
+}
+
+func TestInfoCommandDiagnostics(t *testing.T) {
+	tempDir := t.TempDir()
+	truncatedPath := filepath.Join(tempDir, "truncated.vaulted")
+	plainPath := filepath.Join(tempDir, "plain.vaulted")
+
+	if err := os.WriteFile(truncatedPath, []byte("ENVAULT2\x00\x00"), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+	if err := os.WriteFile(plainPath, []byte("TEST_VAR1=value1\n"), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	if err := NewCLI().Run([]string{"info", truncatedPath}); !errors.Is(err, crypto.ErrTruncatedFile) {
+		t.Errorf("Run(info 切れたファイル) error = %v, want %v", err, crypto.ErrTruncatedFile)
+	}
+	if err := NewCLI().Run([]string{"info", plainPath}); !errors.Is(err, crypto.ErrBadMagic) {
+		t.Errorf("Run(info 平文) error = %v, want %v", err, crypto.ErrBadMagic)
+	}
+	if err := NewCLI().Run([]string{"info", filepath.Join(tempDir, "missing.vaulted")}); !errors.Is(err, file.ErrFileNotFound) {
+		t.Errorf("Run(info 存在しないファイル) error = %v, want %v", err, file.ErrFileNotFound)
+	}
+}
@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+const (
+	// ProjectConfigFileName はプロジェクト設定ファイルのデフォルトのファイル名です
+	ProjectConfigFileName = ".envault.json"
+)
+
+// kdfConfig はプロジェクト設定ファイルに保存するArgon2idのパラメータです
+type kdfConfig struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// kdf コマンドとサブコマンドを作成
+func (c *CLI) newKDFCommand() *cobra.Command {
+	kdfCmd := &cobra.Command{
+		Use:   "kdf",
+		Short: "パスワードからの鍵導出（Argon2id）のパラメータを管理",
+		Long: `パスワードから鍵を導出するArgon2idのパラメータを、このマシンで測定して決めます。
+- 500ms程度になるパラメータを表示: envault kdf benchmark --target 500ms
+- プロジェクト設定ファイルに保存: envault kdf benchmark --target 500ms --write`,
+	}
+
+	var target time.Duration
+	var threads uint8
+	var maxMemory uint32
+	var write bool
+	benchmarkCmd := &cobra.Command{
+		Use:   "benchmark [オプション]",
+		Short: "このマシンで鍵導出の時間を測定し、推奨パラメータを表示",
+		Long: `メモリ使用量を倍にしながら鍵導出の時間を測定し、目標時間に近いパラメータを推奨します。
+メモリ使用量が上限に達しても目標時間に届かない場合は、反復回数を増やします。
+--write を指定すると、推奨パラメータをプロジェクト設定ファイル（デフォルトは .envault.json）に保存し、
+以降の encrypt・upgrade・passwd・slot add などで --kdf-* を省略したときに使用します。
+推奨パラメータが下限を下回る場合は、下限のパラメータを推奨します。
+ファイルを開くマシンが遅い場合は、そのマシンで測定するか目標時間を短くしてください。`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.runKDFBenchmark(target, threads, maxMemory, write)
+		},
+	}
+	benchmarkCmd.Flags().DurationVar(&target, "target", 500*time.Millisecond, "鍵導出の目標時間")
+	benchmarkCmd.Flags().Uint8Var(&threads, "threads", crypto.ArgonThreads, "Argon2idの並列度")
+	benchmarkCmd.Flags().Uint32Var(&maxMemory, "max-memory", crypto.DefaultBenchmarkMaxMemory, "メモリ使用量の上限（KiB）")
+	benchmarkCmd.Flags().BoolVar(&write, "write", false, "推奨パラメータをプロジェクト設定ファイルに保存する")
+	kdfCmd.AddCommand(benchmarkCmd)
+
+	return kdfCmd
+}
+
+func (c *CLI) runKDFBenchmark(target time.Duration, threads uint8, maxMemory uint32, write bool) error {
+	fmt.Fprintf(os.Stderr, "目標時間 %v で鍵導出の時間を測定しています...\n", target)
+	results, err := crypto.TuneKDF(target, threads, maxMemory)
+	if err != nil {
+		return fmt.Errorf("鍵導出の測定に失敗しました: %w", err)
+	}
+	for _, r := range results {
+		fmt.Fprintf(os.Stderr, "  %s: %v\n", formatKDFOptions(r.Options), r.Duration.Round(time.Millisecond))
+	}
+
+	recommended := results[len(results)-1]
+	opts := recommended.Options
+	fmt.Printf("推奨パラメータ（約%v）: --kdf-time %d --kdf-memory %d --kdf-threads %d\n",
+		recommended.Duration.Round(time.Millisecond), opts.ArgonTime, opts.ArgonMemory, opts.ArgonThreads)
+	if recommended.Duration > target {
+		fmt.Fprintln(os.Stderr, "警告: 下限のパラメータでも目標時間を超えています")
+	}
+
+	if !write {
+		return nil
+	}
+	path := c.projectConfigPath()
+	config := kdfConfig{Time: opts.ArgonTime, Memory: opts.ArgonMemory, Threads: opts.ArgonThreads}
+	if err := saveKDFConfig(path, config); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "プロジェクト設定ファイルに保存しました: %s\n", path)
+	return nil
+}
+
+// Argon2idのパラメータを人が読む形式にする
+func formatKDFOptions(opts crypto.Options) string {
+	return fmt.Sprintf("time=%d memory=%dMiB threads=%d", opts.ArgonTime, opts.ArgonMemory/1024, opts.ArgonThreads)
+}
+
+// プロジェクト設定ファイルのパスを返す（指定がなければカレントディレクトリの .envault.json）
+func (c *CLI) projectConfigPath() string {
+	if c.configFile != "" {
+		return c.configFile
+	}
+	return ProjectConfigFileName
+}
+
+// プロジェクト設定ファイルを読み込む
+// ファイルがない場合は空の設定を返す。他のツールや今後の設定項目を失わないよう、知らないキーもそのまま保持する
+func readProjectConfig(path string) (map[string]json.RawMessage, error) {
+	config := make(map[string]json.RawMessage)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("プロジェクト設定ファイルの読み込みに失敗しました: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("プロジェクト設定ファイル %s の解析に失敗しました: %w", path, err)
+	}
+	return config, nil
+}
+
+// プロジェクト設定ファイルからArgon2idのパラメータを読み込む
+func loadKDFConfig(path string) (*kdfConfig, error) {
+	config, err := readProjectConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := config["kdf"]
+	if !ok {
+		return nil, nil
+	}
+	var kdf kdfConfig
+	if err := json.Unmarshal(raw, &kdf); err != nil {
+		return nil, fmt.Errorf("プロジェクト設定ファイル %s の kdf の解析に失敗しました: %w", path, err)
+	}
+	return &kdf, nil
+}
+
+// プロジェクト設定ファイルのArgon2idのパラメータを書き換える
+func saveKDFConfig(path string, kdf kdfConfig) error {
+	config, err := readProjectConfig(path)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(kdf)
+	if err != nil {
+		return err
+	}
+	config["kdf"] = raw
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := file.WriteFileAtomic(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("プロジェクト設定ファイルの書き込みに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// --kdf-* フラグを持つコマンドで、省略されたフラグにプロジェクト設定ファイルの値を使用し、下限を満たしているか確認する
+// パスワードを入力させる前に確認するため、コマンドの実行前に呼び出す
+func (c *CLI) applyKDFConfig(cmd *cobra.Command) error {
+	if cmd.Flags().Lookup("kdf-time") == nil {
+		return nil
+	}
+
+	path := c.projectConfigPath()
+	config, err := loadKDFConfig(path)
+	if err != nil {
+		return err
+	}
+	source := "--kdf-* の指定"
+	if config != nil {
+		if !cmd.Flags().Changed("kdf-time") && config.Time != 0 {
+			c.kdfOptions.ArgonTime = config.Time
+		}
+		if !cmd.Flags().Changed("kdf-memory") && config.Memory != 0 {
+			c.kdfOptions.ArgonMemory = config.Memory
+		}
+		if !cmd.Flags().Changed("kdf-threads") && config.Threads != 0 {
+			c.kdfOptions.ArgonThreads = config.Threads
+		}
+		source = fmt.Sprintf("--kdf-* またはプロジェクト設定ファイル %s の指定", path)
+	}
+
+	if err := c.kdfOptions.Validate(); err != nil {
+		return fmt.Errorf("%sを確認してください: %w", source, err)
+	}
+	return nil
+}
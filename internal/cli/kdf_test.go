@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uzulla/envault/internal/crypto"
+)
+
+func TestKDFBenchmarkAndConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	envPath := filepath.Join(tempDir, ".env")
+	vaultPath := filepath.Join(tempDir, "test.vaulted")
+	configPath := filepath.Join(tempDir, ProjectConfigFileName)
+	if err := os.WriteFile(envPath, []byte("TEST_VAR1=value1\n"), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	// 下限を下回るパラメータはパスワードを読み込む前に拒否する
+	withStdin(t, "password\n")
+	err := NewCLI().Run([]string{"encrypt", "-p", "--kdf-memory", "8192", "--config", configPath, "-f", vaultPath, envPath})
+	if !errors.Is(err, crypto.ErrWeakKDFParams) {
+		t.Errorf("弱いパラメータで encrypt error = %v, want %v", err, crypto.ErrWeakKDFParams)
+	}
+	if _, err := os.Stat(vaultPath); !os.IsNotExist(err) {
+		t.Error("弱いパラメータで暗号化ファイルが作成されました")
+	}
+
+	// 他の設定項目を保持したまま推奨パラメータを保存する
+	if err := os.WriteFile(configPath, []byte(`{"other": {"keep": true}}`), 0644); err != nil {
+		t.Fatalf("設定ファイルの作成に失敗しました: %v", err)
+	}
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"kdf", "benchmark", "--target", "1ms", "--threads", "1",
+			"--max-memory", "19456", "--write", "--config", configPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(kdf benchmark) error = %v", err)
+	}
+	if !strings.HasPrefix(output, "推奨パラメータ") {
+		t.Errorf("Run(kdf benchmark) の出力が期待と異なります: %s", output)
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("設定ファイルの読み込みに失敗しました: %v", err)
+	}
+	var config struct {
+		Other map[string]bool `json:"other"`
+		KDF   kdfConfig       `json:"kdf"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("設定ファイルの解析に失敗しました: %v\n%s", err, data)
+	}
+	if !config.Other["keep"] {
+		t.Errorf("他の設定項目が保持されていません: %s", data)
+	}
+	if config.KDF != (kdfConfig{Time: 2, Memory: 19456, Threads: 1}) {
+		t.Errorf("保存されたパラメータ = %+v", config.KDF)
+	}
+
+	// 保存したパラメータは --kdf-* を省略したときに使用される
+	withStdin(t, "password\n")
+	if err := NewCLI().Run([]string{"encrypt", "-p", "--config", configPath, "-f", vaultPath, envPath}); err != nil {
+		t.Fatalf("Run(encrypt) error = %v", err)
+	}
+	assertSlotKDF(t, vaultPath, 2, 19456, 1)
+
+	// フラグは設定ファイルより優先される
+	withStdin(t, "password\n")
+	if err := NewCLI().Run([]string{"upgrade", "-p", "--kdf-time", "3", "--config", configPath, "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(upgrade) error = %v", err)
+	}
+	assertSlotKDF(t, vaultPath, 3, 19456, 1)
+
+	// 設定ファイルのパラメータも下限を満たす必要がある
+	if err := os.WriteFile(configPath, []byte(`{"kdf": {"time": 1, "memory": 1024, "threads": 1}}`), 0644); err != nil {
+		t.Fatalf("設定ファイルの作成に失敗しました: %v", err)
+	}
+	withStdin(t, "password\n")
+	err = NewCLI().Run([]string{"encrypt", "-p", "--config", configPath, "-f", vaultPath, envPath})
+	if !errors.Is(err, crypto.ErrWeakKDFParams) {
+		t.Errorf("設定ファイルの弱いパラメータで encrypt error = %v, want %v", err, crypto.ErrWeakKDFParams)
+	}
+}
+
+func assertSlotKDF(t *testing.T, path string, wantTime, wantMemory uint32, wantThreads uint8) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("暗号化ファイルの読み込みに失敗しました: %v", err)
+	}
+	info, err := crypto.Inspect(data)
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+	if len(info.Slots) != 1 || info.Slots[0].KDF == nil {
+		t.Fatalf("スロットの情報が期待と異なります: %+v", info.Slots)
+	}
+	kdf := info.Slots[0].KDF
+	if kdf.Time != wantTime || kdf.Memory != wantMemory || kdf.Threads != wantThreads {
+		t.Errorf("スロットのKDF = time=%d memory=%d threads=%d, want time=%d memory=%d threads=%d",
+			kdf.Time, kdf.Memory, kdf.Threads, wantTime, wantMemory, wantThreads)
+	}
+}
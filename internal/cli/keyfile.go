@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+	"github.com/uzulla/envault/pkg/secret"
+)
+
+// keyfile コマンドとサブコマンドを作成
+func (c *CLI) newKeyfileCommand() *cobra.Command {
+	keyfileCmd := &cobra.Command{
+		Use:   "keyfile",
+		Short: "パスワードと組み合わせるキーファイルを管理",
+		Long: `パスワードと組み合わせて（またはキーファイルのみで）暗号化ファイルを開くためのキーファイルを管理します。
+キーファイルは --key-file で指定します。
+- キーファイルの生成: envault keyfile generate ~/.config/envault/prod.key
+- パスワードとキーファイルで暗号化: envault encrypt .env --key-file ~/.config/envault/prod.key`,
+	}
+
+	generateCmd := &cobra.Command{
+		Use:   "generate <保存先>",
+		Short: "新しいキーファイルを生成",
+		Long: `乱数からキーファイルを生成し、所有者のみが読み書きできる権限（0600）で保存します。
+既存のファイルは上書きしません。キーファイルを失うと暗号化ファイルを開けなくなるため、安全な場所にバックアップしてください。`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runKeyfileGenerate(args[0])
+		},
+	}
+	keyfileCmd.AddCommand(generateCmd)
+
+	return keyfileCmd
+}
+
+func runKeyfileGenerate(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("ファイルが既に存在します: %s", path)
+	}
+
+	content, err := crypto.GenerateKeyFile()
+	if err != nil {
+		return err
+	}
+
+	if err := file.WriteFileAtomic(path, content, 0600); err != nil {
+		return fmt.Errorf("キーファイルの書き込みに失敗しました: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "キーファイルを作成しました: %s\n", path)
+	return nil
+}
+
+// キーファイルを読み込む（指定がなければ nil）
+func readKeyFile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("キーファイルの読み込みに失敗しました: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("キーファイルが空です")
+	}
+	return data, nil
+}
+
+// パスワードと（指定されていれば）キーファイルからパスワードスロットの受信者を作成
+// キーファイルのみのスロットを作成する場合、password は nil でもよい
+func newPasswordRecipient(password *secret.Buffer, keyFile []byte, opts crypto.Options) *crypto.PasswordRecipient {
+	r := crypto.NewPasswordRecipientFromSecret(password, opts)
+	if keyFile != nil {
+		r = r.WithKeyFile(keyFile)
+	}
+	return r
+}
+
+// パスワードと（指定されていれば）キーファイルからパスワードスロットを開くIdentityを作成
+// キーファイルのみのスロットを開く場合、password は nil でもよい
+func newPasswordIdentity(password *secret.Buffer, keyFile []byte) *crypto.PasswordIdentity {
+	id := crypto.NewPasswordIdentityFromSecret(password)
+	if keyFile != nil {
+		id = id.WithKeyFile(keyFile)
+	}
+	return id
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+func TestKeyfileCommands(t *testing.T) {
+	tempDir := t.TempDir()
+	keyPath := filepath.Join(tempDir, "prod.key")
+	envPath := filepath.Join(tempDir, ".env")
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	content := "TEST_VAR1=value1\n"
+
+	if err := NewCLI().Run([]string{"keyfile", "generate", keyPath}); err != nil {
+		t.Fatalf("Run(keyfile generate) error = %v", err)
+	}
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatalf("キーファイルが作成されていません: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("キーファイルの権限 = %v, want 0600", info.Mode().Perm())
+	}
+	if err := NewCLI().Run([]string{"keyfile", "generate", keyPath}); err == nil {
+		t.Errorf("既存のキーファイルが上書きされました")
+	}
+
+	if err := os.WriteFile(envPath, []byte(content), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+	withStdin(t, "test-password\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"encrypt", envPath, "-p", "--key-file", keyPath, "-f", vaultPath})
+	}); err != nil {
+		t.Fatalf("Run(encrypt --key-file) error = %v", err)
+	}
+
+	withStdin(t, "test-password\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-p", "-f", vaultPath})
+	}); !errors.Is(err, crypto.ErrKeyFileRequired) {
+		t.Errorf("Run(dump キーファイルなし) error = %v, want %v", err, crypto.ErrKeyFileRequired)
+	}
+
+	withStdin(t, "test-password\n")
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-p", "-f", vaultPath, "--key-file", keyPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(dump --key-file) error = %v", err)
+	}
+	if output != content {
+		t.Errorf("Run(dump) = %q, want %q", output, content)
+	}
+}
+
+func TestKeyFileOnlyEncrypt(t *testing.T) {
+	tempDir := t.TempDir()
+	keyPath := filepath.Join(tempDir, "ci.key")
+	envPath := filepath.Join(tempDir, ".env")
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	content := "TEST_VAR1=value1\n"
+
+	if err := NewCLI().Run([]string{"keyfile", "generate", keyPath}); err != nil {
+		t.Fatalf("Run(keyfile generate) error = %v", err)
+	}
+	if err := os.WriteFile(envPath, []byte(content), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	// 空のパスワードでキーファイルのみのスロットを作成する
+	withStdin(t, "\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"encrypt", envPath, "-p", "--key-file", keyPath, "-f", vaultPath})
+	}); err != nil {
+		t.Fatalf("Run(encrypt --key-file) error = %v", err)
+	}
+
+	// パスワードを入力せずに復号化できること
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-f", vaultPath, "--key-file", keyPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(dump --key-file) error = %v", err)
+	}
+	if output != content {
+		t.Errorf("Run(dump) = %q, want %q", output, content)
+	}
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/uzulla/envault/internal/env"
+	"github.com/uzulla/envault/pkg/secret"
+)
+
+const (
+	// --strict を指定しない場合に書式を確認する.envファイルの大きさの上限
+	// 証明書など.env以外の大きなファイルは、全体をメモリに読み込まずに暗号化するため確認しない
+	maxCheckSize = 1024 * 1024
+
+	// 表示する書式の問題の件数の上限
+	maxPrintedDiagnostics = 20
+)
+
+// 暗号化する.envファイルの書式を確認し、問題を標準エラー出力に表示する
+// 確認のために読み込んだ内容は buf に保持し、残りと続けて読める Reader を返す
+// --strict の場合はファイル全体を確認し、エラーがあれば暗号化を中止する
+func (c *CLI) checkEnvSource(path string, src io.Reader, buf *secret.Buffer) (io.Reader, error) {
+	head := src
+	if !c.strict {
+		head = io.LimitReader(src, maxCheckSize+1)
+	}
+	if _, err := buf.ReadFrom(head); err != nil {
+		return nil, fmt.Errorf(".envファイルの読み込みに失敗しました: %w", err)
+	}
+	input := io.MultiReader(bytes.NewReader(buf.Bytes()), src)
+	if buf.Len() > maxCheckSize && !c.strict {
+		return input, nil
+	}
+
+	_, diags := env.ParseWithDiagnostics(buf.Bytes())
+	printDiagnostics(path, diags)
+	if c.strict && diags.HasErrors() {
+		return nil, fmt.Errorf("%s の書式にエラーがあるため暗号化を中止しました（--strict）", path)
+	}
+	return input, nil
+}
+
+// 書式の問題を「ファイル名:行:列: 重大度: メッセージ」の形式で標準エラー出力に表示する
+func printDiagnostics(path string, diags env.Diagnostics) {
+	for i, d := range diags {
+		if i == maxPrintedDiagnostics {
+			fmt.Fprintf(os.Stderr, "%s: ほかに%d件の問題があります\n", path, len(diags)-i)
+			break
+		}
+		fmt.Fprintf(os.Stderr, "%s:%s\n", path, d)
+	}
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uzulla/envault/internal/crypto"
+)
+
+// 標準エラー出力をキャプチャする
+func captureStderr(t *testing.T, f func() error) (string, error) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("パイプの作成に失敗しました: %v", err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	done := make(chan []byte)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		done <- buf.Bytes()
+	}()
+
+	err = f()
+	w.Close()
+	os.Stderr = stderr
+	return string(<-done), err
+}
+
+func TestEncryptDiagnostics(t *testing.T) {
+	tempDir := t.TempDir()
+	envPath := filepath.Join(tempDir, ".env")
+	vaultPath := filepath.Join(tempDir, "test.vaulted")
+	content := "A=1\nsecret-without-equals\nB=\"unterminated\nA=2\n"
+	if err := os.WriteFile(envPath, []byte(content), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	// --strict ではエラーのあるファイルを暗号化しない（パスワードを読み込む前に中止する）
+	stderr, err := captureStderr(t, func() error {
+		return NewCLI().Run([]string{"encrypt", "--strict", "-p", "-f", vaultPath, envPath})
+	})
+	if err == nil || !strings.Contains(err.Error(), "--strict") {
+		t.Errorf("Run(encrypt --strict) error = %v", err)
+	}
+	if _, err := os.Stat(vaultPath); !os.IsNotExist(err) {
+		t.Error("--strict でエラーのあるファイルが暗号化されました")
+	}
+	for _, want := range []string{envPath + ":2:1: エラー:", envPath + ":3:3: エラー:", envPath + ":4:1: 警告:"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("標準エラー出力に %q が含まれていません:\n%s", want, stderr)
+		}
+	}
+	if strings.Contains(stderr, "secret-without-equals") || strings.Contains(stderr, "unterminated") {
+		t.Errorf("標準エラー出力に値が含まれています:\n%s", stderr)
+	}
+
+	// --strict でなければ問題を表示したうえで暗号化する
+	withStdin(t, "password\n")
+	stderr, err = captureStderr(t, func() error {
+		return NewCLI().Run([]string{"encrypt", "-p", "-f", vaultPath, envPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(encrypt) error = %v", err)
+	}
+	if !strings.Contains(stderr, envPath+":2:1: エラー:") {
+		t.Errorf("標準エラー出力に問題が表示されていません:\n%s", stderr)
+	}
+	data, err := os.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatalf("暗号化ファイルの読み込みに失敗しました: %v", err)
+	}
+	decrypted, err := crypto.Decrypt(data, "password")
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if string(decrypted) != content {
+		t.Errorf("復号化した内容 = %q, want %q", decrypted, content)
+	}
+
+	// 問題のないファイルは --strict でも何も表示せずに暗号化する
+	if err := os.WriteFile(envPath, []byte("A=1\nB=\"multi\nline\"\n"), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+	withStdin(t, "password\n")
+	stderr, err = captureStderr(t, func() error {
+		return NewCLI().Run([]string{"encrypt", "--strict", "-p", "-f", filepath.Join(tempDir, "clean.vaulted"), envPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(encrypt --strict) error = %v", err)
+	}
+	if stderr != "" {
+		t.Errorf("問題のないファイルで標準エラー出力 = %q", stderr)
+	}
+}
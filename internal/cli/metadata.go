@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/env"
+	"github.com/uzulla/envault/internal/file"
+	"github.com/uzulla/envault/pkg/secret"
+)
+
+// 暗号化ファイルに記録するメタデータを作成する
+// 出力先に既存のメタデータがある場合は、作成者・作成日時・環境名・説明を引き継ぎ、更新日時を現在の日時にする
+// メタデータのオプションが指定されておらず、既存のメタデータもない場合は nil を返す
+// 変数名の一覧を記録する場合のみ envFilePath の.envファイルを読み込む
+func (c *CLI) buildMetadata(envFilePath, outputPath string) (*crypto.Metadata, error) {
+	var previous *crypto.Metadata
+	if existing, err := os.ReadFile(outputPath); err == nil {
+		// 既存のファイルが読み取れない場合は新しいメタデータとして扱う
+		previous, _ = crypto.ReadMetadata(existing)
+	}
+
+	if previous == nil && c.creator == "" && c.environment == "" && c.description == "" && !c.listKeys {
+		return nil, nil
+	}
+	if c.listKeys && c.hashKeys {
+		return nil, errors.New("--hash-keys と --list-keys は同時に指定できません")
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	metadata := &crypto.Metadata{CreatedAt: now}
+	if previous != nil {
+		*metadata = *previous
+		if metadata.CreatedAt.IsZero() {
+			metadata.CreatedAt = now
+		}
+	}
+	metadata.UpdatedAt = now
+
+	if c.creator != "" {
+		metadata.Creator = c.creator
+	} else if metadata.Creator == "" {
+		metadata.Creator = currentCreator()
+	}
+	if c.environment != "" {
+		metadata.Environment = c.environment
+	}
+	if c.description != "" {
+		metadata.Description = c.description
+	}
+
+	metadata.Keys = nil
+	if c.listKeys || (previous != nil && previous.Keys != nil && !c.hashKeys) {
+		keys, err := readEnvKeys(envFilePath)
+		if err != nil {
+			return nil, err
+		}
+		metadata.Keys = keys
+	}
+
+	return metadata, nil
+}
+
+// .envファイルの変数名を、重複を除いて出現順に返す
+// 値を含む内容は secret.Buffer に読み込み、使い終わったら消去する
+func readEnvKeys(envFilePath string) ([]string, error) {
+	f, err := file.OpenEnvFile(envFilePath)
+	if err != nil {
+		return nil, fmt.Errorf(".envファイルの読み込みに失敗しました: %w", err)
+	}
+	defer f.Close()
+
+	data := secret.New(0)
+	defer data.Destroy()
+	if _, err := data.ReadFrom(f); err != nil {
+		return nil, fmt.Errorf(".envファイルの読み込みに失敗しました: %w", err)
+	}
+
+	keys := env.ParseDocument(data.Bytes()).Keys()
+	if keys == nil {
+		keys = []string{}
+	}
+	return keys, nil
+}
+
+// 作成者として記録する「ユーザー名@ホスト名」を返す
+func currentCreator() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return name + "@" + host
+	}
+	return name
+}
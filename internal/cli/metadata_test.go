@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+func TestEncryptMetadataAndInfo(t *testing.T) {
+	tempDir := t.TempDir()
+	envPath := filepath.Join(tempDir, ".env")
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+
+	// 同じキーが複数回定義されていても、変数名の一覧には1回だけ記録される
+	if err := os.WriteFile(envPath, []byte("TEST_VAR1=value1\nTEST_VAR2=value2\nTEST_VAR1=override\n"), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	withStdin(t, "test-password\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"encrypt", envPath, "-p", "-f", vaultPath,
+			"--environment", "production", "--description", "本番用", "--creator", "alice", "--list-keys"})
+	}); err != nil {
+		t.Fatalf("Run(encrypt) error = %v", err)
+	}
+
+	// パスワードなしで表示できること
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"info", vaultPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(info) error = %v", err)
+	}
+	for _, want := range []string{"作成者: alice", "環境: production", "説明: 本番用", "変数: 2個 (TEST_VAR1, TEST_VAR2)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Run(info) の出力に %q が含まれていません:\n%s", want, output)
+		}
+	}
+
+	data, err := os.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatalf("暗号化ファイルの読み込みに失敗しました: %v", err)
+	}
+	first, err := crypto.ReadMetadata(data)
+	if err != nil || first == nil {
+		t.Fatalf("ReadMetadata() = %v, %v", first, err)
+	}
+
+	// 暗号化し直すと環境名・作成日時を引き継ぎ、変数名の一覧を更新すること
+	if err := os.WriteFile(envPath, []byte("TEST_VAR1=value1\nTEST_VAR3=value3\n"), 0600); err != nil {
+		t.Fatalf("テストファイルの更新に失敗しました: %v", err)
+	}
+	withStdin(t, "test-password\ny\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"encrypt", envPath, "-p", "-f", vaultPath})
+	}); err != nil {
+		t.Fatalf("Run(encrypt) error = %v", err)
+	}
+	data, err = os.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatalf("暗号化ファイルの読み込みに失敗しました: %v", err)
+	}
+	second, err := crypto.ReadMetadata(data)
+	if err != nil || second == nil {
+		t.Fatalf("ReadMetadata() = %v, %v", second, err)
+	}
+	if second.Environment != "production" || second.Creator != "alice" || !second.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("メタデータが引き継がれていません: %+v", second)
+	}
+	if strings.Join(second.Keys, ",") != "TEST_VAR1,TEST_VAR3" {
+		t.Errorf("変数名の一覧 = %v, want [TEST_VAR1 TEST_VAR3]", second.Keys)
+	}
+
+	if err := NewCLI().Run([]string{"encrypt", envPath, "-p", "-f", vaultPath, "--format", "age", "--environment", "production"}); err == nil {
+		t.Errorf("age形式でメタデータを指定できてしまいました")
+	}
+}
+
+func TestSlotAddUpdatesMetadata(t *testing.T) {
+	tempDir := t.TempDir()
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+
+	past := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	metadata := &crypto.Metadata{Creator: "alice", CreatedAt: past, UpdatedAt: past, Environment: "production"}
+	recipient := crypto.NewPasswordRecipient("personal", crypto.DefaultOptions())
+	encrypted, err := crypto.EncryptToRecipientsWithOptions([]byte("TEST_VAR1=value1\n"), []crypto.Recipient{recipient}, crypto.EncryptOptions{Metadata: metadata})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	if err := os.WriteFile(vaultPath, encrypted, 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	withStdin(t, "personal\nrecovery\n")
+	if err := NewCLI().Run([]string{"slot", "add", "-p", "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(slot add) error = %v", err)
+	}
+
+	// スロットを追加するとファイルが書き換わるため、更新日時だけが新しくなる
+	data, err := os.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatalf("暗号化ファイルの読み込みに失敗しました: %v", err)
+	}
+	updated, err := crypto.ReadMetadata(data)
+	if err != nil || updated == nil {
+		t.Fatalf("ReadMetadata() = %v, %v", updated, err)
+	}
+	if !updated.UpdatedAt.After(past) {
+		t.Errorf("slot add 後の UpdatedAt = %v, want after %v", updated.UpdatedAt, past)
+	}
+	if !updated.CreatedAt.Equal(past) || updated.Creator != "alice" || updated.Environment != "production" {
+		t.Errorf("メタデータが引き継がれていません: %+v", updated)
+	}
+}
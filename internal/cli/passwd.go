@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+	"github.com/uzulla/envault/pkg/secret"
+)
+
+// passwd コマンドを作成
+func (c *CLI) newPasswdCommand() *cobra.Command {
+	var oldPasswordFile, newPasswordFile, newKeyFile string
+
+	passwdCmd := &cobra.Command{
+		Use:     "passwd [オプション]",
+		Aliases: []string{"rekey"},
+		Short:   "暗号化ファイルのパスワードを変更",
+		Long: `平文をファイルに書き出さずに、暗号化ファイルのパスワードを変更します。
+現在のパスワードで開けるスロットだけが新しいパスワードに置き換えられ、他のスロットはそのまま残ります。
+- 対話的に変更: envault passwd
+- stdinから読み込む（1行目が現在、2行目が新しいパスワード）: printf '%s\n%s\n' "$OLD" "$NEW" | envault passwd -p
+- 別々の入力元から読み込む: envault passwd --old-password-file old.txt --new-password-file /dev/fd/3
+- キーファイルを変更: envault passwd --key-file old.key --new-key-file new.key
+--key-file を指定した場合、--new-key-file を省略すると新しいスロットも同じキーファイルを必要とします。`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.runPasswd(oldPasswordFile, newPasswordFile, newKeyFile)
+		},
+	}
+
+	passwdCmd.Flags().StringVar(&oldPasswordFile, "old-password-file", "", "現在のパスワードを読み込むファイル")
+	passwdCmd.Flags().StringVar(&newPasswordFile, "new-password-file", "", "新しいパスワードを読み込むファイル")
+	passwdCmd.Flags().StringVar(&newKeyFile, "new-key-file", "", "新しいスロットで組み合わせるキーファイル（省略時は --key-file と同じ）")
+	c.addKDFFlags(passwdCmd)
+
+	return passwdCmd
+}
+
+func (c *CLI) runPasswd(oldPasswordFile, newPasswordFile, newKeyFilePath string) error {
+	vaultPath := c.vaultedFilePath()
+	data, err := file.ReadVaultedFile(vaultPath)
+	if err != nil {
+		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+
+	if header, err := crypto.ParseHeader(data); err == nil && !header.AcceptsPassword() {
+		return errors.New("このファイルはパスワードでは暗号化されていません")
+	}
+
+	if newKeyFilePath == "" {
+		newKeyFilePath = c.keyFile
+	}
+	oldKeyFile, err := readKeyFile(c.keyFile)
+	if err != nil {
+		return err
+	}
+	newKeyFile, err := readKeyFile(newKeyFilePath)
+	if err != nil {
+		return err
+	}
+	if oldKeyFile == nil && crypto.RequiresKeyFile(data) {
+		return fmt.Errorf("%w（--key-file で指定してください）", crypto.ErrKeyFileRequired)
+	}
+
+	var oldPassword *secret.Buffer
+	if oldPasswordFile != "" {
+		oldPassword, err = c.readPasswordFile(oldPasswordFile)
+	} else {
+		oldPassword, err = c.readPassword("現在のパスワードを入力してください: ")
+	}
+	if err != nil {
+		return err
+	}
+
+	var newPassword *secret.Buffer
+	if newPasswordFile != "" {
+		newPassword, err = c.readPasswordFile(newPasswordFile)
+	} else {
+		newPassword, err = c.readNewPassword("新しいパスワードを入力してください: ")
+	}
+	if err != nil {
+		return err
+	}
+	if newPassword.Len() == 0 && newKeyFile == nil {
+		return errors.New("新しいパスワードが空です")
+	}
+	if newPassword.Equal(oldPassword) && newKeyFilePath == c.keyFile {
+		return errors.New("新しいパスワードが現在のパスワードと同じです")
+	}
+
+	// 現在のパスワードの確認はスロットの置き換えで行う（間違っていれば ErrDecryptionFailed）
+	oldIdentity := newPasswordIdentity(oldPassword, oldKeyFile)
+	updated, err := crypto.ReplacePasswordSlot(data, oldIdentity, newPasswordRecipient(newPassword, newKeyFile, c.kdfOptions))
+	if errors.Is(err, crypto.ErrDecryptionFailed) {
+		return fmt.Errorf("復号化に失敗しました: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("パスワードの変更に失敗しました: %w", err)
+	}
+
+	if err := file.ReplaceVaultedFile(vaultPath, updated); err != nil {
+		return fmt.Errorf("暗号化ファイルの書き込みに失敗しました: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "パスワードを変更しました: %s\n", vaultPath)
+	return nil
+}
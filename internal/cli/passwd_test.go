@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+// テスト用の暗号化ファイルを作成する
+func writeVaultForTest(t *testing.T, path, content, password string) {
+	t.Helper()
+
+	encrypted, err := crypto.Encrypt([]byte(content), password)
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	if err := os.WriteFile(path, encrypted, 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+}
+
+func TestPasswdCommand(t *testing.T) {
+	tempDir := t.TempDir()
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	content := "TEST_VAR1=value1\n"
+	writeVaultForTest(t, vaultPath, content, "oldpassword")
+
+	withStdin(t, "oldpassword\nnewpassword\n")
+	if err := NewCLI().Run([]string{"passwd", "-p", "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(passwd) error = %v", err)
+	}
+
+	data, err := os.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatalf("ファイルの読み込みに失敗しました: %v", err)
+	}
+	if _, err := crypto.Decrypt(data, "oldpassword"); err != crypto.ErrDecryptionFailed {
+		t.Errorf("旧パスワードで復号化できてしまいました: %v", err)
+	}
+	if decrypted, err := crypto.Decrypt(data, "newpassword"); err != nil || string(decrypted) != content {
+		t.Errorf("新しいパスワードで復号化できません: %v", err)
+	}
+}
+
+func TestPasswdCommandWithPasswordFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	oldFile := filepath.Join(tempDir, "old.txt")
+	newFile := filepath.Join(tempDir, "new.txt")
+	writeVaultForTest(t, vaultPath, "TEST_VAR1=value1\n", "oldpassword")
+
+	os.WriteFile(oldFile, []byte("oldpassword\n"), 0600)
+	os.WriteFile(newFile, []byte("newpassword\n"), 0600)
+
+	// 新しいパスワードだけをstdinから読み込む
+	withStdin(t, "newpassword\n")
+	if err := NewCLI().Run([]string{"rekey", "-p", "-f", vaultPath, "--old-password-file", oldFile}); err != nil {
+		t.Fatalf("Run(rekey) error = %v", err)
+	}
+
+	if err := NewCLI().Run([]string{"passwd", "-f", vaultPath, "--old-password-file", oldFile, "--new-password-file", newFile}); err == nil {
+		t.Errorf("間違った現在のパスワードで変更が成功しました")
+	}
+
+	data, _ := os.ReadFile(vaultPath)
+	if _, err := crypto.Decrypt(data, "newpassword"); err != nil {
+		t.Errorf("新しいパスワードで復号化できません: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/uzulla/envault/internal/crypto"
+)
+
+const (
+	// RawKeyEnvName はCI向けの鍵文字列を受け取る環境変数の名前です
+	RawKeyEnvName = "ENVAULT_KEY"
+)
+
+// --key または ENVAULT_KEY で指定された鍵文字列を読み込む（指定がなければ nil）
+func (c *CLI) rawKey() (*crypto.RawKey, error) {
+	s := c.rawKeyString
+	source := "--key"
+	if s == "" {
+		s = os.Getenv(RawKeyEnvName)
+		source = RawKeyEnvName
+	}
+	if s == "" {
+		return nil, nil
+	}
+
+	key, err := crypto.ParseRawKey(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s の鍵文字列を読み取れません: %w", source, err)
+	}
+	return key, nil
+}
+
+// 生成した鍵文字列を表示する
+// 鍵文字列だけを標準出力に書き出し、コマンド置換で受け取れるようにする
+func printGeneratedKey(key *crypto.RawKey) {
+	fmt.Fprintf(os.Stderr, "鍵文字列を生成しました。CIのシークレット（%s）に登録してください。再表示はできません\n", RawKeyEnvName)
+	fmt.Println(key.String())
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uzulla/envault/internal/file"
+)
+
+func TestGenerateKeyAndDecryptWithRawKey(t *testing.T) {
+	tempDir := t.TempDir()
+	envPath := filepath.Join(tempDir, ".env")
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	content := "TEST_VAR1=value1\n"
+
+	if err := os.WriteFile(envPath, []byte(content), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	withStdin(t, "test-password\n")
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"encrypt", envPath, "-p", "--generate-key", "-f", vaultPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(encrypt --generate-key) error = %v", err)
+	}
+	key := strings.TrimSpace(output)
+	if !strings.HasPrefix(key, "envault_key_") {
+		t.Fatalf("標準出力が鍵文字列ではありません: %q", output)
+	}
+
+	// --key で復号化
+	output, err = captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-f", vaultPath, "--key", key})
+	})
+	if err != nil {
+		t.Fatalf("Run(dump --key) error = %v", err)
+	}
+	if output != content {
+		t.Errorf("Run(dump --key) = %q, want %q", output, content)
+	}
+
+	// ENVAULT_KEY で復号化
+	t.Setenv(RawKeyEnvName, key)
+	output, err = captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-f", vaultPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(dump) with %s error = %v", RawKeyEnvName, err)
+	}
+	if output != content {
+		t.Errorf("Run(dump) with %s = %q, want %q", RawKeyEnvName, output, content)
+	}
+
+	// パスワードでも引き続き復号化できること
+	t.Setenv(RawKeyEnvName, "")
+	withStdin(t, "test-password\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-p", "-f", vaultPath})
+	}); err != nil {
+		t.Errorf("Run(dump -p) error = %v", err)
+	}
+
+	wrongKey := key[:len(key)-1] + "A"
+	if strings.HasSuffix(key, "A") {
+		wrongKey = key[:len(key)-1] + "B"
+	}
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-f", vaultPath, "--key", wrongKey})
+	}); err == nil {
+		t.Errorf("誤った鍵文字列で復号化できてしまいました")
+	}
+}
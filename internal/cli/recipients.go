@@ -0,0 +1,323 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+const (
+	// RecipientsFileName はリポジトリで管理する受信者ファイルの名前です
+	RecipientsFileName = ".envault-recipients"
+)
+
+// recipients コマンドとサブコマンドを作成
+func (c *CLI) newRecipientsCommand() *cobra.Command {
+	var recipientsFile string
+
+	recipientsCmd := &cobra.Command{
+		Use:   "recipients",
+		Short: "公開鍵で暗号化されたファイルの受信者を管理",
+		Long: `公開鍵で暗号化された .env.vaulted ファイルの受信者を追加・削除・一覧表示します。
+受信者は暗号化ファイルと同じディレクトリの .envault-recipients ファイルにも記録されます。
+このファイルはチームの受信者のリストとして扱われ、受信者を指定せずに encrypt を実行すると
+このファイルの受信者で暗号化します。list ではファイルと暗号化ファイルの受信者の差分を表示します。
+- 受信者の追加: envault recipients add envault-pub-... --label alice
+- 受信者の削除: envault recipients remove <公開鍵またはフィンガープリント>
+- 受信者の一覧: envault recipients list`,
+	}
+	recipientsCmd.PersistentFlags().StringVar(&recipientsFile, "recipients-file", "", "受信者ファイルのパス（省略時は暗号化ファイルと同じディレクトリの.envault-recipients）")
+
+	addCmd := &cobra.Command{
+		Use:   "add [オプション] <公開鍵>...",
+		Short: "受信者を追加",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			label, _ := cmd.Flags().GetString("label")
+			return c.runRecipientsAdd(recipientsFile, args, label)
+		},
+	}
+	addCmd.Flags().String("label", "", "受信者ファイルに記録するラベル（名前やメールアドレスなど）")
+	recipientsCmd.AddCommand(addCmd)
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <公開鍵またはフィンガープリント>...",
+		Short: "受信者を削除し、新しいデータ鍵で再暗号化",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.runRecipientsRemove(recipientsFile, args)
+		},
+	}
+	recipientsCmd.AddCommand(removeCmd)
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "受信者のフィンガープリントとラベルを表示",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.runRecipientsList(recipientsFile)
+		},
+	}
+	recipientsCmd.AddCommand(listCmd)
+
+	return recipientsCmd
+}
+
+// 操作対象の暗号化ファイルのパスを返す
+func (c *CLI) vaultedFilePath() string {
+	if c.vaultedFile == "" {
+		return file.DefaultVaultedFileName
+	}
+	return c.vaultedFile
+}
+
+// 受信者ファイルのパスを返す（指定がなければ暗号化ファイルと同じディレクトリ）
+func (c *CLI) recipientsFilePath(recipientsFile string) string {
+	if recipientsFile != "" {
+		return recipientsFile
+	}
+	return filepath.Join(filepath.Dir(c.vaultedFilePath()), RecipientsFileName)
+}
+
+func (c *CLI) runRecipientsAdd(recipientsFile string, publicKeys []string, label string) error {
+	vaultPath := c.vaultedFilePath()
+	data, err := file.ReadVaultedFile(vaultPath)
+	if err != nil {
+		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+
+	// age1... で指定された公開鍵も、スロットと同じ envault-pub-... の形式で受信者ファイルに記録する
+	var recipients []crypto.Recipient
+	var canonical []string
+	for _, publicKey := range publicKeys {
+		r, err := crypto.ParseX25519Recipient(publicKey)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, r)
+		canonical = append(canonical, r.String())
+	}
+
+	identities, err := c.unlockIdentities(data, "復号化用パスワードを入力してください: ")
+	if err != nil {
+		return err
+	}
+
+	updated, err := crypto.AddRecipients(data, identities, recipients)
+	if err != nil {
+		return fmt.Errorf("受信者の追加に失敗しました: %w", err)
+	}
+
+	if err := file.ReplaceVaultedFile(vaultPath, updated); err != nil {
+		return fmt.Errorf("暗号化ファイルの書き込みに失敗しました: %w", err)
+	}
+
+	listPath := c.recipientsFilePath(recipientsFile)
+	for _, publicKey := range canonical {
+		if err := appendRecipientEntry(listPath, publicKey, label); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "受信者を追加しました: %s\n", crypto.Fingerprint(publicKey))
+	}
+	return nil
+}
+
+func (c *CLI) runRecipientsRemove(recipientsFile string, keys []string) error {
+	vaultPath := c.vaultedFilePath()
+	// 公開鍵は age1... で指定されていても envault-pub-... の形式で照合する
+	canonical := make([]string, len(keys))
+	for i, key := range keys {
+		canonical[i] = crypto.CanonicalRecipient(key)
+	}
+	keys = canonical
+
+	data, err := file.ReadVaultedFile(vaultPath)
+	if err != nil {
+		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+
+	identities, err := c.unlockIdentities(data, "復号化用パスワードを入力してください: ")
+	if err != nil {
+		return err
+	}
+
+	updated, err := crypto.RemoveRecipients(data, identities, keys)
+	if err != nil {
+		return fmt.Errorf("受信者の削除に失敗しました: %w", err)
+	}
+
+	if err := file.ReplaceVaultedFile(vaultPath, updated); err != nil {
+		return fmt.Errorf("暗号化ファイルの書き込みに失敗しました: %w", err)
+	}
+
+	if err := removeRecipientEntries(c.recipientsFilePath(recipientsFile), keys); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d件の受信者を削除し、新しいデータ鍵で再暗号化しました\n", len(keys))
+	return nil
+}
+
+func (c *CLI) runRecipientsList(recipientsFile string) error {
+	data, err := file.ReadVaultedFile(c.vaultedFilePath())
+	if err != nil {
+		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+
+	header, err := crypto.ParseHeader(data)
+	if err != nil {
+		return err
+	}
+
+	listPath := c.recipientsFilePath(recipientsFile)
+	_, statErr := os.Stat(listPath)
+	hasList := statErr == nil
+	entries, err := readRecipientEntries(listPath)
+	if err != nil {
+		return err
+	}
+	labels := make(map[string]string)
+	for _, e := range entries {
+		labels[e.PublicKey] = e.Label
+	}
+
+	drift := 0
+	inVault := make(map[string]bool)
+	for _, slot := range header.Slots {
+		if slot.Recipient == "" {
+			continue
+		}
+		inVault[slot.Recipient] = true
+		note := ""
+		// 受信者ファイルに記録できる公開鍵（envault-pub-...）が記録されていない
+		if _, isListed := labels[slot.Recipient]; hasList && !isListed && strings.HasPrefix(slot.Recipient, crypto.X25519PublicKeyPrefix) {
+			note = " (受信者ファイルに未記録)"
+			drift++
+		}
+		fmt.Printf("%s  %-20s  %s%s\n", slot.Fingerprint(), labels[slot.Recipient], slot.Recipient, note)
+	}
+
+	// 受信者ファイルにあるが暗号化ファイルに反映されていない受信者
+	for _, e := range entries {
+		if !inVault[e.PublicKey] {
+			fmt.Printf("%s  %-20s  %s (未反映)\n", crypto.Fingerprint(e.PublicKey), e.Label, e.PublicKey)
+			drift++
+		}
+	}
+
+	if drift > 0 {
+		fmt.Fprintf(os.Stderr, "警告: 受信者ファイル %s と暗号化ファイルの受信者が%d件一致しません（recipients add / remove で反映するか、envault encrypt で暗号化し直してください）\n", listPath, drift)
+	}
+	return nil
+}
+
+// --identity と --ssh-identity で指定された秘密鍵を読み込む
+// どちらも指定がなければデフォルトの秘密鍵ファイルを使用する
+func (c *CLI) resolveIdentities() ([]crypto.Identity, error) {
+	identityFiles := c.identities
+	if len(identityFiles) == 0 && len(c.sshIdentities) == 0 {
+		identityFiles = []string{DefaultIdentityPath()}
+	}
+
+	identities, err := loadIdentities(identityFiles)
+	if err != nil {
+		return nil, err
+	}
+	sshIdentities, err := c.loadSSHIdentities(c.sshIdentities)
+	if err != nil {
+		return nil, err
+	}
+	return append(identities, sshIdentities...), nil
+}
+
+// 受信者ファイルを読み込む（存在しない場合は空）
+func readRecipientEntries(path string) ([]crypto.RecipientEntry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("受信者ファイルの読み込みに失敗しました: %w", err)
+	}
+
+	entries, err := crypto.ParseRecipientEntries(data)
+	if err != nil {
+		return nil, fmt.Errorf("受信者ファイル %s の解析に失敗しました: %w", path, err)
+	}
+	return entries, nil
+}
+
+// 受信者ファイルに受信者を追記する（既に記録されている場合は何もしない）
+func appendRecipientEntry(path, publicKey, label string) error {
+	entries, err := readRecipientEntries(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.PublicKey == publicKey {
+			return nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("受信者ファイルの読み込みに失敗しました: %w", err)
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+
+	line := publicKey
+	if label != "" {
+		line += " " + label
+	}
+	data = append(data, line+"\n"...)
+
+	if err := file.WriteFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("受信者ファイルの書き込みに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// 受信者ファイルから指定した受信者（公開鍵またはフィンガープリント）の行を削除する
+// コメントや空行はそのまま残す
+func removeRecipientEntries(path string, keys []string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("受信者ファイルの読み込みに失敗しました: %w", err)
+	}
+
+	var kept []string
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && !strings.HasPrefix(fields[0], "#") && matchesRecipientKey(fields[0], keys) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	if err := file.WriteFileAtomic(path, []byte(strings.Join(kept, "")), 0644); err != nil {
+		return fmt.Errorf("受信者ファイルの書き込みに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// 公開鍵が指定された公開鍵またはフィンガープリントのいずれかに一致するか
+// 受信者ファイルに age1... で書かれた行も envault-pub-... の形式で照合する
+func matchesRecipientKey(publicKey string, keys []string) bool {
+	publicKey = crypto.CanonicalRecipient(publicKey)
+	for _, key := range keys {
+		if publicKey == key || crypto.Fingerprint(publicKey) == key {
+			return true
+		}
+	}
+	return false
+}
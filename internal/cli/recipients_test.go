@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+// テスト用の秘密鍵ファイルを作成し、秘密鍵を返す
+func writeIdentityForTest(t *testing.T, path string) *crypto.X25519Identity {
+	t.Helper()
+
+	id, err := crypto.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("鍵の生成に失敗しました: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(id.String()+"\n"), 0600); err != nil {
+		t.Fatalf("秘密鍵ファイルの作成に失敗しました: %v", err)
+	}
+	return id
+}
+
+func TestRecipientsCommands(t *testing.T) {
+	tempDir := t.TempDir()
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	listPath := filepath.Join(tempDir, RecipientsFileName)
+	aliceKey := filepath.Join(tempDir, "alice.txt")
+	bobKey := filepath.Join(tempDir, "bob.txt")
+	alice := writeIdentityForTest(t, aliceKey)
+	bob := writeIdentityForTest(t, bobKey)
+
+	encrypted, err := crypto.EncryptToRecipients([]byte("TEST_VAR1=value1\n"), []crypto.Recipient{alice.Recipient()})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	if err := os.WriteFile(vaultPath, encrypted, 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+	if err := os.WriteFile(listPath, []byte("# チームの公開鍵\n"+alice.Recipient().String()+" alice\n"), 0644); err != nil {
+		t.Fatalf("受信者ファイルの作成に失敗しました: %v", err)
+	}
+
+	bobPublicKey := bob.Recipient().String()
+	if err := NewCLI().Run([]string{"recipients", "add", bobPublicKey, "--label", "bob", "-f", vaultPath, "-i", aliceKey}); err != nil {
+		t.Fatalf("Run(recipients add) error = %v", err)
+	}
+
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-f", vaultPath, "-i", bobKey})
+	}); err != nil {
+		t.Errorf("追加した受信者で復号化できません: %v", err)
+	}
+
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"recipients", "list", "-f", vaultPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(recipients list) error = %v", err)
+	}
+	for _, want := range []string{crypto.Fingerprint(bobPublicKey), "alice", "bob"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Run(recipients list) の出力に %q が含まれていません: %s", want, output)
+		}
+	}
+
+	if err := NewCLI().Run([]string{"recipients", "remove", crypto.Fingerprint(bobPublicKey), "-f", vaultPath, "-i", aliceKey}); err != nil {
+		t.Fatalf("Run(recipients remove) error = %v", err)
+	}
+
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-f", vaultPath, "-i", bobKey})
+	}); err == nil {
+		t.Errorf("削除した受信者で復号化できてしまいました")
+	}
+
+	listData, err := os.ReadFile(listPath)
+	if err != nil {
+		t.Fatalf("受信者ファイルの読み込みに失敗しました: %v", err)
+	}
+	if strings.Contains(string(listData), bobPublicKey) {
+		t.Errorf("受信者ファイルから削除されていません: %s", listData)
+	}
+	if !strings.Contains(string(listData), "# チームの公開鍵") {
+		t.Errorf("受信者ファイルのコメントが失われました: %s", listData)
+	}
+}
+
+// age1... で指定した公開鍵も envault-pub-... の形式で記録し、同じ age1... で削除できる
+func TestRecipientsAgePublicKey(t *testing.T) {
+	tempDir := t.TempDir()
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	listPath := filepath.Join(tempDir, RecipientsFileName)
+	aliceKey := filepath.Join(tempDir, "alice.txt")
+	bobKey := filepath.Join(tempDir, "bob.txt")
+	alice := writeIdentityForTest(t, aliceKey)
+	bob := writeIdentityForTest(t, bobKey)
+
+	encrypted, err := crypto.EncryptToRecipients([]byte("TEST_VAR1=value1\n"), []crypto.Recipient{alice.Recipient()})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	if err := os.WriteFile(vaultPath, encrypted, 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	bobAgeKey := bob.Recipient().AgeString()
+	bobPublicKey := bob.Recipient().String()
+	if err := NewCLI().Run([]string{"recipients", "add", bobAgeKey, "--label", "bob", "-f", vaultPath, "-i", aliceKey}); err != nil {
+		t.Fatalf("Run(recipients add) error = %v", err)
+	}
+
+	listData, err := os.ReadFile(listPath)
+	if err != nil {
+		t.Fatalf("受信者ファイルの読み込みに失敗しました: %v", err)
+	}
+	if string(listData) != bobPublicKey+" bob\n" {
+		t.Errorf("受信者ファイル = %q, want %q", listData, bobPublicKey+" bob\n")
+	}
+
+	// ラベルがスロットに対応付けられ、未反映と表示されないこと
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"recipients", "list", "-f", vaultPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(recipients list) error = %v", err)
+	}
+	want := crypto.Fingerprint(bobPublicKey) + "  bob"
+	if !strings.Contains(output, want) || strings.Contains(output, "未反映") {
+		t.Errorf("Run(recipients list) の出力に %q が含まれていないか、未反映の受信者があります: %s", want, output)
+	}
+
+	if err := NewCLI().Run([]string{"recipients", "remove", bobAgeKey, "-f", vaultPath, "-i", aliceKey}); err != nil {
+		t.Fatalf("Run(recipients remove) error = %v", err)
+	}
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-f", vaultPath, "-i", bobKey})
+	}); err == nil {
+		t.Errorf("削除した受信者で復号化できてしまいました")
+	}
+	listData, err = os.ReadFile(listPath)
+	if err != nil {
+		t.Fatalf("受信者ファイルの読み込みに失敗しました: %v", err)
+	}
+	if len(listData) != 0 {
+		t.Errorf("受信者ファイルから削除されていません: %q", listData)
+	}
+}
+
+// 受信者を指定せずに暗号化すると .envault-recipients の受信者を使用し、list で差分を警告する
+func TestEncryptUsesRecipientsFile(t *testing.T) {
+	tempDir := t.TempDir()
+	envPath := filepath.Join(tempDir, ".env")
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	listPath := filepath.Join(tempDir, RecipientsFileName)
+	aliceKey := filepath.Join(tempDir, "alice.txt")
+	alice := writeIdentityForTest(t, aliceKey)
+	bob := writeIdentityForTest(t, filepath.Join(tempDir, "bob.txt"))
+
+	if err := os.WriteFile(envPath, []byte("TEST_VAR1=value1\n"), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+	if err := os.WriteFile(listPath, []byte(alice.Recipient().AgeString()+" alice\n"), 0644); err != nil {
+		t.Fatalf("受信者ファイルの作成に失敗しました: %v", err)
+	}
+
+	// パスワードを入力させずに受信者ファイルの受信者で暗号化する
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"encrypt", envPath, "-f", vaultPath})
+	}); err != nil {
+		t.Fatalf("Run(encrypt) error = %v", err)
+	}
+	if output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-f", vaultPath, "-i", aliceKey})
+	}); err != nil || output != "TEST_VAR1=value1\n" {
+		t.Errorf("受信者ファイルの受信者で復号化できません: %q, %v", output, err)
+	}
+
+	listRecipients := func() (string, string) {
+		t.Helper()
+		var stdout string
+		stderr, err := captureStderr(t, func() error {
+			var err error
+			stdout, err = captureOutput(func() error {
+				return NewCLI().Run([]string{"recipients", "list", "-f", vaultPath})
+			})
+			return err
+		})
+		if err != nil {
+			t.Fatalf("Run(recipients list) error = %v", err)
+		}
+		return stdout, stderr
+	}
+	if stdout, stderr := listRecipients(); !strings.Contains(stdout, "alice") || stderr != "" {
+		t.Errorf("Run(recipients list) = %q, 標準エラー出力 = %q", stdout, stderr)
+	}
+
+	// 受信者ファイルだけを変更すると差分を警告する
+	if err := os.WriteFile(listPath, []byte(bob.Recipient().String()+" bob\n"), 0644); err != nil {
+		t.Fatalf("受信者ファイルの更新に失敗しました: %v", err)
+	}
+	stdout, stderr := listRecipients()
+	if !strings.Contains(stdout, "bob") || !strings.Contains(stdout, "(未反映)") || !strings.Contains(stdout, "(受信者ファイルに未記録)") {
+		t.Errorf("Run(recipients list) の出力に差分が表示されていません: %s", stdout)
+	}
+	if !strings.Contains(stderr, "警告:") || !strings.Contains(stderr, "2件") {
+		t.Errorf("Run(recipients list) で差分が警告されていません: %q", stderr)
+	}
+
+	// --no-recipients-file ではパスワードで暗号化する
+	passwordVault := filepath.Join(tempDir, "password.vaulted")
+	withStdin(t, "password\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"encrypt", envPath, "-p", "--no-recipients-file", "-f", passwordVault})
+	}); err != nil {
+		t.Fatalf("Run(encrypt --no-recipients-file) error = %v", err)
+	}
+	data, err := os.ReadFile(passwordVault)
+	if err != nil {
+		t.Fatalf("暗号化ファイルの読み込みに失敗しました: %v", err)
+	}
+	if _, err := crypto.Decrypt(data, "password"); err != nil {
+		t.Errorf("--no-recipients-file で作成したファイルをパスワードで復号化できません: %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+	"github.com/uzulla/envault/pkg/secret"
+	"github.com/uzulla/envault/pkg/utils"
+	"golang.org/x/term"
+)
+
+// recovery コマンドとサブコマンドを作成
+func (c *CLI) newRecoveryCommand() *cobra.Command {
+	recoveryCmd := &cobra.Command{
+		Use:   "recovery",
+		Short: "パスワードを忘れたときのための復旧用の分割片を管理",
+		Long: `暗号化ファイルのデータ鍵を復旧用の分割片に分け、必要数の分割片から新しいパスワードを設定します。
+分割と復元はすべてこのマシン上で行われ、ネットワークには接続しません。
+- 5個に分割し、3個で復元できるようにする: envault recovery split --shares 5 --threshold 3
+- 分割片から復元して新しいパスワードを設定: envault recovery combine`,
+	}
+
+	var total, threshold int
+	var outputDir string
+	splitCmd := &cobra.Command{
+		Use:   "split [オプション]",
+		Short: "データ鍵を印刷用の分割片に分ける",
+		Long: `暗号化ファイルのデータ鍵をシャミアの秘密分散で分割し、印刷できる形式で出力します。
+各分割片にはチェックサムが含まれ、入力の誤りを検出できます。分割片は別々の人・場所に保管してください。
+必要数の分割片が揃うとファイルを復号化できるため、分割片はパスワードと同様に扱ってください。
+データ鍵が変わる操作（再暗号化や recipients remove）を行った場合は、分割し直す必要があります。`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.runRecoverySplit(total, threshold, outputDir)
+		},
+	}
+	splitCmd.Flags().IntVar(&total, "shares", 5, "分割片の数")
+	splitCmd.Flags().IntVar(&threshold, "threshold", 3, "復元に必要な分割片の数")
+	splitCmd.Flags().StringVarP(&outputDir, "output-dir", "o", "", "分割片を1個ずつファイルに保存するディレクトリ（省略時は標準出力）")
+	recoveryCmd.AddCommand(splitCmd)
+
+	var newPasswordFile string
+	combineCmd := &cobra.Command{
+		Use:   "combine [オプション] [分割片ファイル...]",
+		Short: "分割片からデータ鍵を復元し、新しいパスワードを設定",
+		Long: `必要数の分割片からデータ鍵を復元し、新しいパスワードのスロットを追加します。
+分割片ファイルを指定しない場合は、標準入力から1行に1個ずつ読み込みます（空白やハイフンの位置、大文字・小文字は問いません）。
+既存のスロットはそのまま残るため、忘れたパスワードのスロットは envault slot remove で削除してください。`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.runRecoveryCombine(args, newPasswordFile)
+		},
+	}
+	combineCmd.Flags().StringVar(&newPasswordFile, "new-password-file", "", "新しいパスワードを読み込むファイル")
+	recoveryCmd.AddCommand(combineCmd)
+
+	return recoveryCmd
+}
+
+func (c *CLI) runRecoverySplit(total, threshold int, outputDir string) error {
+	vaultPath := c.vaultedFilePath()
+	data, err := file.ReadVaultedFile(vaultPath)
+	if err != nil {
+		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+
+	identities, err := c.unlockIdentities(data, "復号化用パスワードを入力してください: ")
+	if err != nil {
+		return err
+	}
+	shares, err := crypto.SplitRecoveryShares(data, identities, total, threshold)
+	if err != nil {
+		return fmt.Errorf("分割片の作成に失敗しました: %w", err)
+	}
+
+	createdAt := time.Now().Format(time.RFC3339)
+	if outputDir == "" {
+		for i, share := range shares {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Print(formatRecoveryShare(share, vaultPath, createdAt))
+		}
+	} else {
+		if err := os.MkdirAll(outputDir, 0700); err != nil {
+			return fmt.Errorf("ディレクトリの作成に失敗しました: %w", err)
+		}
+		for _, share := range shares {
+			path := filepath.Join(outputDir, fmt.Sprintf("envault-recovery-%s-%d.txt", share.SetIDString(), share.Index))
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("ファイル '%s' は既に存在します", path)
+			}
+			if err := file.WriteFileAtomic(path, []byte(formatRecoveryShare(share, vaultPath, createdAt)), 0600); err != nil {
+				return fmt.Errorf("分割片の書き込みに失敗しました: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "分割片を保存しました: %s\n", path)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d個の分割片を作成しました（%d個で復元できます）。分割片は別々の人・場所に保管してください\n", total, threshold)
+	return nil
+}
+
+// 分割片を印刷用のテキストにする
+func formatRecoveryShare(share *crypto.RecoveryShare, vaultPath, createdAt string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# envault 復旧用の分割片 %d/%d（復元には%d個必要です）\n", share.Index, share.Total, share.Threshold)
+	fmt.Fprintf(&b, "# ファイル: %s\n", vaultPath)
+	fmt.Fprintf(&b, "# 分割ID: %s\n", share.SetIDString())
+	fmt.Fprintf(&b, "# 作成日時: %s\n", createdAt)
+	fmt.Fprintf(&b, "# 復元: envault recovery combine -f %s\n", vaultPath)
+	fmt.Fprintf(&b, "%s\n", share)
+	return b.String()
+}
+
+func (c *CLI) runRecoveryCombine(shareFiles []string, newPasswordFile string) error {
+	vaultPath := c.vaultedFilePath()
+	data, err := file.ReadVaultedFile(vaultPath)
+	if err != nil {
+		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+
+	var shares []*crypto.RecoveryShare
+	if len(shareFiles) > 0 {
+		shares, err = readRecoveryShareFiles(shareFiles)
+	} else {
+		shares, err = readRecoverySharesFromStdin(term.IsTerminal(int(os.Stdin.Fd())))
+	}
+	if err != nil {
+		return err
+	}
+
+	identity, err := crypto.CombineRecoveryShares(shares)
+	if err != nil {
+		return fmt.Errorf("データ鍵の復元に失敗しました: %w", err)
+	}
+	defer identity.Destroy()
+
+	// 新しいパスワードを入力させる前に、復元した鍵でファイルを開けることを確認する
+	if _, err := crypto.DecryptWithIdentities(data, []crypto.Identity{identity}); err != nil {
+		if errors.Is(err, crypto.ErrDecryptionFailed) {
+			return errors.New("復元した鍵ではこのファイルを開けません（別のファイルの分割片か、分割した後にデータ鍵が変更されています）")
+		}
+		return fmt.Errorf("復号化に失敗しました: %w", err)
+	}
+
+	keyFile, err := readKeyFile(c.keyFile)
+	if err != nil {
+		return err
+	}
+	var newPassword *secret.Buffer
+	if newPasswordFile != "" {
+		newPassword, err = c.readPasswordFile(newPasswordFile)
+	} else {
+		newPassword, err = c.readNewPassword("新しいパスワードを入力してください: ")
+	}
+	if err != nil {
+		return err
+	}
+	if newPassword.Len() == 0 && keyFile == nil {
+		return errors.New("新しいパスワードが空です")
+	}
+
+	updated, err := crypto.AddRecipients(data, []crypto.Identity{identity}, []crypto.Recipient{newPasswordRecipient(newPassword, keyFile, c.kdfOptions)})
+	if err != nil {
+		return fmt.Errorf("パスワードの設定に失敗しました: %w", err)
+	}
+	if err := file.ReplaceVaultedFile(vaultPath, updated); err != nil {
+		return fmt.Errorf("暗号化ファイルの書き込みに失敗しました: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "新しいパスワードのスロットを追加しました: %s\n", vaultPath)
+	fmt.Fprintln(os.Stderr, "忘れたパスワードのスロットは envault slot list で確認し、envault slot remove で削除してください")
+	return nil
+}
+
+// 分割片ファイルを読み込む（1つのファイルに複数の分割片があってもよい）
+// 空行と「#」で始まる行は無視する
+func readRecoveryShareFiles(paths []string) ([]*crypto.RecoveryShare, error) {
+	var shares []*crypto.RecoveryShare
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("分割片ファイルの読み込みに失敗しました: %w", err)
+		}
+		for i, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			share, err := crypto.ParseRecoveryShare(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s の%d行目: %w", path, i+1, err)
+			}
+			shares = append(shares, share)
+		}
+	}
+	return shares, nil
+}
+
+// 標準入力から必要数の分割片を読み込む
+// 必要数は最初の分割片から分かるため、揃った時点で読み込みをやめる（続く行は新しいパスワードとして読み込める）
+// 端末から入力している場合は、読み取れない分割片を入力し直せるようにする
+func readRecoverySharesFromStdin(interactive bool) ([]*crypto.RecoveryShare, error) {
+	var shares []*crypto.RecoveryShare
+	seen := make(map[int]bool)
+	for len(shares) == 0 || len(shares) < shares[0].Threshold {
+		if interactive {
+			if len(shares) == 0 {
+				fmt.Fprint(os.Stderr, "分割片を入力してください: ")
+			} else {
+				fmt.Fprintf(os.Stderr, "分割片を入力してください (%d/%d): ", len(shares)+1, shares[0].Threshold)
+			}
+		}
+
+		line, err := utils.ReadLineFromStdin()
+		if err == io.EOF {
+			if len(shares) == 0 {
+				return nil, crypto.ErrNotEnoughShares
+			}
+			return nil, fmt.Errorf("%w: %d個のうち%d個が必要です", crypto.ErrNotEnoughShares, len(shares), shares[0].Threshold)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("分割片の読み込みに失敗しました: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		share, err := crypto.ParseRecoveryShare(line)
+		if err != nil {
+			if interactive {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				continue
+			}
+			return nil, err
+		}
+		if seen[share.Index] {
+			fmt.Fprintf(os.Stderr, "分割片 %d は入力済みです\n", share.Index)
+			continue
+		}
+		seen[share.Index] = true
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+func TestRecoveryCommands(t *testing.T) {
+	tempDir := t.TempDir()
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	sharesDir := filepath.Join(tempDir, "shares")
+
+	encrypted, err := crypto.Encrypt([]byte("TEST_VAR1=value1\n"), "forgotten-password")
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	if err := os.WriteFile(vaultPath, encrypted, 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	withStdin(t, "forgotten-password\n")
+	if err := NewCLI().Run([]string{"recovery", "split", "-p", "--shares", "5", "--threshold", "3", "-o", sharesDir, "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(recovery split) error = %v", err)
+	}
+	shareFiles, _ := filepath.Glob(filepath.Join(sharesDir, "envault-recovery-*.txt"))
+	if len(shareFiles) != 5 {
+		t.Fatalf("分割片ファイルの数 = %d, want 5", len(shareFiles))
+	}
+	if info, err := os.Stat(shareFiles[0]); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("分割片ファイルの権限 = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	// 必要数に満たない場合
+	withStdin(t, "new-password\n")
+	if err := NewCLI().Run([]string{"recovery", "combine", "-p", "-f", vaultPath, shareFiles[0], shareFiles[1]}); err == nil {
+		t.Error("2個の分割片で復元できてしまいました")
+	}
+
+	withStdin(t, "new-password\n")
+	if err := NewCLI().Run([]string{"recovery", "combine", "-p", "-f", vaultPath, shareFiles[0], shareFiles[2], shareFiles[4]}); err != nil {
+		t.Fatalf("Run(recovery combine) error = %v", err)
+	}
+
+	withStdin(t, "new-password\n")
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-p", "-f", vaultPath})
+	})
+	if err != nil || !strings.Contains(output, "TEST_VAR1=value1") {
+		t.Errorf("新しいパスワードで dump = %q, %v", output, err)
+	}
+
+	// 標準出力に印刷した分割片を、標準入力から1行ずつ入力して復元する
+	withStdin(t, "new-password\n")
+	output, err = captureOutput(func() error {
+		return NewCLI().Run([]string{"recovery", "split", "-p", "--shares", "3", "--threshold", "2", "-f", vaultPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(recovery split) error = %v", err)
+	}
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, crypto.RecoverySharePrefix) {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 3 {
+		t.Fatalf("印刷した分割片の数 = %d, want 3\n%s", len(lines), output)
+	}
+
+	input := strings.ToLower(lines[2]) + "\n\n" + lines[0] + "\n" + "third-password\n"
+	withStdin(t, input)
+	if err := NewCLI().Run([]string{"recovery", "combine", "-p", "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(recovery combine) error = %v", err)
+	}
+	withStdin(t, "third-password\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-p", "-f", vaultPath})
+	}); err != nil {
+		t.Errorf("標準入力から復元したパスワードで dump error = %v", err)
+	}
+
+	// 入力ミスのある分割片はチェックサムで検出する
+	typo := []byte(lines[1])
+	i := len(crypto.RecoverySharePrefix) + 20
+	if typo[i] == 'Q' {
+		typo[i] = 'R'
+	} else {
+		typo[i] = 'Q'
+	}
+	withStdin(t, string(typo)+"\n"+lines[0]+"\n")
+	if err := NewCLI().Run([]string{"recovery", "combine", "-p", "-f", vaultPath}); err == nil || !strings.Contains(err.Error(), "チェックサム") {
+		t.Errorf("入力ミスのある分割片で error = %v, want チェックサムのエラー", err)
+	}
+}
@@ -0,0 +1,465 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+const (
+	// SignersFileName はリポジトリで管理する信頼された署名者ファイルの名前です
+	SignersFileName = ".envault-signers"
+	// SignatureFileSuffix は分離署名ファイルの拡張子です（.env.vaulted.sig）
+	SignatureFileSuffix = ".sig"
+
+	// --require-signature の動作
+	RequireSignatureError = "error"
+	RequireSignatureWarn  = "warn"
+)
+
+// sign コマンドを作成
+func (c *CLI) newSignCommand() *cobra.Command {
+	var keyPath string
+	var embed bool
+
+	signCmd := &cobra.Command{
+		Use:   "sign [オプション]",
+		Short: "暗号化ファイルにEd25519で署名",
+		Long: `暗号化ファイルにEd25519の署名を付けます。署名鍵は envault keygen --signing で生成します。
+署名は .env.vaulted.sig（分離署名）に書き込まれ、--embed を指定すると暗号化ファイルの末尾に埋め込まれます。
+同じ署名者の古い署名と、ファイルの変更によって一致しなくなった署名は置き換えられます。
+- 分離署名: envault sign --signing-key ~/.config/envault/signer.key
+- 埋め込み署名: envault sign --signing-key ~/.config/envault/signer.key --embed`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.runSign(keyPath, embed)
+		},
+	}
+	// ルートの --key（復号化用の鍵文字列）と区別するため、署名鍵ファイルは --signing-key で指定する
+	signCmd.Flags().StringVar(&keyPath, "signing-key", "", "署名鍵ファイル（ENVAULT-SIGN-SECRET-KEY-...）")
+	signCmd.Flags().BoolVar(&embed, "embed", false, "署名を暗号化ファイルの末尾に埋め込む")
+	signCmd.Flags().StringVar(&c.signatureFile, "signature-file", "", "分離署名ファイルのパス（省略時は <暗号化ファイル>.sig）")
+	_ = signCmd.MarkFlagRequired("signing-key")
+	return signCmd
+}
+
+// verify コマンドを作成
+func (c *CLI) newVerifyCommand() *cobra.Command {
+	verifyCmd := &cobra.Command{
+		Use:   "verify [オプション]",
+		Short: "暗号化ファイルの署名を検証",
+		Long: `暗号化ファイルの埋め込み署名と分離署名（.env.vaulted.sig）を検証し、
+信頼された署名者（.envault-signers）による正しい署名があるかを確認します。復号化は行いません。`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.runVerify()
+		},
+	}
+	verifyCmd.Flags().StringVar(&c.signersFile, "signers-file", "", "信頼された署名者ファイルのパス（省略時は暗号化ファイルと同じディレクトリの.envault-signers）")
+	verifyCmd.Flags().StringVar(&c.signatureFile, "signature-file", "", "分離署名ファイルのパス（省略時は <暗号化ファイル>.sig）")
+	return verifyCmd
+}
+
+// signers コマンドとサブコマンドを作成
+func (c *CLI) newSignersCommand() *cobra.Command {
+	signersCmd := &cobra.Command{
+		Use:   "signers",
+		Short: "信頼された署名者を管理",
+		Long: `信頼された署名者の公開鍵を追加・削除・一覧表示します。
+署名者は暗号化ファイルと同じディレクトリの .envault-signers ファイルに記録されます。
+- 署名者の追加: envault signers add envault-sign-pub-... --label alice
+- 署名者の削除: envault signers remove <公開鍵またはフィンガープリント>
+- 署名者の一覧: envault signers list`,
+	}
+	signersCmd.PersistentFlags().StringVar(&c.signersFile, "signers-file", "", "信頼された署名者ファイルのパス（省略時は暗号化ファイルと同じディレクトリの.envault-signers）")
+
+	addCmd := &cobra.Command{
+		Use:   "add [オプション] <公開鍵>...",
+		Short: "署名者を追加",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			label, _ := cmd.Flags().GetString("label")
+			return c.runSignersAdd(args, label)
+		},
+	}
+	addCmd.Flags().String("label", "", "署名者ファイルに記録するラベル（名前やメールアドレスなど）")
+	signersCmd.AddCommand(addCmd)
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <公開鍵またはフィンガープリント>...",
+		Short: "署名者を削除",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.runSignersRemove(args)
+		},
+	}
+	signersCmd.AddCommand(removeCmd)
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "署名者のフィンガープリントとラベルを表示",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.runSignersList()
+		},
+	}
+	signersCmd.AddCommand(listCmd)
+
+	return signersCmd
+}
+
+// 復号化の前に署名を確認するフラグを追加
+// export では select サブコマンドにも引き継ぐため、永続フラグとして追加する
+func (c *CLI) addSignatureFlags(cmd *cobra.Command) {
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&c.requireSigned, "require-signature", "", "信頼された署名者の署名がないファイルの復号化を拒否する（=warn で警告のみ）")
+	flags.Lookup("require-signature").NoOptDefVal = RequireSignatureError
+	flags.StringVar(&c.signersFile, "signers-file", "", "信頼された署名者ファイルのパス（省略時は暗号化ファイルと同じディレクトリの.envault-signers）")
+	flags.StringVar(&c.signatureFile, "signature-file", "", "分離署名ファイルのパス（省略時は <暗号化ファイル>.sig）")
+}
+
+// 信頼された署名者ファイルのパスを返す（指定がなければ暗号化ファイルと同じディレクトリ）
+func (c *CLI) signersFilePath(vaultPath string) string {
+	if c.signersFile != "" {
+		return c.signersFile
+	}
+	return filepath.Join(filepath.Dir(vaultPath), SignersFileName)
+}
+
+// 分離署名ファイルのパスを返す
+func (c *CLI) signatureFilePath(vaultPath string) string {
+	if c.signatureFile != "" {
+		return c.signatureFile
+	}
+	return vaultPath + SignatureFileSuffix
+}
+
+func (c *CLI) runSign(keyPath string, embed bool) error {
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("署名鍵の読み込みに失敗しました: %w", err)
+	}
+	key, err := crypto.ParseSigningKeyFile(keyData)
+	if err != nil {
+		return err
+	}
+
+	vaultPath := c.vaultedFilePath()
+	digest, _, err := digestVaultedFile(vaultPath)
+	if err != nil {
+		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+	signature := key.Sign(digest)
+
+	destination := vaultPath
+	if embed {
+		data, err := file.ReadVaultedFile(vaultPath)
+		if err != nil {
+			return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+		}
+		vault, signatures, err := crypto.SplitSignatures(data)
+		if err != nil {
+			return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+		}
+		signed := crypto.EmbedSignatures(vault, crypto.AddSignature(signatures, signature, digest))
+		if err := file.ReplaceVaultedFile(vaultPath, signed); err != nil {
+			return fmt.Errorf("暗号化ファイルの書き込みに失敗しました: %w", err)
+		}
+	} else {
+		destination = c.signatureFilePath(vaultPath)
+		signatures, err := readSignatureFile(destination)
+		if err != nil {
+			return err
+		}
+		content := crypto.MarshalSignatures(crypto.AddSignature(signatures, signature, digest))
+		if err := file.WriteFileAtomic(destination, content, 0644); err != nil {
+			return fmt.Errorf("署名ファイルの書き込みに失敗しました: %w", err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "署名しました: %s (%s)\n", signature.Signer.Fingerprint(), destination)
+	return nil
+}
+
+func (c *CLI) runVerify() error {
+	vaultPath := c.vaultedFilePath()
+	digest, signatures, err := c.collectSignatures(vaultPath)
+	if err != nil {
+		return err
+	}
+	labels, trusted, err := c.loadTrustedSigners(vaultPath)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range signatures {
+		fingerprint := s.Signer.Fingerprint()
+		label, isTrusted := labels[s.Signer.String()]
+		switch {
+		case !s.Verify(digest):
+			fmt.Printf("%s  %-20s  署名が一致しません\n", fingerprint, label)
+		case isTrusted:
+			fmt.Printf("%s  %-20s  正しい署名（信頼済み）\n", fingerprint, label)
+		default:
+			fmt.Printf("%s  %-20s  正しい署名（信頼されていない署名者）\n", fingerprint, label)
+		}
+	}
+
+	if _, err := crypto.VerifySignatures(digest, signatures, trusted); err != nil {
+		return fmt.Errorf("署名の検証に失敗しました: %w", err)
+	}
+	return nil
+}
+
+// --require-signature が指定されている場合に、復号化の前に署名を確認する
+// vault と signatures には、復号化する内容（armorと埋め込み署名を除く）と埋め込み署名を渡す
+// 確認した内容とは別にファイルを読み直すと、その間に差し替えられたファイルを復号化してしまうため、
+// 呼び出し側は同じ vault を復号化すること
+// warn の場合は警告を表示して続行する
+func (c *CLI) checkSignature(path string, vault []byte, signatures []*crypto.Signature) error {
+	if c.requireSigned == "" {
+		return nil
+	}
+	if c.requireSigned != RequireSignatureError && c.requireSigned != RequireSignatureWarn {
+		return fmt.Errorf("--require-signature には %s または %s を指定してください: %s", RequireSignatureError, RequireSignatureWarn, c.requireSigned)
+	}
+	if path == "" {
+		path = file.DefaultVaultedFileName
+	}
+
+	digest, err := crypto.DigestVault(bytes.NewReader(vault))
+	if err != nil {
+		return err
+	}
+	signer, label, err := c.verifyDigest(path, digest, signatures)
+	if err != nil {
+		if c.requireSigned == RequireSignatureWarn {
+			fmt.Fprintf(os.Stderr, "警告: 署名の検証に失敗しました: %v\n", err)
+			return nil
+		}
+		return fmt.Errorf("署名の検証に失敗しました: %w", err)
+	}
+
+	signerName := signer.Signer.Fingerprint()
+	if label != "" {
+		signerName += " (" + label + ")"
+	}
+	fmt.Fprintf(os.Stderr, "署名を確認しました: %s\n", signerName)
+	return nil
+}
+
+// 内容のハッシュに対する信頼された署名者による正しい署名を、埋め込み署名と分離署名から探し、署名と署名者のラベルを返す
+func (c *CLI) verifyDigest(vaultPath string, digest []byte, embedded []*crypto.Signature) (*crypto.Signature, string, error) {
+	labels, trusted, err := c.loadTrustedSigners(vaultPath)
+	if err != nil {
+		return nil, "", err
+	}
+	detached, err := readSignatureFile(c.signatureFilePath(vaultPath))
+	if err != nil {
+		return nil, "", err
+	}
+	signatures := append(append([]*crypto.Signature(nil), embedded...), detached...)
+	signer, err := crypto.VerifySignatures(digest, signatures, trusted)
+	if err != nil {
+		return nil, "", err
+	}
+	return signer, labels[signer.Signer.String()], nil
+}
+
+// 暗号化ファイルの内容のハッシュと、埋め込み署名・分離署名をまとめて返す
+func (c *CLI) collectSignatures(vaultPath string) ([]byte, []*crypto.Signature, error) {
+	digest, signatures, err := digestVaultedFile(vaultPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+	detached, err := readSignatureFile(c.signatureFilePath(vaultPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	return digest, append(signatures, detached...), nil
+}
+
+// 信頼された署名者を読み込み、公開鍵からラベルへの対応と公開鍵のリストを返す
+func (c *CLI) loadTrustedSigners(vaultPath string) (map[string]string, []*crypto.SigningPublicKey, error) {
+	path := c.signersFilePath(vaultPath)
+	entries, err := readSignerEntries(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("信頼された署名者が登録されていません（envault signers add で %s に追加してください）", path)
+	}
+
+	labels := make(map[string]string)
+	var trusted []*crypto.SigningPublicKey
+	for _, e := range entries {
+		publicKey, err := crypto.ParseSigningPublicKey(e.PublicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		labels[publicKey.String()] = e.Label
+		trusted = append(trusted, publicKey)
+	}
+	return labels, trusted, nil
+}
+
+// 暗号化ファイルの内容（armorと埋め込み署名を除く）のハッシュと埋め込み署名を返す
+func digestVaultedFile(path string) ([]byte, []*crypto.Signature, error) {
+	f, signatures, err := file.OpenSignedVaultedFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	digest, err := crypto.DigestVault(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return digest, signatures, nil
+}
+
+// 分離署名ファイルを読み込む（存在しない場合は空）
+func readSignatureFile(path string) ([]*crypto.Signature, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("署名ファイルの読み込みに失敗しました: %w", err)
+	}
+
+	signatures, err := crypto.ParseSignatures(data)
+	if err != nil {
+		return nil, fmt.Errorf("署名ファイル %s の解析に失敗しました: %w", path, err)
+	}
+	return signatures, nil
+}
+
+func (c *CLI) runSignersAdd(publicKeys []string, label string) error {
+	path := c.signersFilePath(c.vaultedFilePath())
+	entries, err := readSignerEntries(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("署名者ファイルの読み込みに失敗しました: %w", err)
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+
+	for _, s := range publicKeys {
+		publicKey, err := crypto.ParseSigningPublicKey(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		if containsSigner(entries, publicKey.String()) {
+			continue
+		}
+		entries = append(entries, crypto.SignerEntry{PublicKey: publicKey.String(), Label: label})
+
+		line := publicKey.String()
+		if label != "" {
+			line += " " + label
+		}
+		data = append(data, line+"\n"...)
+		fmt.Fprintf(os.Stderr, "署名者を追加しました: %s\n", publicKey.Fingerprint())
+	}
+
+	if err := file.WriteFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("署名者ファイルの書き込みに失敗しました: %w", err)
+	}
+	return nil
+}
+
+// 署名者ファイルから指定した署名者（公開鍵またはフィンガープリント）の行を削除する
+// コメントや空行はそのまま残す
+func (c *CLI) runSignersRemove(keys []string) error {
+	path := c.signersFilePath(c.vaultedFilePath())
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("署名者ファイルがありません: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("署名者ファイルの読み込みに失敗しました: %w", err)
+	}
+
+	var kept []string
+	removed := 0
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && !strings.HasPrefix(fields[0], "#") && matchesRecipientKey(fields[0], keys) {
+			removed++
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if removed == 0 {
+		return errors.New("指定された署名者は登録されていません")
+	}
+
+	if err := file.WriteFileAtomic(path, []byte(strings.Join(kept, "")), 0644); err != nil {
+		return fmt.Errorf("署名者ファイルの書き込みに失敗しました: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "%d件の署名者を削除しました\n", removed)
+	return nil
+}
+
+func (c *CLI) runSignersList() error {
+	entries, err := readSignerEntries(c.signersFilePath(c.vaultedFilePath()))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		fmt.Printf("%s  %-20s  %s\n", crypto.Fingerprint(e.PublicKey), e.Label, e.PublicKey)
+	}
+	return nil
+}
+
+// 署名者ファイルを読み込む（存在しない場合は空）
+func readSignerEntries(path string) ([]crypto.SignerEntry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("署名者ファイルの読み込みに失敗しました: %w", err)
+	}
+
+	entries, err := crypto.ParseSignerEntries(data)
+	if err != nil {
+		return nil, fmt.Errorf("署名者ファイル %s の解析に失敗しました: %w", path, err)
+	}
+	return entries, nil
+}
+
+func containsSigner(entries []crypto.SignerEntry, publicKey string) bool {
+	for _, e := range entries {
+		if e.PublicKey == publicKey {
+			return true
+		}
+	}
+	return false
+}
+
+// 署名鍵を生成し、秘密鍵の内容と公開鍵を返す
+func generateSigningKeyContent() (string, string, error) {
+	key, err := crypto.GenerateSigningKey()
+	if err != nil {
+		return "", "", err
+	}
+	publicKey := key.Public().String()
+	content := fmt.Sprintf("# created: %s\n# signing public key: %s\n%s\n",
+		time.Now().Format(time.RFC3339), publicKey, key.String())
+	return content, publicKey, nil
+}
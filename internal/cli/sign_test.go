@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+func TestSignCommands(t *testing.T) {
+	tempDir := t.TempDir()
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	keyPath := filepath.Join(tempDir, "signer.key")
+	password := "test-password"
+
+	writeVault := func(content string) {
+		t.Helper()
+		encrypted, err := crypto.Encrypt([]byte(content), password)
+		if err != nil {
+			t.Fatalf("暗号化に失敗しました: %v", err)
+		}
+		if err := os.WriteFile(vaultPath, encrypted, 0600); err != nil {
+			t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+		}
+	}
+	dump := func(args ...string) (string, error) {
+		withStdin(t, password+"\n")
+		return captureOutput(func() error {
+			return NewCLI().Run(append([]string{"dump", "-p", "-f", vaultPath}, args...))
+		})
+	}
+	writeVault("TEST_VAR1=value1\n")
+
+	if err := NewCLI().Run([]string{"keygen", "--signing", "-o", keyPath}); err != nil {
+		t.Fatalf("Run(keygen --signing) error = %v", err)
+	}
+	keyData, _ := os.ReadFile(keyPath)
+	key, err := crypto.ParseSigningKeyFile(keyData)
+	if err != nil {
+		t.Fatalf("生成した署名鍵を読み取れません: %v", err)
+	}
+
+	if err := NewCLI().Run([]string{"sign", "--signing-key", keyPath, "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(sign) error = %v", err)
+	}
+	if _, err := os.Stat(vaultPath + SignatureFileSuffix); err != nil {
+		t.Fatalf("分離署名ファイルが作成されていません: %v", err)
+	}
+
+	// 信頼された署名者が登録されていない場合は拒否する
+	if _, err := dump("--require-signature"); err == nil {
+		t.Error("信頼された署名者がいない状態で復号化できてしまいました")
+	}
+	// --require-signature を指定しなければ従来どおり復号化できる
+	if output, err := dump(); err != nil || !strings.Contains(output, "TEST_VAR1=value1") {
+		t.Errorf("dump = %q, %v", output, err)
+	}
+
+	if err := NewCLI().Run([]string{"signers", "add", key.Public().String(), "--label", "alice", "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(signers add) error = %v", err)
+	}
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"signers", "list", "-f", vaultPath})
+	})
+	if err != nil || !strings.Contains(output, key.Public().Fingerprint()) || !strings.Contains(output, "alice") {
+		t.Errorf("signers list = %q, %v", output, err)
+	}
+
+	if output, err := dump("--require-signature"); err != nil || !strings.Contains(output, "TEST_VAR1=value1") {
+		t.Errorf("署名されたファイルで dump = %q, %v", output, err)
+	}
+
+	// 共有パスワードで作り直されたファイルは署名が一致しない
+	writeVault("TEST_VAR1=forged\n")
+	if output, err := dump("--require-signature"); !errors.Is(err, crypto.ErrInvalidSignature) || output != "" {
+		t.Errorf("署名後に変更されたファイルで dump = %q, %v, want %v", output, err, crypto.ErrInvalidSignature)
+	}
+	if output, err := dump("--require-signature=warn"); err != nil || !strings.Contains(output, "forged") {
+		t.Errorf("--require-signature=warn で dump = %q, %v", output, err)
+	}
+	if _, err := dump("--require-signature=ignore"); err == nil {
+		t.Error("--require-signature に不正な値を指定してもエラーになりません")
+	}
+
+	// 埋め込み署名
+	os.Remove(vaultPath + SignatureFileSuffix)
+	if err := NewCLI().Run([]string{"sign", "--signing-key", keyPath, "--embed", "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(sign --embed) error = %v", err)
+	}
+	if _, err := os.Stat(vaultPath + SignatureFileSuffix); !os.IsNotExist(err) {
+		t.Error("--embed で分離署名ファイルが作成されました")
+	}
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"verify", "-f", vaultPath})
+	}); err != nil {
+		t.Errorf("埋め込み署名の検証に失敗しました: %v", err)
+	}
+	withStdin(t, password+"\n")
+	output, err = captureOutput(func() error {
+		return NewCLI().Run([]string{"export", "-p", "-o", "--require-signature", "-f", vaultPath})
+	})
+	if err != nil || !strings.Contains(output, "forged") {
+		t.Errorf("埋め込み署名のファイルで export = %q, %v", output, err)
+	}
+
+	if err := NewCLI().Run([]string{"signers", "remove", key.Public().Fingerprint(), "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(signers remove) error = %v", err)
+	}
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"verify", "-f", vaultPath})
+	}); err == nil {
+		t.Error("信頼された署名者を削除しても検証に成功しました")
+	}
+}
+
+// 署名の確認は渡された内容に対して行い、ファイルを読み直さない
+// （確認と復号化の間にファイルを差し替えても、確認していない内容は復号化されない）
+func TestCheckSignatureUsesGivenContent(t *testing.T) {
+	tempDir := t.TempDir()
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	keyPath := filepath.Join(tempDir, "signer.key")
+
+	signed, err := crypto.Encrypt([]byte("A=signed\n"), "password")
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	forged, err := crypto.Encrypt([]byte("A=forged\n"), "password")
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	if err := os.WriteFile(vaultPath, signed, 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+	if err := NewCLI().Run([]string{"keygen", "--signing", "-o", keyPath}); err != nil {
+		t.Fatalf("Run(keygen --signing) error = %v", err)
+	}
+	if err := NewCLI().Run([]string{"sign", "--signing-key", keyPath, "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(sign) error = %v", err)
+	}
+	keyData, _ := os.ReadFile(keyPath)
+	key, err := crypto.ParseSigningKeyFile(keyData)
+	if err != nil {
+		t.Fatalf("生成した署名鍵を読み取れません: %v", err)
+	}
+	if err := NewCLI().Run([]string{"signers", "add", key.Public().String(), "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(signers add) error = %v", err)
+	}
+
+	c := NewCLI()
+	c.requireSigned = RequireSignatureError
+
+	// ディスク上のファイルは署名されていても、渡された内容が異なれば拒否する
+	if err := c.checkSignature(vaultPath, forged, nil); !errors.Is(err, crypto.ErrInvalidSignature) {
+		t.Errorf("checkSignature(差し替えた内容) error = %v, want %v", err, crypto.ErrInvalidSignature)
+	}
+
+	// 確認した後にファイルが差し替えられていても、渡された内容で判断する
+	if err := os.WriteFile(vaultPath, forged, 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+	if err := c.checkSignature(vaultPath, signed, nil); err != nil {
+		t.Errorf("checkSignature(署名した内容) error = %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+// slot コマンドとサブコマンドを作成
+func (c *CLI) newSlotCommand() *cobra.Command {
+	var newKeyFile string
+	var generateKey bool
+
+	slotCmd := &cobra.Command{
+		Use:   "slot",
+		Short: "暗号化ファイルのキースロットを管理",
+		Long: `暗号化ファイルのキースロットを追加・削除・一覧表示します。
+複数のパスワード（個人用パスワードとオフラインで保管する回復用パスワードなど）で
+同じファイルを開けるようにできます。
+- パスワードスロットの追加: envault slot add
+- CI用の鍵文字列のスロットを追加: envault slot add --generate-key
+- スロットの削除: envault slot remove <番号>
+- スロットの一覧: envault slot list`,
+	}
+
+	addCmd := &cobra.Command{
+		Use:   "add [オプション]",
+		Short: "新しいパスワードのスロットを追加",
+		Long: `既存のパスワード（または --identity の秘密鍵）でファイルを開き、新しいパスワードのスロットを追加します。
+--password-stdin を指定した場合は、標準入力の1行目を既存のパスワード、2行目を新しいパスワードとして読み込みます。
+--key-file は既存のスロットを開くために使用されます。追加するスロットでキーファイルを必要とする場合は
+--new-key-file を指定してください（新しいパスワードを空にするとキーファイルのみで開けるスロットになります）。`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if generateKey {
+				return c.runSlotAddRawKey()
+			}
+			return c.runSlotAdd(newKeyFile)
+		},
+	}
+	addCmd.Flags().BoolVar(&generateKey, "generate-key", false, "パスワードの代わりにCI用の鍵文字列（envault_key_...）のスロットを追加")
+	addCmd.Flags().StringVar(&newKeyFile, "new-key-file", "", "追加するスロットで組み合わせるキーファイル")
+	c.addKDFFlags(addCmd)
+	slotCmd.AddCommand(addCmd)
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <番号>",
+		Short: "キースロットを削除",
+		Long: `指定した番号のキースロットを削除します。番号は slot list で確認できます。
+いずれかのスロットのパスワード（または秘密鍵）でファイルを開く必要があります。最後のスロットは削除できません。
+データ鍵は変更されないため、削除したパスワードを知る人が以前のファイルを保持している場合は注意してください。`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			index, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("無効なスロット番号です: %s", args[0])
+			}
+			return c.runSlotRemove(index)
+		},
+	}
+	slotCmd.AddCommand(removeCmd)
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "キースロットの一覧を表示",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.runSlotList()
+		},
+	}
+	slotCmd.AddCommand(listCmd)
+
+	return slotCmd
+}
+
+func (c *CLI) runSlotAdd(newKeyFilePath string) error {
+	vaultPath := c.vaultedFilePath()
+	data, err := file.ReadVaultedFile(vaultPath)
+	if err != nil {
+		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+
+	identities, err := c.unlockIdentities(data, "現在のパスワードを入力してください: ")
+	if err != nil {
+		return err
+	}
+
+	newKeyFile, err := readKeyFile(newKeyFilePath)
+	if err != nil {
+		return err
+	}
+
+	newPassword, err := c.readNewPassword("追加するパスワードを入力してください: ")
+	if err != nil {
+		return err
+	}
+	if newPassword.Len() == 0 && newKeyFile == nil {
+		return errors.New("追加するパスワードが空です")
+	}
+
+	updated, err := crypto.AddRecipients(data, identities, []crypto.Recipient{newPasswordRecipient(newPassword, newKeyFile, c.kdfOptions)})
+	if err != nil {
+		return fmt.Errorf("スロットの追加に失敗しました: %w", err)
+	}
+
+	if err := file.ReplaceVaultedFile(vaultPath, updated); err != nil {
+		return fmt.Errorf("暗号化ファイルの書き込みに失敗しました: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "パスワードスロットを追加しました: %s\n", vaultPath)
+	return nil
+}
+
+// CI用の鍵文字列のスロットを追加し、生成した鍵文字列を表示する
+func (c *CLI) runSlotAddRawKey() error {
+	vaultPath := c.vaultedFilePath()
+	data, err := file.ReadVaultedFile(vaultPath)
+	if err != nil {
+		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+
+	identities, err := c.unlockIdentities(data, "現在のパスワードを入力してください: ")
+	if err != nil {
+		return err
+	}
+
+	key, err := crypto.GenerateRawKey()
+	if err != nil {
+		return err
+	}
+
+	updated, err := crypto.AddRecipients(data, identities, []crypto.Recipient{key})
+	if err != nil {
+		return fmt.Errorf("スロットの追加に失敗しました: %w", err)
+	}
+
+	if err := file.ReplaceVaultedFile(vaultPath, updated); err != nil {
+		return fmt.Errorf("暗号化ファイルの書き込みに失敗しました: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "鍵文字列のスロットを追加しました: %s\n", vaultPath)
+	printGeneratedKey(key)
+	return nil
+}
+
+func (c *CLI) runSlotRemove(index int) error {
+	vaultPath := c.vaultedFilePath()
+	data, err := file.ReadVaultedFile(vaultPath)
+	if err != nil {
+		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+
+	identities, err := c.unlockIdentities(data, "復号化用パスワードを入力してください: ")
+	if err != nil {
+		return err
+	}
+
+	updated, err := crypto.RemoveSlot(data, identities, index)
+	if err != nil {
+		return fmt.Errorf("スロットの削除に失敗しました: %w", err)
+	}
+
+	if err := file.ReplaceVaultedFile(vaultPath, updated); err != nil {
+		return fmt.Errorf("暗号化ファイルの書き込みに失敗しました: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "スロット %d を削除しました: %s\n", index, vaultPath)
+	return nil
+}
+
+func (c *CLI) runSlotList() error {
+	data, err := file.ReadVaultedFile(c.vaultedFilePath())
+	if err != nil {
+		return fmt.Errorf(".env.vaultedファイルの読み込みに失敗しました: %w", err)
+	}
+
+	header, err := crypto.ParseHeader(data)
+	if err != nil {
+		return err
+	}
+
+	if header.KDF != nil {
+		fmt.Println("パスワードで直接暗号化された旧形式のファイルです（slot add でスロット形式に変換されます）")
+		return nil
+	}
+
+	for i, slot := range header.Slots {
+		fmt.Printf("%d: %s\n", i, describeSlot(&slot))
+	}
+	return nil
+}
+
+// キースロットの種類とパラメータを表す文字列を返す
+func describeSlot(slot *crypto.Slot) string {
+	switch {
+	case slot.KDF != nil:
+		slotType := slot.Type
+		if slot.Type == crypto.SlotTypePassword && slot.KDF.KeyFile {
+			slotType += "+keyfile"
+		}
+		return fmt.Sprintf("%s (%s time=%d memory=%dKiB threads=%d)",
+			slotType, slot.KDF.ID, slot.KDF.Time, slot.KDF.Memory, slot.KDF.Threads)
+	case slot.Recipient != "":
+		return fmt.Sprintf("%s %s", slot.Type, slot.Fingerprint())
+	default:
+		return slot.Type
+	}
+}
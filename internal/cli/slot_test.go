@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+func TestSlotCommands(t *testing.T) {
+	tempDir := t.TempDir()
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	content := "TEST_VAR1=value1\n"
+
+	encrypted, err := crypto.Encrypt([]byte(content), "personal")
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	if err := os.WriteFile(vaultPath, encrypted, 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	withStdin(t, "personal\nrecovery\n")
+	if err := NewCLI().Run([]string{"slot", "add", "-p", "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(slot add) error = %v", err)
+	}
+
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"slot", "list", "-f", vaultPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(slot list) error = %v", err)
+	}
+	if !strings.Contains(output, "0: password") || !strings.Contains(output, "1: password") {
+		t.Errorf("Run(slot list) の出力が期待と異なります: %s", output)
+	}
+
+	withStdin(t, "recovery\n")
+	if err := NewCLI().Run([]string{"slot", "remove", "0", "-p", "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(slot remove) error = %v", err)
+	}
+
+	withStdin(t, "recovery\n")
+	output, err = captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-p", "-f", vaultPath})
+	})
+	if err != nil || output != content {
+		t.Errorf("回復用パスワードで復号化できません: %v", err)
+	}
+
+	withStdin(t, "personal\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-p", "-f", vaultPath})
+	}); err == nil {
+		t.Errorf("削除したスロットのパスワードで復号化できてしまいました")
+	}
+}
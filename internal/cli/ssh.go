@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/uzulla/envault/internal/crypto"
+)
+
+// --ssh-recipient で指定されたSSH公開鍵を読み込む
+// 値は .pub ファイル、authorized_keys 形式のファイル、または公開鍵そのもの（ssh-ed25519 AAAA...）
+func loadSSHRecipients(values []string) ([]crypto.Recipient, error) {
+	var recipients []crypto.Recipient
+	for _, value := range values {
+		data, err := os.ReadFile(value)
+		if os.IsNotExist(err) && strings.HasPrefix(value, "ssh-") {
+			data, err = []byte(value), nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("SSH公開鍵ファイルの読み込みに失敗しました: %w", err)
+		}
+
+		sshRecipients, err := crypto.ParseSSHRecipients(data)
+		if err != nil {
+			return nil, fmt.Errorf("SSH公開鍵 %s の解析に失敗しました: %w", value, err)
+		}
+		recipients = append(recipients, sshRecipients...)
+	}
+	return recipients, nil
+}
+
+// --ssh-identity で指定されたSSH秘密鍵を読み込む
+// パスフレーズで保護された鍵の場合はパスフレーズを入力させる
+func (c *CLI) loadSSHIdentities(paths []string) ([]crypto.Identity, error) {
+	var identities []crypto.Identity
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("SSH秘密鍵の読み込みに失敗しました: %w", err)
+		}
+
+		id, err := crypto.ParseSSHIdentity(data, func() ([]byte, error) {
+			passphrase, err := c.readPassword(fmt.Sprintf("SSH秘密鍵 %s のパスフレーズを入力してください: ", path))
+			// パスフレーズのバッファはコマンドの終了時に消去される
+			return passphrase.Bytes(), err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("SSH秘密鍵 %s の読み込みに失敗しました: %w", path, err)
+		}
+		identities = append(identities, id)
+	}
+	return identities, nil
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uzulla/envault/internal/file"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHRecipientEncryptAndDump(t *testing.T) {
+	tempDir := t.TempDir()
+	envPath := filepath.Join(tempDir, ".env")
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	privatePath := filepath.Join(tempDir, "id_ed25519")
+	publicPath := privatePath + ".pub"
+	content := "TEST_VAR1=value1\n"
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("鍵の生成に失敗しました: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(privateKey, "test", []byte("ssh-passphrase"))
+	if err != nil {
+		t.Fatalf("SSH秘密鍵の作成に失敗しました: %v", err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("SSH公開鍵の作成に失敗しました: %v", err)
+	}
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("SSH秘密鍵の書き込みに失敗しました: %v", err)
+	}
+	if err := os.WriteFile(publicPath, ssh.MarshalAuthorizedKey(sshPublicKey), 0644); err != nil {
+		t.Fatalf("SSH公開鍵の書き込みに失敗しました: %v", err)
+	}
+	if err := os.WriteFile(envPath, []byte(content), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"encrypt", envPath, "--ssh-recipient", publicPath, "-f", vaultPath})
+	}); err != nil {
+		t.Fatalf("Run(encrypt --ssh-recipient) error = %v", err)
+	}
+
+	withStdin(t, "ssh-passphrase\n")
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-p", "-f", vaultPath, "--ssh-identity", privatePath})
+	})
+	if err != nil {
+		t.Fatalf("Run(dump --ssh-identity) error = %v", err)
+	}
+	if output != content {
+		t.Errorf("Run(dump) = %q, want %q", output, content)
+	}
+
+	withStdin(t, "wrong\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-p", "-f", vaultPath, "--ssh-identity", privatePath})
+	}); err == nil {
+		t.Errorf("誤ったパスフレーズで復号化できてしまいました")
+	}
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/env"
+)
+
+// .envファイルを値ごとに暗号化した構造化形式で暗号化する
+// 出力先に同じパスワードで開け、同じ設定で暗号化された構造化形式のファイルがある場合は、
+// データ鍵とスロットを引き継いで変更していない値の行がそのまま残るようにする
+func (c *CLI) encryptStructured(data []byte, recipients []crypto.Recipient, outputPath string, identities []crypto.Identity, metadata *crypto.Metadata) ([]byte, error) {
+	rawEntries, err := env.ParseRawEntries(data)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]crypto.StructuredEntry, 0, len(rawEntries))
+	for _, e := range rawEntries {
+		entries = append(entries, crypto.StructuredEntry{Key: e.Key, Value: e.RawValue})
+	}
+
+	if len(identities) > 0 {
+		if existing, err := os.ReadFile(outputPath); err == nil && crypto.DetectFormat(existing) == crypto.FormatStructured {
+			if header, err := crypto.ParseHeader(existing); err == nil && c.matchesStructuredHeader(header) {
+				if updated, err := crypto.UpdateStructured(existing, identities, entries, metadata); err == nil {
+					return updated, nil
+				}
+			}
+		}
+	}
+
+	return crypto.EncryptStructured(entries, recipients, crypto.StructuredOptions{HashKeys: c.hashKeys, Metadata: metadata, Cipher: c.cipher})
+}
+
+// 既存の構造化形式のファイルが、今回の暗号化と同じ設定かどうか
+// 暗号方式・キー名の扱いに加え、スロットがパスワードスロット1つだけで、KDFパラメータが同じ場合に限る
+// 設定が異なるままスロットを引き継ぐと、指定したオプションが黙って無視されるため
+func (c *CLI) matchesStructuredHeader(header *crypto.Header) bool {
+	if header.HashedKeys != c.hashKeys || header.Cipher != c.cipher {
+		return false
+	}
+	if len(header.Slots) != 1 {
+		return false
+	}
+	slot := header.Slots[0]
+	return slot.Type == crypto.SlotTypePassword && slot.KDF != nil &&
+		slot.KDF.Time == c.kdfOptions.ArgonTime &&
+		slot.KDF.Memory == c.kdfOptions.ArgonMemory &&
+		slot.KDF.Threads == c.kdfOptions.ArgonThreads
+}
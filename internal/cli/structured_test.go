@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uzulla/envault/internal/crypto"
+	"github.com/uzulla/envault/internal/file"
+)
+
+func TestEncryptStructuredFormat(t *testing.T) {
+	tempDir := t.TempDir()
+	envPath := filepath.Join(tempDir, ".env")
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	content := "# コメント\nTEST_VAR1=value1\nTEST_VAR2=\"value 2\"\n"
+
+	if err := os.WriteFile(envPath, []byte(content), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	withStdin(t, "test-password\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"encrypt", envPath, "--format", "structured", "-p", "-f", vaultPath})
+	}); err != nil {
+		t.Fatalf("Run(encrypt --format structured) error = %v", err)
+	}
+
+	before, err := os.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatalf("暗号化ファイルの読み込みに失敗しました: %v", err)
+	}
+	if crypto.DetectFormat(before) != crypto.FormatStructured {
+		t.Fatalf("構造化形式で暗号化されていません")
+	}
+
+	// TEST_VAR2 だけを変更して暗号化し直すと、TEST_VAR1 の行はそのまま残ること
+	if err := os.WriteFile(envPath, []byte("TEST_VAR1=value1\nTEST_VAR2=changed\n"), 0600); err != nil {
+		t.Fatalf("テストファイルの更新に失敗しました: %v", err)
+	}
+	withStdin(t, "test-password\ny\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"encrypt", envPath, "--format", "structured", "-p", "-f", vaultPath})
+	}); err != nil {
+		t.Fatalf("Run(encrypt --format structured) error = %v", err)
+	}
+	after, err := os.ReadFile(vaultPath)
+	if err != nil {
+		t.Fatalf("暗号化ファイルの読み込みに失敗しました: %v", err)
+	}
+	line1 := func(data []byte) string {
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "TEST_VAR1=") {
+				return line
+			}
+		}
+		return ""
+	}
+	if line1(before) == "" || line1(before) != line1(after) {
+		t.Errorf("変更していない変数の行が変わりました: %q -> %q", line1(before), line1(after))
+	}
+
+	withStdin(t, "test-password\n")
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-p", "-f", vaultPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(dump) error = %v", err)
+	}
+	if want := "TEST_VAR1=value1\nTEST_VAR2=changed\n"; output != want {
+		t.Errorf("Run(dump) = %q, want %q", output, want)
+	}
+}
+
+// スロットを変更するコマンドでも構造化形式のまま（キー名を隠す設定も引き継いで）書き換えられること
+func TestStructuredSlotCommands(t *testing.T) {
+	tempDir := t.TempDir()
+	envPath := filepath.Join(tempDir, ".env")
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	oldFile := filepath.Join(tempDir, "old.txt")
+	newFile := filepath.Join(tempDir, "new.txt")
+	aliceKey := filepath.Join(tempDir, "alice.txt")
+	sharesDir := filepath.Join(tempDir, "shares")
+	alice := writeIdentityForTest(t, aliceKey)
+	content := "TEST_VAR1=value1\nTEST_VAR2=\"value 2\"\n"
+
+	os.WriteFile(envPath, []byte(content), 0600)
+	os.WriteFile(oldFile, []byte("old-password\n"), 0600)
+	os.WriteFile(newFile, []byte("new-password\n"), 0600)
+
+	withStdin(t, "old-password\n")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"encrypt", envPath, "--format", "structured", "--hash-keys", "-p", "-f", vaultPath})
+	}); err != nil {
+		t.Fatalf("Run(encrypt --format structured) error = %v", err)
+	}
+
+	assertStructured := func(step string) {
+		t.Helper()
+		data, err := os.ReadFile(vaultPath)
+		if err != nil {
+			t.Fatalf("%s: 暗号化ファイルの読み込みに失敗しました: %v", step, err)
+		}
+		if crypto.DetectFormat(data) != crypto.FormatStructured {
+			t.Fatalf("%s: 構造化形式ではなくなりました", step)
+		}
+		header, err := crypto.ParseHeader(data)
+		if err != nil || !header.HashedKeys {
+			t.Fatalf("%s: キー名を隠す設定が引き継がれていません: %+v, %v", step, header, err)
+		}
+	}
+
+	if err := NewCLI().Run([]string{"passwd", "-f", vaultPath, "--old-password-file", oldFile, "--new-password-file", newFile}); err != nil {
+		t.Fatalf("Run(passwd) error = %v", err)
+	}
+	assertStructured("passwd")
+
+	withStdin(t, "new-password\n")
+	if err := NewCLI().Run([]string{"upgrade", "-p", "--kdf-time", "3", "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(upgrade) error = %v", err)
+	}
+	assertStructured("upgrade")
+
+	withStdin(t, "new-password\n")
+	if err := NewCLI().Run([]string{"recipients", "add", alice.Recipient().String(), "-p", "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(recipients add) error = %v", err)
+	}
+	assertStructured("recipients add")
+	if _, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-f", vaultPath, "-i", aliceKey})
+	}); err != nil {
+		t.Errorf("追加した受信者で復号化できません: %v", err)
+	}
+
+	withStdin(t, "new-password\n")
+	if err := NewCLI().Run([]string{"recipients", "remove", alice.Recipient().String(), "-p", "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(recipients remove) error = %v", err)
+	}
+	assertStructured("recipients remove")
+
+	withStdin(t, "new-password\nslot-password\n")
+	if err := NewCLI().Run([]string{"slot", "add", "-p", "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(slot add) error = %v", err)
+	}
+	assertStructured("slot add")
+
+	withStdin(t, "slot-password\n")
+	if err := NewCLI().Run([]string{"recovery", "split", "-p", "--shares", "3", "--threshold", "2", "-o", sharesDir, "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(recovery split) error = %v", err)
+	}
+	shareFiles, _ := filepath.Glob(filepath.Join(sharesDir, "envault-recovery-*.txt"))
+	if len(shareFiles) != 3 {
+		t.Fatalf("分割片ファイルの数 = %d, want 3", len(shareFiles))
+	}
+
+	withStdin(t, "recovered-password\n")
+	if err := NewCLI().Run([]string{"recovery", "combine", "-p", "-f", vaultPath, shareFiles[0], shareFiles[2]}); err != nil {
+		t.Fatalf("Run(recovery combine) error = %v", err)
+	}
+	assertStructured("recovery combine")
+
+	withStdin(t, "recovered-password\n")
+	output, err := captureOutput(func() error {
+		return NewCLI().Run([]string{"dump", "-p", "-f", vaultPath})
+	})
+	if err != nil {
+		t.Fatalf("Run(dump) error = %v", err)
+	}
+	if output != content {
+		t.Errorf("Run(dump) = %q, want %q", output, content)
+	}
+}
+
+// 既存のファイルと異なるオプションで暗号化し直すと、スロットを引き継がずに新しく暗号化すること
+func TestEncryptStructuredOptionsChange(t *testing.T) {
+	tempDir := t.TempDir()
+	envPath := filepath.Join(tempDir, ".env")
+	vaultPath := filepath.Join(tempDir, file.DefaultVaultedFileName)
+	os.WriteFile(envPath, []byte("TEST_VAR1=value1\n"), 0600)
+
+	encrypt := func(args ...string) *crypto.Header {
+		t.Helper()
+		withStdin(t, "test-password\ny\n")
+		if _, err := captureOutput(func() error {
+			return NewCLI().Run(append([]string{"encrypt", envPath, "--format", "structured", "-p", "-f", vaultPath}, args...))
+		}); err != nil {
+			t.Fatalf("Run(encrypt %v) error = %v", args, err)
+		}
+		data, _ := os.ReadFile(vaultPath)
+		header, err := crypto.ParseHeader(data)
+		if err != nil {
+			t.Fatalf("ヘッダの読み取りに失敗しました: %v", err)
+		}
+		return header
+	}
+
+	encrypt()
+
+	if header := encrypt("--kdf-time", "3"); header.Slots[0].KDF.Time != 3 {
+		t.Errorf("--kdf-time が反映されていません: %+v", header.Slots[0].KDF)
+	}
+	if header := encrypt("--kdf-time", "3", "--cipher", crypto.CipherXChaCha20Poly1305); header.Cipher != crypto.CipherXChaCha20Poly1305 {
+		t.Errorf("--cipher が反映されていません: %s", header.Cipher)
+	}
+
+	// 他のスロットがあるファイルは、今回のパスワードだけのファイルに置き換わる
+	withStdin(t, "test-password\nother-password\n")
+	if err := NewCLI().Run([]string{"slot", "add", "-p", "-f", vaultPath}); err != nil {
+		t.Fatalf("Run(slot add) error = %v", err)
+	}
+	if header := encrypt("--kdf-time", "3", "--cipher", crypto.CipherXChaCha20Poly1305); len(header.Slots) != 1 {
+		t.Errorf("既存のスロットが引き継がれました: %d個", len(header.Slots))
+	}
+}
@@ -0,0 +1,239 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"github.com/uzulla/envault/internal/armor"
+)
+
+// Format は暗号化ファイルの形式です
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatEnvault1
+	FormatEnvault2
+	FormatAge
+	FormatStructured
+)
+
+const (
+	// AgeMagic はage形式のファイルの先頭に置かれるバージョン行です
+	AgeMagic = "age-encryption.org/v1\n"
+
+	ageRecipientHRP = "age"
+	ageSecretKeyHRP = "AGE-SECRET-KEY-"
+)
+
+// String は形式の名前を返します
+func (f Format) String() string {
+	switch f {
+	case FormatEnvault1:
+		return "envault1"
+	case FormatEnvault2:
+		return "envault2"
+	case FormatAge:
+		return "age"
+	case FormatStructured:
+		return "structured"
+	default:
+		return "unknown"
+	}
+}
+
+// DetectFormat は先頭のマジックバイトから暗号化ファイルの形式を判定します
+// ASCII armor形式のデータは、armorを外した中身の形式を返します
+func DetectFormat(data []byte) Format {
+	if armor.IsArmored(data) {
+		decoded, err := armor.Decode(data)
+		if err != nil {
+			return FormatUnknown
+		}
+		data = decoded
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte(MagicBytes)):
+		return FormatEnvault2
+	case bytes.HasPrefix(data, []byte(MagicBytesV1)):
+		return FormatEnvault1
+	case bytes.HasPrefix(data, []byte(AgeMagic)):
+		return FormatAge
+	case bytes.HasPrefix(data, []byte(StructuredMagic)):
+		return FormatStructured
+	default:
+		return FormatUnknown
+	}
+}
+
+// AcceptsPassword はパスワードで復号化できる可能性があるファイルかどうかを返します
+// 公開鍵のみで暗号化されたファイルの場合は false を返します
+func AcceptsPassword(data []byte) bool {
+	switch DetectFormat(data) {
+	case FormatEnvault2, FormatStructured:
+		header, err := ParseHeader(data)
+		return err != nil || header.AcceptsPassword()
+	case FormatAge:
+		// パスフレーズで暗号化されたageファイルはscryptスタンザを持つ
+		header, _, _ := bytes.Cut(data, []byte("\n---"))
+		return bytes.Contains(header, []byte("\n-> scrypt "))
+	default:
+		return true
+	}
+}
+
+// EncryptAge はデータを標準的なage形式で暗号化します
+// パスワードはscryptパスフレーズ、X25519とSSHの受信者はageの対応する受信者として扱われます
+// ageの仕様により、パスワードは他の受信者と組み合わせることができません
+func EncryptAge(data []byte, recipients []Recipient) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := EncryptAgeStream(&buf, bytes.NewReader(data), recipients); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncryptAgeStream は src から読み込んだデータを EncryptAge と同様にage形式で暗号化し、dst に書き込みます
+// age形式の本文も64KiBごとのチャンクで暗号化されるため、データ全体をメモリに読み込みません
+func EncryptAgeStream(dst io.Writer, src io.Reader, recipients []Recipient) error {
+	ageRecipients, err := toAgeRecipients(recipients)
+	if err != nil {
+		return err
+	}
+
+	w, err := age.Encrypt(dst, ageRecipients...)
+	if err != nil {
+		return fmt.Errorf("age形式の暗号化に失敗しました: %w", err)
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return fmt.Errorf("age形式の暗号化に失敗しました: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("age形式の暗号化に失敗しました: %w", err)
+	}
+	return nil
+}
+
+// 受信者をageの受信者に変換します
+func toAgeRecipients(recipients []Recipient) ([]age.Recipient, error) {
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	ageRecipients := make([]age.Recipient, 0, len(recipients))
+	for _, r := range recipients {
+		switch r := r.(type) {
+		case *PasswordRecipient:
+			if r.keyFile != nil {
+				return nil, fmt.Errorf("%w: age形式ではキーファイルを使用できません", ErrUnsupported)
+			}
+			// ageのAPIは文字列でパスフレーズを受け取るため、この変換で作られる文字列は消去できない
+			scrypt, err := age.NewScryptRecipient(string(r.password.Bytes()))
+			if err != nil {
+				return nil, fmt.Errorf("scrypt受信者の作成に失敗しました: %w", err)
+			}
+			ageRecipients = append(ageRecipients, scrypt)
+		case *X25519Recipient:
+			x25519, err := age.ParseX25519Recipient(r.AgeString())
+			if err != nil {
+				return nil, fmt.Errorf("age受信者の作成に失敗しました: %w", err)
+			}
+			ageRecipients = append(ageRecipients, x25519)
+		case *SSHRecipient:
+			sshRecipient, err := agessh.ParseRecipient(r.String())
+			if err != nil {
+				return nil, fmt.Errorf("age受信者の作成に失敗しました: %w", err)
+			}
+			ageRecipients = append(ageRecipients, sshRecipient)
+		default:
+			return nil, fmt.Errorf("%w: age形式では使用できない受信者です", ErrUnsupported)
+		}
+	}
+	return ageRecipients, nil
+}
+
+// age形式のデータをパスワード、X25519秘密鍵またはSSH秘密鍵で復号化します
+func decryptAge(encryptedData []byte, identities []Identity) ([]byte, error) {
+	ageIdentities := make([]age.Identity, 0, len(identities))
+	for _, id := range identities {
+		switch id := id.(type) {
+		case *PasswordIdentity:
+			scrypt, err := age.NewScryptIdentity(string(id.password.Bytes()))
+			if err != nil {
+				return nil, fmt.Errorf("scrypt秘密鍵の作成に失敗しました: %w", err)
+			}
+			ageIdentities = append(ageIdentities, scrypt)
+		case *X25519Identity:
+			x25519, err := age.ParseX25519Identity(id.AgeString())
+			if err != nil {
+				return nil, fmt.Errorf("age秘密鍵の作成に失敗しました: %w", err)
+			}
+			ageIdentities = append(ageIdentities, x25519)
+		case *SSHIdentity:
+			sshIdentity, err := id.ageIdentity()
+			if err != nil {
+				return nil, fmt.Errorf("age秘密鍵の作成に失敗しました: %w", err)
+			}
+			ageIdentities = append(ageIdentities, sshIdentity)
+		}
+	}
+	if len(ageIdentities) == 0 {
+		return nil, ErrNoIdentityMatched
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(encryptedData), ageIdentities...)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			if findPasswordIdentity(identities) != nil {
+				return nil, ErrDecryptionFailed
+			}
+			return nil, ErrNoIdentityMatched
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plaintext, nil
+}
+
+// AgeString は公開鍵をage形式（age1...）で返します
+func (r *X25519Recipient) AgeString() string {
+	s, _ := bech32Encode(ageRecipientHRP, r.publicKey.Bytes())
+	return s
+}
+
+// AgeString は秘密鍵をage形式（AGE-SECRET-KEY-1...）で返します
+func (i *X25519Identity) AgeString() string {
+	s, _ := bech32Encode(ageSecretKeyHRP, i.privateKey.Bytes())
+	return s
+}
+
+// age形式の鍵文字列から鍵のバイト列を取り出します
+func decodeAgeKeyString(s, hrp string) ([]byte, error) {
+	gotHRP, data, err := bech32Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if gotHRP != strings.ToLower(hrp) {
+		return nil, fmt.Errorf("接頭辞が一致しません: %q", gotHRP)
+	}
+	return data, nil
+}
+
+// ageのSSH秘密鍵（agessh）を返します
+func (i *SSHIdentity) ageIdentity() (age.Identity, error) {
+	if i.rsaKey != nil {
+		return agessh.NewRSAIdentity(i.rsaKey)
+	}
+	return agessh.NewEd25519Identity(i.ed25519Key)
+}
@@ -0,0 +1,114 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestAgeKeyEncoding(t *testing.T) {
+	id := generateIdentityForTest(t)
+
+	ageIdentity, err := age.ParseX25519Identity(id.AgeString())
+	if err != nil {
+		t.Fatalf("ageで秘密鍵を解析できません: %v", err)
+	}
+	if got := ageIdentity.Recipient().String(); got != id.Recipient().AgeString() {
+		t.Errorf("AgeString() = %q, want %q", id.Recipient().AgeString(), got)
+	}
+
+	parsed, err := ParseX25519Identity(id.AgeString())
+	if err != nil {
+		t.Fatalf("ParseX25519Identity(age) error = %v", err)
+	}
+	if parsed.String() != id.String() {
+		t.Errorf("age形式の秘密鍵を読み込むと別の鍵になりました")
+	}
+
+	recipient, err := ParseX25519Recipient(id.Recipient().AgeString())
+	if err != nil {
+		t.Fatalf("ParseX25519Recipient(age) error = %v", err)
+	}
+	if recipient.String() != id.Recipient().String() {
+		t.Errorf("age形式の公開鍵を読み込むと別の鍵になりました")
+	}
+
+	broken := []byte(id.Recipient().AgeString())
+	broken[len(broken)-1] ^= 1
+	if _, err := ParseX25519Recipient(string(broken)); err == nil {
+		t.Errorf("チェックサムが壊れた公開鍵を受け付けました")
+	}
+}
+
+func TestEncryptAgeWithPassword(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1\nTEST_VAR2=value2")
+
+	encrypted, err := EncryptAge(testData, []Recipient{NewPasswordRecipient("test-password", DefaultOptions())})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	if DetectFormat(encrypted) != FormatAge {
+		t.Fatalf("DetectFormat() = %v, want %v", DetectFormat(encrypted), FormatAge)
+	}
+	if !AcceptsPassword(encrypted) {
+		t.Errorf("パスフレーズで暗号化したファイルがパスワードを受け付けません")
+	}
+
+	decrypted, err := Decrypt(encrypted, "test-password")
+	if err != nil {
+		t.Fatalf("復号化に失敗しました: %v", err)
+	}
+	if !bytes.Equal(decrypted, testData) {
+		t.Errorf("復号化されたデータが元のデータと一致しません")
+	}
+
+	if _, err := Decrypt(encrypted, "wrong-password"); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("Decrypt(wrong password) error = %v, want %v", err, ErrDecryptionFailed)
+	}
+}
+
+func TestEncryptAgeWithX25519(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1\n")
+	alice := generateIdentityForTest(t)
+	mallory := generateIdentityForTest(t)
+
+	encrypted, err := EncryptAge(testData, []Recipient{alice.Recipient()})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	if AcceptsPassword(encrypted) {
+		t.Errorf("公開鍵のみで暗号化したファイルがパスワードを受け付けます")
+	}
+
+	// 標準のageで復号化できること
+	ageIdentity, err := age.ParseX25519Identity(alice.AgeString())
+	if err != nil {
+		t.Fatalf("ageで秘密鍵を解析できません: %v", err)
+	}
+	r, err := age.Decrypt(bytes.NewReader(encrypted), ageIdentity)
+	if err != nil {
+		t.Fatalf("ageで復号化できません: %v", err)
+	}
+	if plaintext, _ := io.ReadAll(r); !bytes.Equal(plaintext, testData) {
+		t.Errorf("ageで復号化したデータが元のデータと一致しません")
+	}
+
+	decrypted, err := DecryptWithIdentities(encrypted, []Identity{alice})
+	if err != nil {
+		t.Fatalf("復号化に失敗しました: %v", err)
+	}
+	if !bytes.Equal(decrypted, testData) {
+		t.Errorf("復号化されたデータが元のデータと一致しません")
+	}
+
+	if _, err := DecryptWithIdentities(encrypted, []Identity{mallory}); !errors.Is(err, ErrNoIdentityMatched) {
+		t.Errorf("DecryptWithIdentities(mallory) error = %v, want %v", err, ErrNoIdentityMatched)
+	}
+
+	if _, err := AddRecipients(encrypted, []Identity{alice}, []Recipient{mallory.Recipient()}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("AddRecipients(age) error = %v, want %v", err, ErrUnsupported)
+	}
+}
@@ -0,0 +1,79 @@
+package crypto
+
+import (
+	"crypto/cipher"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// CipherXChaCha20Poly1305 は24バイトのnonceを使用するXChaCha20-Poly1305です
+	// AESの命令を持たないCPUでも高速で、ランダムなnonceの衝突を心配する必要がありません
+	CipherXChaCha20Poly1305 = "xchacha20-poly1305"
+)
+
+// CipherSuite は本文の暗号化に使用するAEADの種類です
+// ヘッダの cipher にはスイートの名前が記録され、復号化時はその名前でスイートを選択します
+type CipherSuite interface {
+	Name() string
+	NewAEAD(key []byte) (cipher.AEAD, error)
+}
+
+type aes256GCMSuite struct{}
+
+func (aes256GCMSuite) Name() string { return CipherAES256GCM }
+
+func (aes256GCMSuite) NewAEAD(key []byte) (cipher.AEAD, error) {
+	return newGCM(key)
+}
+
+type xchacha20Poly1305Suite struct{}
+
+func (xchacha20Poly1305Suite) Name() string { return CipherXChaCha20Poly1305 }
+
+func (xchacha20Poly1305Suite) NewAEAD(key []byte) (cipher.AEAD, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("XChaCha20-Poly1305の初期化に失敗しました: %w", err)
+	}
+	return aead, nil
+}
+
+// 対応している暗号スイート（先頭がデフォルト）
+var cipherSuites = []CipherSuite{
+	aes256GCMSuite{},
+	xchacha20Poly1305Suite{},
+}
+
+// CipherSuiteByName は名前に対応する暗号スイートを返します
+// 空の場合はデフォルトの AES-256-GCM を返します
+func CipherSuiteByName(name string) (CipherSuite, error) {
+	if name == "" {
+		return cipherSuites[0], nil
+	}
+	for _, suite := range cipherSuites {
+		if suite.Name() == name {
+			return suite, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: 暗号方式 %q", ErrUnsupported, name)
+}
+
+// CipherNames は対応している暗号スイートの名前を返します
+func CipherNames() []string {
+	names := make([]string, 0, len(cipherSuites))
+	for _, suite := range cipherSuites {
+		names = append(names, suite.Name())
+	}
+	return names
+}
+
+// 暗号スイートの名前と鍵からAEADを作成します
+func newAEAD(name string, key []byte) (cipher.AEAD, error) {
+	suite, err := CipherSuiteByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return suite.NewAEAD(key)
+}
@@ -0,0 +1,87 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCipherSuites(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1\nTEST_VAR2=value2")
+	password := "testpassword"
+
+	for _, name := range CipherNames() {
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Cipher = name
+
+			encrypted, err := EncryptWithOptions(testData, password, opts)
+			if err != nil {
+				t.Fatalf("暗号化に失敗しました: %v", err)
+			}
+
+			header, err := ParseHeader(encrypted)
+			if err != nil {
+				t.Fatalf("ParseHeader() error = %v", err)
+			}
+			suite, _ := CipherSuiteByName(name)
+			aead, _ := suite.NewAEAD(make([]byte, KeyLength))
+			// チャンク形式ではnonceの末尾5バイトをチャンク番号と最終チャンクフラグに使う
+			if header.Cipher != name || len(header.Nonce) != aead.NonceSize()-streamNonceSuffixSize {
+				t.Errorf("ヘッダ: cipher=%q nonce=%dバイト, want %q %dバイト", header.Cipher, len(header.Nonce), name, aead.NonceSize()-streamNonceSuffixSize)
+			}
+
+			decrypted, err := Decrypt(encrypted, password)
+			if err != nil {
+				t.Fatalf("復号化に失敗しました: %v", err)
+			}
+			if !bytes.Equal(decrypted, testData) {
+				t.Errorf("Decrypt() = %q, want %q", decrypted, testData)
+			}
+
+			// スロットを変更しても暗号方式は引き継がれること
+			id, err := GenerateX25519Identity()
+			if err != nil {
+				t.Fatalf("秘密鍵の生成に失敗しました: %v", err)
+			}
+			added, err := AddRecipients(encrypted, []Identity{NewPasswordIdentity(password)}, []Recipient{id.Recipient()})
+			if err != nil {
+				t.Fatalf("AddRecipients() error = %v", err)
+			}
+			if header, err := ParseHeader(added); err != nil || header.Cipher != name {
+				t.Errorf("AddRecipients() 後の暗号方式 = %v, %v, want %q", header, err, name)
+			}
+			if decrypted, err := DecryptWithIdentities(added, []Identity{id}); err != nil || !bytes.Equal(decrypted, testData) {
+				t.Errorf("DecryptWithIdentities() = %q, %v", decrypted, err)
+			}
+
+			// 構造化形式でも同じ暗号方式を使用できること
+			structured, err := EncryptStructured([]StructuredEntry{{Key: "TEST_VAR1", Value: "value1"}},
+				[]Recipient{NewPasswordRecipient(password, opts)}, StructuredOptions{Cipher: name})
+			if err != nil {
+				t.Fatalf("EncryptStructured() error = %v", err)
+			}
+			if decrypted, err := Decrypt(structured, password); err != nil || string(decrypted) != "TEST_VAR1=value1\n" {
+				t.Errorf("Decrypt(structured) = %q, %v", decrypted, err)
+			}
+		})
+	}
+}
+
+func TestUnknownCipher(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Cipher = "rot13"
+	if _, err := EncryptWithOptions([]byte("TEST_VAR1=value1"), "testpassword", opts); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("EncryptWithOptions() error = %v, want %v", err, ErrUnsupported)
+	}
+
+	encrypted, err := Encrypt([]byte("TEST_VAR1=value1"), "testpassword")
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	// 長さを変えずに未知の暗号方式に書き換える
+	tampered := bytes.Replace(encrypted, []byte(`"cipher":"aes-256-gcm"`), []byte(`"cipher":"aes-256-xyz"`), 1)
+	if _, err := Decrypt(tampered, "testpassword"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Decrypt() error = %v, want %v", err, ErrUnsupported)
+	}
+}
@@ -3,74 +3,134 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
 	"errors"
 	"fmt"
-	"io"
 
+	"github.com/uzulla/envault/pkg/secret"
 	"golang.org/x/crypto/argon2"
 )
 
 const (
-	MagicBytes = "ENVAULT1"
-	
+	MagicBytes   = "ENVAULT2"
+	MagicBytesV1 = "ENVAULT1" // 旧形式（読み込みのみ対応）
+
+	FormatVersion = 2
+
+	KDFArgon2id     = "argon2id"
+	CipherAES256GCM = "aes-256-gcm"
+
 	KeyLength  = 32 // AES-256-GCM用の32バイト鍵
 	NonceSize  = 12 // GCMの標準nonce長
 	SaltLength = 16 // 鍵導出用のソルト長
-	
+
+	// 新規に暗号化する際のArgon2idのデフォルトパラメータ
 	ArgonTime    = 1
 	ArgonMemory  = 64 * 1024
 	ArgonThreads = 4
+
+	// 細工されたヘッダで過大なリソースを消費しないための上限
+	maxArgonTime   = 64
+	maxArgonMemory = 4 * 1024 * 1024
 )
 
 var (
 	ErrInvalidFile      = errors.New("無効なファイル形式です")
 	ErrDecryptionFailed = errors.New("復号化に失敗しました。パスワードが間違っている可能性があります")
+	ErrUnsupported      = errors.New("未対応の暗号化方式です")
+
+	// ErrInvalidFile の詳細な理由です（errors.Is で ErrInvalidFile としても判定できます）
+	ErrTruncatedFile  = fmt.Errorf("%w: ファイルが途中で切れています", ErrInvalidFile)
+	ErrBadMagic       = fmt.Errorf("%w: envaultの暗号化ファイルではありません（先頭のマジックバイトが一致しません）", ErrInvalidFile)
+	ErrUnknownVersion = fmt.Errorf("%w: 未対応のバージョンです", ErrInvalidFile)
+	ErrCorruptedFile  = fmt.Errorf("%w: 暗号文が途中で切れているか、改ざんされています", ErrInvalidFile)
 )
 
-func Encrypt(data []byte, password string) ([]byte, error) {
-	salt := make([]byte, SaltLength)
-	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
-		return nil, fmt.Errorf("ソルトの生成に失敗しました: %w", err)
+// Options は暗号化時のパラメータです
+type Options struct {
+	ArgonTime    uint32
+	ArgonMemory  uint32
+	ArgonThreads uint8
+	// Cipher は本文の暗号方式です（空の場合は AES-256-GCM）
+	Cipher string
+}
+
+// DefaultOptions はデフォルトの暗号化パラメータを返します
+func DefaultOptions() Options {
+	return Options{
+		ArgonTime:    ArgonTime,
+		ArgonMemory:  ArgonMemory,
+		ArgonThreads: ArgonThreads,
+		Cipher:       CipherAES256GCM,
 	}
+}
 
-	key := deriveKey(password, salt)
+// Encrypt はデフォルトのパラメータでデータを暗号化します
+func Encrypt(data []byte, password string) ([]byte, error) {
+	return EncryptWithOptions(data, password, DefaultOptions())
+}
 
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("AESブロック暗号の初期化に失敗しました: %w", err)
-	}
+// EncryptWithOptions はランダムなデータ鍵でデータをENVAULT2形式に暗号化し、
+// データ鍵を指定したパラメータのパスワードスロットに格納します
+func EncryptWithOptions(data []byte, password string, opts Options) ([]byte, error) {
+	return EncryptToRecipientsWithOptions(data, []Recipient{NewPasswordRecipient(password, opts)}, EncryptOptions{Cipher: opts.Cipher})
+}
 
-	aesGCM, err := cipher.NewGCM(block)
+// Decrypt は暗号化されたデータを復号化します
+// パスワードスロットを順に試します。旧形式のENVAULT1、KDFをヘッダに持つENVAULT2、
+// scryptパスフレーズで暗号化されたage形式、値ごとに暗号化した構造化形式にも対応しています
+// ASCII armor形式のデータはarmorを外してから復号化します
+func Decrypt(encryptedData []byte, password string) ([]byte, error) {
+	pw := secret.FromString(password)
+	defer pw.Destroy()
+	return decryptWithPassword(encryptedData, pw)
+}
+
+func decryptWithPassword(encryptedData []byte, password *secret.Buffer) ([]byte, error) {
+	encryptedData, err := decodeVault(encryptedData)
 	if err != nil {
-		return nil, fmt.Errorf("GCMモードの初期化に失敗しました: %w", err)
+		return nil, err
 	}
 
-	nonce := make([]byte, aesGCM.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, fmt.Errorf("nonceの生成に失敗しました: %w", err)
+	identity := NewPasswordIdentityFromSecret(password)
+	switch DetectFormat(encryptedData) {
+	case FormatAge:
+		return decryptAge(encryptedData, []Identity{identity})
+	case FormatStructured:
+		return decryptStructured(encryptedData, []Identity{identity})
+	}
+	if len(encryptedData) >= len(MagicBytesV1) && string(encryptedData[:len(MagicBytesV1)]) == MagicBytesV1 {
+		return decryptV1(encryptedData, password)
 	}
 
-	ciphertext := aesGCM.Seal(nil, nonce, data, nil)
+	header, aad, ciphertext, err := parseHeader(encryptedData)
+	if err != nil {
+		return nil, err
+	}
 
-	result := []byte(MagicBytes)
-	result = append(result, salt...)
-	result = append(result, nonce...)
-	result = append(result, ciphertext...)
+	if header.KDF == nil {
+		v, err := openWithIdentities(encryptedData, []Identity{identity})
+		if err != nil {
+			return nil, err
+		}
+		secret.Wipe(v.dataKey)
+		return v.plaintext, nil
+	}
+	if err := validateKDFParams(header.KDF); err != nil {
+		return nil, err
+	}
 
-	return result, nil
+	key := deriveKey(password.Bytes(), header.KDF)
+	defer key.Destroy()
+	return openBody(header, key.Bytes(), aad, ciphertext)
 }
 
-func Decrypt(encryptedData []byte, password string) ([]byte, error) {
-	if len(encryptedData) < len(MagicBytes)+SaltLength+NonceSize {
-		return nil, ErrInvalidFile
-	}
-
-	if string(encryptedData[:len(MagicBytes)]) != MagicBytes {
-		return nil, ErrInvalidFile
+// 旧形式（ENVAULT1 + ソルト + nonce + 暗号文）のデータを復号化します
+func decryptV1(encryptedData []byte, password *secret.Buffer) ([]byte, error) {
+	if len(encryptedData) < len(MagicBytesV1)+SaltLength+NonceSize+gcmTagSize {
+		return nil, ErrTruncatedFile
 	}
 
-	offset := len(MagicBytes)
+	offset := len(MagicBytesV1)
 	salt := encryptedData[offset : offset+SaltLength]
 	offset += SaltLength
 
@@ -79,8 +139,30 @@ func Decrypt(encryptedData []byte, password string) ([]byte, error) {
 
 	ciphertext := encryptedData[offset:]
 
-	key := deriveKey(password, salt)
+	// ENVAULT1はパラメータを記録していないため、当時の固定値を使用する
+	key := deriveKey(password.Bytes(), &KDFParams{
+		ID:      KDFArgon2id,
+		Time:    1,
+		Memory:  64 * 1024,
+		Threads: 4,
+		Salt:    salt,
+	})
+	defer key.Destroy()
+
+	aesGCM, err := newGCM(key.Bytes())
+	if err != nil {
+		return nil, err
+	}
 
+	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, fmt.Errorf("AESブロック暗号の初期化に失敗しました: %w", err)
@@ -91,21 +173,39 @@ func Decrypt(encryptedData []byte, password string) ([]byte, error) {
 		return nil, fmt.Errorf("GCMモードの初期化に失敗しました: %w", err)
 	}
 
-	plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, ErrDecryptionFailed
-	}
+	return aesGCM, nil
+}
 
-	return plaintext, nil
+// KDFパラメータが使用可能な範囲にあるか確認します
+func validateKDFParams(p *KDFParams) error {
+	if p.ID != KDFArgon2id {
+		return fmt.Errorf("%w: KDF %q", ErrUnsupported, p.ID)
+	}
+	if p.Time < 1 || p.Time > maxArgonTime {
+		return fmt.Errorf("Argon2idのtimeパラメータが範囲外です: %d", p.Time)
+	}
+	if p.Threads < 1 {
+		return fmt.Errorf("Argon2idのthreadsパラメータが範囲外です: %d", p.Threads)
+	}
+	if p.Memory < 8*uint32(p.Threads) || p.Memory > maxArgonMemory {
+		return fmt.Errorf("Argon2idのmemoryパラメータが範囲外です: %d", p.Memory)
+	}
+	if len(p.Salt) < SaltLength {
+		return fmt.Errorf("ソルトが短すぎます: %dバイト", len(p.Salt))
+	}
+	return nil
 }
 
-func deriveKey(password string, salt []byte) []byte {
-	return argon2.IDKey(
-		[]byte(password),
-		salt,
-		ArgonTime,
-		ArgonMemory,
-		ArgonThreads,
+// deriveKey は input から鍵を導出します。使用後は呼び出し側で Destroy してください
+func deriveKey(input []byte, p *KDFParams) *secret.Buffer {
+	key := argon2.IDKey(
+		input,
+		p.Salt,
+		p.Time,
+		p.Memory,
+		p.Threads,
 		KeyLength,
 	)
+	defer secret.Wipe(key)
+	return secret.FromBytes(key)
 }
@@ -2,8 +2,11 @@ package crypto
 
 import (
 	"bytes"
+	"errors"
 	"strings"
 	"testing"
+
+	"github.com/uzulla/envault/internal/armor"
 )
 
 func TestEncryptDecrypt(t *testing.T) {
@@ -29,6 +32,40 @@ func TestEncryptDecrypt(t *testing.T) {
 	}
 }
 
+func TestDecryptArmored(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1\nTEST_VAR2=value2")
+	password := "testpassword"
+
+	encrypted, err := Encrypt(testData, password)
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	armored := armor.Encode(encrypted)
+
+	if DetectFormat(armored) != FormatEnvault2 {
+		t.Errorf("DetectFormat() = %v, want %v", DetectFormat(armored), FormatEnvault2)
+	}
+	if _, err := ParseHeader(armored); err != nil {
+		t.Errorf("ParseHeader() error = %v", err)
+	}
+
+	decrypted, err := Decrypt(armored, password)
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if !bytes.Equal(testData, decrypted) {
+		t.Errorf("Decrypt() = %q, want %q", decrypted, testData)
+	}
+
+	decrypted, err = DecryptWithIdentities(armored, []Identity{NewPasswordIdentity(password)})
+	if err != nil {
+		t.Fatalf("DecryptWithIdentities() error = %v", err)
+	}
+	if !bytes.Equal(testData, decrypted) {
+		t.Errorf("DecryptWithIdentities() = %q, want %q", decrypted, testData)
+	}
+}
+
 func TestDecryptWithWrongPassword(t *testing.T) {
 	testData := []byte("TEST_VAR1=value1\nTEST_VAR2=value2")
 	password := "correctpassword"
@@ -58,8 +95,38 @@ func TestInvalidEncryptedData(t *testing.T) {
 		t.Errorf("無効なデータの復号化が成功しました")
 	}
 
-	if err != ErrInvalidFile {
-		t.Errorf("期待されるエラーが返されませんでした。期待: %v, 実際: %v", ErrInvalidFile, err)
+	if !errors.Is(err, ErrInvalidFile) || !errors.Is(err, ErrBadMagic) {
+		t.Errorf("期待されるエラーが返されませんでした。期待: %v, 実際: %v", ErrBadMagic, err)
+	}
+}
+
+func TestInvalidFileDiagnostics(t *testing.T) {
+	password := "testpassword"
+	encrypted, err := Encrypt([]byte("TEST_VAR1=value1"), password)
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"マジックバイトの途中で切れている", encrypted[:4], ErrTruncatedFile},
+		{"ヘッダ長の途中で切れている", encrypted[:len(MagicBytes)+2], ErrTruncatedFile},
+		{"ヘッダの途中で切れている", encrypted[:len(MagicBytes)+headerLengthSize+10], ErrTruncatedFile},
+		{"暗号文が切れている", encrypted[:len(encrypted)-len("TEST_VAR1=value1")-gcmTagSize+1], ErrTruncatedFile},
+		{"別の形式のファイル", []byte("PK\x03\x04 zip file"), ErrBadMagic},
+		{"将来のバージョン", append([]byte("ENVAULT3"), encrypted[len(MagicBytes):]...), ErrUnknownVersion},
+		{"ヘッダのバージョン", bytes.Replace(encrypted, []byte(`"version":2`), []byte(`"version":9`), 1), ErrUnknownVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decrypt(tt.data, password)
+			if !errors.Is(err, tt.wantErr) || !errors.Is(err, ErrInvalidFile) {
+				t.Errorf("Decrypt() error = %v, want %v", err, tt.wantErr)
+			}
+		})
 	}
 }
 
@@ -90,3 +157,149 @@ func TestEncryptionStrength(t *testing.T) {
 		t.Errorf("2回の暗号化結果が同じです。ソルトまたはnonceがランダムでない可能性があります")
 	}
 }
+
+// 旧形式（ENVAULT1）のデータをテスト用に作成します
+func encryptV1ForTest(t *testing.T, data []byte, password string) []byte {
+	t.Helper()
+
+	salt := bytes.Repeat([]byte{0x01}, SaltLength)
+	nonce := bytes.Repeat([]byte{0x02}, NonceSize)
+	key := deriveKey([]byte(password), &KDFParams{ID: KDFArgon2id, Time: 1, Memory: 64 * 1024, Threads: 4, Salt: salt})
+	defer key.Destroy()
+
+	aesGCM, err := newGCM(key.Bytes())
+	if err != nil {
+		t.Fatalf("GCMの初期化に失敗しました: %v", err)
+	}
+
+	result := []byte(MagicBytesV1)
+	result = append(result, salt...)
+	result = append(result, nonce...)
+	return aesGCM.Seal(result, nonce, data, nil)
+}
+
+func TestDecryptLegacyV1(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1\nTEST_VAR2=value2")
+	password := "testpassword"
+
+	decrypted, err := Decrypt(encryptV1ForTest(t, testData, password), password)
+	if err != nil {
+		t.Fatalf("ENVAULT1形式の復号化に失敗しました: %v", err)
+	}
+
+	if !bytes.Equal(testData, decrypted) {
+		t.Errorf("復号化されたデータが元のデータと一致しません\n元のデータ: %s\n復号化されたデータ: %s", testData, decrypted)
+	}
+}
+
+// KDFをヘッダに直接持つENVAULT2形式のデータをテスト用に作成します
+func encryptDirectKDFForTest(t *testing.T, data []byte, password string) []byte {
+	t.Helper()
+	return encryptDirectKDFWithParamsForTest(t, data, password, &KDFParams{ID: KDFArgon2id, Time: 1, Memory: 64 * 1024, Threads: 4})
+}
+
+// 指定したKDFパラメータでKDFをヘッダに直接持つENVAULT2形式のデータを作成します
+func encryptDirectKDFWithParamsForTest(t *testing.T, data []byte, password string, kdf *KDFParams) []byte {
+	t.Helper()
+
+	kdf.Salt = bytes.Repeat([]byte{0x03}, SaltLength)
+	nonce := bytes.Repeat([]byte{0x04}, NonceSize)
+	header, err := marshalHeader(&Header{Version: FormatVersion, KDF: kdf, Cipher: CipherAES256GCM, Nonce: nonce})
+	if err != nil {
+		t.Fatalf("ヘッダの作成に失敗しました: %v", err)
+	}
+
+	key := deriveKey([]byte(password), kdf)
+	defer key.Destroy()
+	aesGCM, err := newGCM(key.Bytes())
+	if err != nil {
+		t.Fatalf("GCMの初期化に失敗しました: %v", err)
+	}
+	return aesGCM.Seal(header, nonce, data, header)
+}
+
+func TestDecryptDirectKDF(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1")
+	password := "testpassword"
+	encrypted := encryptDirectKDFForTest(t, testData, password)
+
+	decrypted, err := Decrypt(encrypted, password)
+	if err != nil {
+		t.Fatalf("復号化に失敗しました: %v", err)
+	}
+	if !bytes.Equal(testData, decrypted) {
+		t.Errorf("復号化されたデータが元のデータと一致しません")
+	}
+
+	if _, err := Decrypt(encrypted, "wrongpassword"); err != ErrDecryptionFailed {
+		t.Errorf("期待されるエラーが返されませんでした。期待: %v, 実際: %v", ErrDecryptionFailed, err)
+	}
+}
+
+func TestEncryptWithOptionsRecordsParams(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1")
+	password := "testpassword"
+	opts := Options{ArgonTime: 2, ArgonMemory: 32 * 1024, ArgonThreads: 2}
+
+	encrypted, err := EncryptWithOptions(testData, password, opts)
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	header, _, _, err := parseHeader(encrypted)
+	if err != nil {
+		t.Fatalf("ヘッダの読み取りに失敗しました: %v", err)
+	}
+
+	if len(header.Slots) != 1 || header.Slots[0].Type != SlotTypePassword {
+		t.Fatalf("ヘッダにパスワードスロットが記録されていません: %+v", header.Slots)
+	}
+	kdf := header.Slots[0].KDF
+	if kdf.ID != KDFArgon2id || kdf.Time != 2 || kdf.Memory != 32*1024 || kdf.Threads != 2 {
+		t.Errorf("ヘッダのKDFパラメータが期待と異なります: %+v", kdf)
+	}
+	if header.Cipher != CipherAES256GCM {
+		t.Errorf("ヘッダの暗号方式が期待と異なります: %s", header.Cipher)
+	}
+
+	decrypted, err := Decrypt(encrypted, password)
+	if err != nil {
+		t.Fatalf("復号化に失敗しました: %v", err)
+	}
+	if !bytes.Equal(testData, decrypted) {
+		t.Errorf("復号化されたデータが元のデータと一致しません")
+	}
+}
+
+func TestHeaderTampering(t *testing.T) {
+	password := "testpassword"
+
+	encrypted, err := Encrypt([]byte("TEST_VAR1=value1"), password)
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	// ヘッダ内のthreadsパラメータを書き換えても復号化できないこと
+	tampered := bytes.Replace(encrypted, []byte(`"threads":4`), []byte(`"threads":2`), 1)
+	if bytes.Equal(tampered, encrypted) {
+		t.Fatalf("ヘッダの書き換えに失敗しました")
+	}
+
+	if _, err := Decrypt(tampered, password); err != ErrDecryptionFailed {
+		t.Errorf("改ざんされたヘッダで期待されるエラーが返されませんでした。期待: %v, 実際: %v", ErrDecryptionFailed, err)
+	}
+}
+
+func TestUnknownVersion(t *testing.T) {
+	password := "testpassword"
+
+	encrypted, err := Encrypt([]byte("TEST_VAR1=value1"), password)
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	tampered := bytes.Replace(encrypted, []byte(`"version":2`), []byte(`"version":9`), 1)
+	if _, err := Decrypt(tampered, password); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("未対応のバージョンで期待されるエラーが返されませんでした。実際: %v", err)
+	}
+}
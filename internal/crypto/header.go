@@ -0,0 +1,113 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// ヘッダ長フィールドのバイト数（ビッグエンディアンのuint32）
+	headerLengthSize = 4
+	// 壊れたファイルで巨大なメモリを確保しないためのヘッダ長の上限
+	maxHeaderLength = 1 << 20
+	// GCMの認証タグのバイト数（暗号文の最小の長さ）
+	gcmTagSize = 16
+	// マジックバイトのバージョン番号を除いた部分
+	magicPrefix = "ENVAULT"
+)
+
+// KDFParams は鍵導出関数の種類とパラメータを表します
+type KDFParams struct {
+	ID      string `json:"id"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Salt    []byte `json:"salt"`
+	KeyFile bool   `json:"key_file,omitempty"` // パスワードとキーファイルを組み合わせて鍵を導出する
+}
+
+// Header はENVAULT2形式のファイルヘッダです
+// ヘッダ全体（マジックバイトと長さを含む）は暗号文の追加認証データとして使用されます
+type Header struct {
+	Version int        `json:"version"`
+	KDF     *KDFParams `json:"kdf,omitempty"`
+	Cipher  string     `json:"cipher"`
+	Nonce   []byte     `json:"nonce"`
+	Slots   []Slot     `json:"slots,omitempty"`
+
+	// 本文をチャンクに分けて暗号化している場合の平文のチャンク長（0の場合は本文全体を1回で暗号化した旧形式）
+	// チャンク形式ではNonceはチャンクのnonceの接頭辞になります
+	ChunkSize int `json:"chunk_size,omitempty"`
+
+	// 構造化形式でキー名をHMACで置き換えているかどうか
+	HashedKeys bool `json:"hashed_keys,omitempty"`
+
+	// 平文で記録するメタデータ（ヘッダの一部として認証されます）
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// ヘッダをシリアライズし、マジックバイトと長さを付けたバイト列を返します
+func marshalHeader(h *Header) ([]byte, error) {
+	body, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("ヘッダのエンコードに失敗しました: %w", err)
+	}
+
+	result := make([]byte, 0, len(MagicBytes)+headerLengthSize+len(body))
+	result = append(result, MagicBytes...)
+	result = binary.BigEndian.AppendUint32(result, uint32(len(body)))
+	result = append(result, body...)
+
+	return result, nil
+}
+
+// ENVAULT2形式のデータからヘッダを読み取ります
+// 戻り値のrawはヘッダ部分のバイト列（追加認証データ）で、restは残りの暗号文です
+// 暗号文の長さはここでは確認しないため、ヘッダ部分だけのデータも読み取れます
+func parseHeader(data []byte) (h *Header, raw []byte, rest []byte, err error) {
+	if err := checkMagic(data); err != nil {
+		return nil, nil, nil, err
+	}
+
+	prefixLen := len(MagicBytes) + headerLengthSize
+	if len(data) < prefixLen {
+		return nil, nil, nil, ErrTruncatedFile
+	}
+
+	headerLen := binary.BigEndian.Uint32(data[len(MagicBytes):prefixLen])
+	if headerLen > maxHeaderLength {
+		return nil, nil, nil, fmt.Errorf("%w: ヘッダ長が不正です (%d バイト)", ErrInvalidFile, headerLen)
+	}
+	if uint64(len(data)) < uint64(prefixLen)+uint64(headerLen) {
+		return nil, nil, nil, ErrTruncatedFile
+	}
+
+	end := prefixLen + int(headerLen)
+	h = &Header{}
+	if err := json.Unmarshal(data[prefixLen:end], h); err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: ヘッダを読み取れません", ErrInvalidFile)
+	}
+
+	if h.Version != FormatVersion {
+		return nil, nil, nil, fmt.Errorf("%w (%d)", ErrUnknownVersion, h.Version)
+	}
+
+	return h, data[:end], data[end:], nil
+}
+
+// ENVAULT2形式のマジックバイトを確認し、一致しない場合はその理由を返します
+func checkMagic(data []byte) error {
+	switch {
+	case bytes.HasPrefix(data, []byte(MagicBytes)):
+		return nil
+	case len(data) < len(MagicBytes) && bytes.HasPrefix([]byte(MagicBytes), data):
+		return ErrTruncatedFile
+	case bytes.HasPrefix(data, []byte(magicPrefix)) && len(data) >= len(MagicBytes):
+		// ENVAULT3 など、将来のバージョンのファイル
+		return fmt.Errorf("%w (%s)", ErrUnknownVersion, data[:len(MagicBytes)])
+	default:
+		return ErrBadMagic
+	}
+}
@@ -0,0 +1,230 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/uzulla/envault/internal/armor"
+)
+
+// VaultInfo は暗号化ファイルを復号化せずに読み取れる情報です
+type VaultInfo struct {
+	Format         string     `json:"format"`
+	Armored        bool       `json:"armored"`
+	Version        int        `json:"version,omitempty"`
+	Cipher         string     `json:"cipher,omitempty"`
+	FileSize       int        `json:"file_size"`
+	HeaderSize     int        `json:"header_size"`
+	CiphertextSize int        `json:"ciphertext_size"`
+	ChunkSize      int        `json:"chunk_size,omitempty"`
+	KDF            *KDFInfo   `json:"kdf,omitempty"` // パスワードで直接暗号化された形式のKDF
+	Slots          []SlotInfo `json:"slots,omitempty"`
+	Entries        int        `json:"entries,omitempty"` // 構造化形式の変数の数
+	HashedKeys     bool       `json:"hashed_keys,omitempty"`
+	Metadata       *Metadata  `json:"metadata,omitempty"`
+	Signers        []string   `json:"signers,omitempty"`
+}
+
+// KDFInfo は鍵導出関数のパラメータです（ソルトは長さのみ）
+type KDFInfo struct {
+	ID         string `json:"id"`
+	Time       uint32 `json:"time,omitempty"`
+	Memory     uint32 `json:"memory,omitempty"`
+	Threads    uint8  `json:"threads,omitempty"`
+	LogN       int    `json:"log_n,omitempty"` // age形式のscryptのコストパラメータ
+	SaltLength int    `json:"salt_length"`
+	KeyFile    bool   `json:"key_file,omitempty"`
+}
+
+// SlotInfo はキースロット（age形式では受信者スタンザ）の情報です
+type SlotInfo struct {
+	Type        string   `json:"type"`
+	Fingerprint string   `json:"fingerprint,omitempty"`
+	Recipient   string   `json:"recipient,omitempty"`
+	KDF         *KDFInfo `json:"kdf,omitempty"`
+}
+
+// Inspect は暗号化ファイルのヘッダを読み取り、形式・パラメータ・キースロット・メタデータを返します
+// 復号化は行わないため、パスワードや秘密鍵は必要ありません
+// 読み取れないファイルの場合は ErrTruncatedFile、ErrBadMagic、ErrUnknownVersion などの詳細なエラーを返します
+func Inspect(data []byte) (*VaultInfo, error) {
+	info := &VaultInfo{}
+	if armor.IsArmored(data) {
+		decoded, err := armor.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+		data = decoded
+		info.Armored = true
+	}
+	info.FileSize = len(data)
+
+	// 埋め込み署名はこの時点では検証しません（署名者のフィンガープリントのみ）
+	data, signatures, err := SplitSignatures(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range signatures {
+		info.Signers = append(info.Signers, s.Signer.Fingerprint())
+	}
+
+	switch DetectFormat(data) {
+	case FormatEnvault1:
+		err = inspectEnvault1(info, data)
+	case FormatEnvault2:
+		err = inspectEnvault2(info, data)
+	case FormatStructured:
+		err = inspectStructured(info, data)
+	case FormatAge:
+		err = inspectAge(info, data)
+	default:
+		// マジックバイトの途中で切れている場合や、将来のバージョンの場合を区別する
+		err = checkMagic(data)
+		if err == nil {
+			err = ErrBadMagic
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func inspectEnvault1(info *VaultInfo, data []byte) error {
+	headerSize := len(MagicBytesV1) + SaltLength + NonceSize
+	if len(data) < headerSize+gcmTagSize {
+		return ErrTruncatedFile
+	}
+
+	info.Format = FormatEnvault1.String()
+	info.Version = 1
+	info.Cipher = CipherAES256GCM
+	info.HeaderSize = headerSize
+	info.CiphertextSize = len(data) - headerSize
+	// ENVAULT1はパラメータを記録していないため、当時の固定値
+	info.KDF = &KDFInfo{ID: KDFArgon2id, Time: 1, Memory: 64 * 1024, Threads: 4, SaltLength: SaltLength}
+	return nil
+}
+
+func inspectEnvault2(info *VaultInfo, data []byte) error {
+	header, raw, rest, err := parseHeader(data)
+	if err != nil {
+		return err
+	}
+	if len(rest) < gcmTagSize {
+		return ErrTruncatedFile
+	}
+
+	info.Format = FormatEnvault2.String()
+	info.HeaderSize = len(raw)
+	info.CiphertextSize = len(rest)
+	fillHeaderInfo(info, header)
+	return nil
+}
+
+func inspectStructured(info *VaultInfo, data []byte) error {
+	header, err := parseStructuredHeader(data)
+	if err != nil {
+		return err
+	}
+
+	signed, _, err := splitStructuredMAC(data)
+	if err != nil {
+		return err
+	}
+
+	info.Format = FormatStructured.String()
+	lines := bytes.SplitAfter(signed, []byte("\n"))
+	for i, line := range lines {
+		if i < 2 {
+			// マジックとヘッダの行
+			info.HeaderSize += len(line)
+			continue
+		}
+		if len(line) == 0 || bytes.HasPrefix(line, []byte("#")) {
+			continue
+		}
+		info.Entries++
+		info.CiphertextSize += len(line)
+	}
+	fillHeaderInfo(info, header)
+	return nil
+}
+
+func fillHeaderInfo(info *VaultInfo, header *Header) {
+	info.Version = header.Version
+	info.Cipher = header.Cipher
+	info.ChunkSize = header.ChunkSize
+	info.HashedKeys = header.HashedKeys
+	info.Metadata = header.Metadata
+	info.KDF = kdfInfo(header.KDF)
+	for i := range header.Slots {
+		slot := &header.Slots[i]
+		info.Slots = append(info.Slots, SlotInfo{
+			Type:        slot.Type,
+			Fingerprint: slot.Fingerprint(),
+			Recipient:   slot.Recipient,
+			KDF:         kdfInfo(slot.KDF),
+		})
+	}
+}
+
+func kdfInfo(p *KDFParams) *KDFInfo {
+	if p == nil {
+		return nil
+	}
+	return &KDFInfo{
+		ID:         p.ID,
+		Time:       p.Time,
+		Memory:     p.Memory,
+		Threads:    p.Threads,
+		SaltLength: len(p.Salt),
+		KeyFile:    p.KeyFile,
+	}
+}
+
+// age形式のヘッダ（「-> 種類 引数...」のスタンザと「--- MAC」の行）を読み取ります
+func inspectAge(info *VaultInfo, data []byte) error {
+	rest := data[len(AgeMagic):]
+	for {
+		line, next, found := bytes.Cut(rest, []byte("\n"))
+		if !found {
+			return fmt.Errorf("%w: ageのヘッダが終わっていません", ErrTruncatedFile)
+		}
+		rest = next
+
+		switch {
+		case bytes.HasPrefix(line, []byte("--- ")):
+			info.Format = FormatAge.String()
+			info.Version = 1
+			info.Cipher = "chacha20-poly1305"
+			info.HeaderSize = len(data) - len(rest)
+			info.CiphertextSize = len(rest)
+			return nil
+		case bytes.HasPrefix(line, []byte("-> ")):
+			args := strings.Fields(string(line[len("-> "):]))
+			if len(args) == 0 {
+				return fmt.Errorf("%w: ageのスタンザを読み取れません", ErrInvalidFile)
+			}
+			info.Slots = append(info.Slots, ageStanzaInfo(args))
+		}
+		// それ以外の行はスタンザの本文（base64）
+	}
+}
+
+func ageStanzaInfo(args []string) SlotInfo {
+	slot := SlotInfo{Type: args[0]}
+	switch {
+	case args[0] == "scrypt" && len(args) == 3:
+		salt, _ := base64.RawStdEncoding.DecodeString(args[1])
+		logN, _ := strconv.Atoi(args[2])
+		slot.KDF = &KDFInfo{ID: "scrypt", LogN: logN, SaltLength: len(salt)}
+	case strings.HasPrefix(args[0], "ssh-") && len(args) >= 2:
+		// SSH公開鍵のハッシュの先頭4バイト（age形式のタグ）
+		slot.Fingerprint = args[1]
+	}
+	return slot
+}
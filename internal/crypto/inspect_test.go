@@ -0,0 +1,120 @@
+package crypto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/uzulla/envault/internal/armor"
+)
+
+func TestInspectEnvault2(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1\n")
+	id, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("秘密鍵の生成に失敗しました: %v", err)
+	}
+	recipients := []Recipient{NewPasswordRecipient("test-password", DefaultOptions()), id.Recipient()}
+
+	encrypted, err := EncryptToRecipientsWithOptions(testData, recipients, EncryptOptions{Metadata: testMetadata()})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	for _, data := range [][]byte{encrypted, armor.Encode(encrypted)} {
+		info, err := Inspect(data)
+		if err != nil {
+			t.Fatalf("Inspect() error = %v", err)
+		}
+		if info.Format != "envault2" || info.Version != FormatVersion || info.Cipher != CipherAES256GCM {
+			t.Errorf("Inspect() = %+v", info)
+		}
+		if info.Armored != armor.IsArmored(data) {
+			t.Errorf("Inspect().Armored = %v", info.Armored)
+		}
+		if info.HeaderSize+info.CiphertextSize != len(encrypted) || info.CiphertextSize != len(testData)+gcmTagSize {
+			t.Errorf("サイズが一致しません: header=%d ciphertext=%d file=%d", info.HeaderSize, info.CiphertextSize, len(encrypted))
+		}
+		if len(info.Slots) != 2 {
+			t.Fatalf("len(Slots) = %d, want 2", len(info.Slots))
+		}
+		if kdf := info.Slots[0].KDF; info.Slots[0].Type != SlotTypePassword || kdf == nil || kdf.SaltLength != SaltLength || kdf.Memory != ArgonMemory {
+			t.Errorf("パスワードスロット = %+v", info.Slots[0])
+		}
+		if info.Slots[1].Type != SlotTypeX25519 || info.Slots[1].Fingerprint != Fingerprint(id.Recipient().String()) {
+			t.Errorf("X25519スロット = %+v", info.Slots[1])
+		}
+		if info.Metadata == nil || info.Metadata.Environment != "production" {
+			t.Errorf("Metadata = %+v", info.Metadata)
+		}
+	}
+}
+
+func TestInspectOtherFormats(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1\n")
+	password := "test-password"
+
+	v1 := encryptV1ForTest(t, testData, password)
+	info, err := Inspect(v1)
+	if err != nil {
+		t.Fatalf("Inspect(ENVAULT1) error = %v", err)
+	}
+	if info.Format != "envault1" || info.KDF == nil || info.KDF.SaltLength != SaltLength {
+		t.Errorf("Inspect(ENVAULT1) = %+v", info)
+	}
+
+	structured, err := EncryptStructured([]StructuredEntry{{Key: "A", Value: "1"}, {Key: "B", Value: "2"}},
+		[]Recipient{NewPasswordRecipient(password, DefaultOptions())}, StructuredOptions{HashKeys: true})
+	if err != nil {
+		t.Fatalf("EncryptStructured() error = %v", err)
+	}
+	info, err = Inspect(structured)
+	if err != nil {
+		t.Fatalf("Inspect(structured) error = %v", err)
+	}
+	if info.Format != "structured" || info.Entries != 2 || !info.HashedKeys || len(info.Slots) != 1 {
+		t.Errorf("Inspect(structured) = %+v", info)
+	}
+	if _, err := Inspect(structured[:len(structured)-20]); !errors.Is(err, ErrTruncatedFile) {
+		t.Errorf("Inspect(切れた構造化形式) error = %v, want %v", err, ErrTruncatedFile)
+	}
+
+	age, err := EncryptAge(testData, []Recipient{NewPasswordRecipient(password, DefaultOptions())})
+	if err != nil {
+		t.Fatalf("EncryptAge() error = %v", err)
+	}
+	info, err = Inspect(age)
+	if err != nil {
+		t.Fatalf("Inspect(age) error = %v", err)
+	}
+	if info.Format != "age" || len(info.Slots) != 1 || info.Slots[0].Type != "scrypt" || info.Slots[0].KDF == nil || info.Slots[0].KDF.LogN == 0 {
+		t.Errorf("Inspect(age) = %+v", info)
+	}
+	if _, err := Inspect(age[:len(AgeMagic)+10]); !errors.Is(err, ErrTruncatedFile) {
+		t.Errorf("Inspect(切れたage形式) error = %v, want %v", err, ErrTruncatedFile)
+	}
+}
+
+func TestInspectDiagnostics(t *testing.T) {
+	encrypted, err := Encrypt([]byte("TEST_VAR1=value1"), "test-password")
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"マジックバイトの途中で切れている", []byte("ENVA"), ErrTruncatedFile},
+		{"ヘッダの途中で切れている", encrypted[:40], ErrTruncatedFile},
+		{"別の形式のファイル", []byte("TEST_VAR1=value1\n"), ErrBadMagic},
+		{"将来のバージョン", append([]byte("ENVAULT9"), encrypted[len(MagicBytes):]...), ErrUnknownVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Inspect(tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Inspect() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
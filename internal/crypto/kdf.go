@@ -0,0 +1,127 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// 新しいパスワードスロットに使用できるArgon2idパラメータの下限
+	// OWASPの推奨値（memory 19MiB・time 2、または memory 46MiB・time 1 など）を下回らないようにします
+	MinArgonTime    = 1
+	MinArgonMemory  = 19 * 1024
+	MinArgonThreads = 1
+	// memory（KiB）× time の下限（19MiB × 2 に相当）
+	minArgonCost = 2 * MinArgonMemory
+
+	// ベンチマークで試すメモリ使用量の初期値と上限の既定値（KiB）
+	benchmarkStartMemory      = ArgonMemory
+	DefaultBenchmarkMaxMemory = 1024 * 1024
+)
+
+var (
+	ErrWeakKDFParams = errors.New("Argon2idのパラメータが弱すぎます")
+)
+
+// Validate は新しいパスワードスロットに使用するArgon2idのパラメータが下限を満たしているか確認します
+// 既存のファイルを開く場合は、下限を下回るパラメータでも復号化できます
+func (o Options) Validate() error {
+	if o.ArgonTime < MinArgonTime || o.ArgonTime > maxArgonTime {
+		return fmt.Errorf("Argon2idのtimeは%d〜%dの範囲で指定してください: %d", MinArgonTime, maxArgonTime, o.ArgonTime)
+	}
+	if o.ArgonThreads < MinArgonThreads {
+		return fmt.Errorf("Argon2idのthreadsは%d以上を指定してください: %d", MinArgonThreads, o.ArgonThreads)
+	}
+	if o.ArgonMemory > maxArgonMemory {
+		return fmt.Errorf("Argon2idのmemoryは%dKiB以下を指定してください: %d", maxArgonMemory, o.ArgonMemory)
+	}
+	if o.ArgonMemory < MinArgonMemory {
+		return fmt.Errorf("%w: memoryは%dKiB以上を指定してください（指定値 %dKiB）", ErrWeakKDFParams, MinArgonMemory, o.ArgonMemory)
+	}
+	if uint64(o.ArgonMemory)*uint64(o.ArgonTime) < minArgonCost {
+		minTime := (minArgonCost + o.ArgonMemory - 1) / o.ArgonMemory
+		return fmt.Errorf("%w: memoryが%dKiBの場合、timeは%d以上を指定してください", ErrWeakKDFParams, o.ArgonMemory, minTime)
+	}
+	return nil
+}
+
+// KDFBenchmarkResult はベンチマークで測定したパラメータと所要時間です
+type KDFBenchmarkResult struct {
+	Options  Options
+	Duration time.Duration
+}
+
+// BenchmarkKDF はこのマシンで指定したパラメータの鍵導出にかかる時間を測定します
+func BenchmarkKDF(opts Options) (time.Duration, error) {
+	salt := make([]byte, SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return 0, fmt.Errorf("ソルトの生成に失敗しました: %w", err)
+	}
+	start := time.Now()
+	argon2.IDKey([]byte("envault-benchmark"), salt, opts.ArgonTime, opts.ArgonMemory, opts.ArgonThreads, KeyLength)
+	return time.Since(start), nil
+}
+
+// テストで差し替えられるよう、測定処理を変数にしておく
+var measureKDF = BenchmarkKDF
+
+// TuneKDF は鍵導出の所要時間が target 程度になるArgon2idのパラメータを探します
+// メモリ使用量を maxMemory（KiB）まで倍にしていき、それでも target に届かない場合は time を増やします
+// 測定したパラメータと所要時間を順に返し、最後の要素が推奨値です
+// 下限のパラメータでも target を超える場合は、下限のパラメータを推奨値とします
+func TuneKDF(target time.Duration, threads uint8, maxMemory uint32) ([]KDFBenchmarkResult, error) {
+	if target <= 0 {
+		return nil, errors.New("目標時間は0より大きい値を指定してください")
+	}
+	if threads < MinArgonThreads {
+		return nil, fmt.Errorf("Argon2idのthreadsは%d以上を指定してください: %d", MinArgonThreads, threads)
+	}
+	maxMemory = min(maxMemory, maxArgonMemory)
+	if maxMemory < MinArgonMemory {
+		return nil, fmt.Errorf("%w: memoryの上限は%dKiB以上を指定してください", ErrWeakKDFParams, MinArgonMemory)
+	}
+
+	var results []KDFBenchmarkResult
+	measure := func(opts Options) (time.Duration, error) {
+		d, err := measureKDF(opts)
+		if err != nil {
+			return 0, err
+		}
+		results = append(results, KDFBenchmarkResult{Options: opts, Duration: d})
+		return d, nil
+	}
+
+	opts := Options{ArgonTime: 1, ArgonMemory: min(benchmarkStartMemory, maxMemory), ArgonThreads: threads}
+	if opts.Validate() != nil {
+		opts.ArgonTime = (minArgonCost + opts.ArgonMemory - 1) / opts.ArgonMemory
+	}
+	d, err := measure(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// メモリ使用量を増やすほうが、GPUなどによる総当たりに対して効果が高い
+	for d*2 <= target && opts.ArgonMemory*2 <= maxMemory {
+		opts.ArgonMemory *= 2
+		if d, err = measure(opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// メモリの上限に達しても目標時間に届かない場合は反復回数を増やす
+	if d < target && opts.ArgonTime < maxArgonTime {
+		perIteration := d / time.Duration(opts.ArgonTime)
+		if iterations := uint32(target / max(perIteration, 1)); iterations > opts.ArgonTime {
+			opts.ArgonTime = min(iterations, maxArgonTime)
+			if _, err = measure(opts); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return results, nil
+}
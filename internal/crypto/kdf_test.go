@@ -0,0 +1,88 @@
+package crypto
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+		weak    bool
+	}{
+		{"デフォルト", DefaultOptions(), false, false},
+		{"下限のメモリでtime 2", Options{ArgonTime: 2, ArgonMemory: MinArgonMemory, ArgonThreads: 1}, false, false},
+		{"46MiBでtime 1", Options{ArgonTime: 1, ArgonMemory: 46 * 1024, ArgonThreads: 1}, false, false},
+		{"メモリが少なすぎる", Options{ArgonTime: 10, ArgonMemory: 8 * 1024, ArgonThreads: 1}, true, true},
+		{"下限のメモリでtime 1", Options{ArgonTime: 1, ArgonMemory: MinArgonMemory, ArgonThreads: 1}, true, true},
+		{"time 0", Options{ArgonTime: 0, ArgonMemory: ArgonMemory, ArgonThreads: 1}, true, false},
+		{"threads 0", Options{ArgonTime: 1, ArgonMemory: ArgonMemory, ArgonThreads: 0}, true, false},
+		{"メモリが多すぎる", Options{ArgonTime: 1, ArgonMemory: maxArgonMemory + 1, ArgonThreads: 1}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrWeakKDFParams) != tt.weak {
+				t.Errorf("Validate() error = %v, want ErrWeakKDFParams = %v", err, tt.weak)
+			}
+		})
+	}
+}
+
+func TestWeakOptionsRejected(t *testing.T) {
+	weak := Options{ArgonTime: 1, ArgonMemory: 8 * 1024, ArgonThreads: 1}
+	_, err := EncryptToRecipients([]byte("TEST_VAR1=value1\n"), []Recipient{NewPasswordRecipient("password", weak)})
+	if !errors.Is(err, ErrWeakKDFParams) {
+		t.Errorf("弱いパラメータで暗号化した error = %v, want %v", err, ErrWeakKDFParams)
+	}
+}
+
+func TestTuneKDF(t *testing.T) {
+	// 64MiB・time 1 で 10ms かかるマシンを想定する
+	original := measureKDF
+	defer func() { measureKDF = original }()
+	measureKDF = func(opts Options) (time.Duration, error) {
+		return time.Duration(opts.ArgonTime) * time.Duration(opts.ArgonMemory) * 10 * time.Millisecond / (64 * 1024), nil
+	}
+
+	tests := []struct {
+		name       string
+		target     time.Duration
+		maxMemory  uint32
+		wantTime   uint32
+		wantMemory uint32
+	}{
+		{"メモリを増やす", 100 * time.Millisecond, DefaultBenchmarkMaxMemory, 1, 512 * 1024},
+		{"メモリの上限に達したら反復回数を増やす", 500 * time.Millisecond, 256 * 1024, 12, 256 * 1024},
+		{"目標時間が短くても下限を下回らない", time.Millisecond, DefaultBenchmarkMaxMemory, 1, ArgonMemory},
+		{"上限が下限付近の場合", time.Millisecond, MinArgonMemory, 2, MinArgonMemory},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := TuneKDF(tt.target, 4, tt.maxMemory)
+			if err != nil {
+				t.Fatalf("TuneKDF() error = %v", err)
+			}
+			got := results[len(results)-1].Options
+			if got.ArgonTime != tt.wantTime || got.ArgonMemory != tt.wantMemory || got.ArgonThreads != 4 {
+				t.Errorf("TuneKDF() = %+v, want time=%d memory=%d threads=4", got, tt.wantTime, tt.wantMemory)
+			}
+			if err := got.Validate(); err != nil {
+				t.Errorf("推奨パラメータが下限を満たしていません: %v", err)
+			}
+		})
+	}
+
+	if _, err := TuneKDF(time.Second, 4, 8*1024); !errors.Is(err, ErrWeakKDFParams) {
+		t.Errorf("メモリの上限が下限未満の場合の error = %v, want %v", err, ErrWeakKDFParams)
+	}
+	if _, err := TuneKDF(0, 4, DefaultBenchmarkMaxMemory); err == nil {
+		t.Error("目標時間が0の場合にエラーが返されませんでした")
+	}
+}
@@ -0,0 +1,104 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/uzulla/envault/pkg/secret"
+)
+
+const (
+	SlotTypeKeyFile = "keyfile"
+
+	// KeyFileSize は生成するキーファイルの乱数のバイト数です
+	KeyFileSize = 64
+)
+
+var (
+	ErrKeyFileRequired = errors.New("このファイルの復号化にはキーファイルが必要です")
+)
+
+// GenerateKeyFile は新しいキーファイルの内容（base64エンコードされた乱数）を生成します
+// 任意のファイルをキーファイルとして使用できますが、内容は変更しないでください
+func GenerateKeyFile() ([]byte, error) {
+	key := make([]byte, KeyFileSize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("キーファイルの生成に失敗しました: %w", err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(key) + "\n"), nil
+}
+
+// RequiresKeyFile はパスワードで開けるスロットがすべてキーファイルを必要とするかどうかを返します
+func RequiresKeyFile(data []byte) bool {
+	if format := DetectFormat(data); format != FormatEnvault2 && format != FormatStructured {
+		return false
+	}
+	header, err := ParseHeader(data)
+	return err == nil && header.requiresKeyFile()
+}
+
+func (h *Header) requiresKeyFile() bool {
+	if h.KDF != nil {
+		return false
+	}
+
+	required := false
+	for _, slot := range h.Slots {
+		if slot.Type != SlotTypePassword && slot.Type != SlotTypeKeyFile {
+			continue
+		}
+		if slot.KDF == nil || !slot.KDF.KeyFile {
+			return false
+		}
+		required = true
+	}
+	return required
+}
+
+// AcceptsKeyFileOnly はパスワードなしでキーファイルのみで開けるスロットがあるかどうかを返します
+func AcceptsKeyFileOnly(data []byte) bool {
+	if format := DetectFormat(data); format != FormatEnvault2 && format != FormatStructured {
+		return false
+	}
+	header, err := ParseHeader(data)
+	if err != nil {
+		return false
+	}
+	for _, slot := range header.Slots {
+		if slot.Type == SlotTypeKeyFile {
+			return true
+		}
+	}
+	return false
+}
+
+// キーファイルの内容のSHA-256ハッシュを返します
+func keyFileDigest(keyFile []byte) []byte {
+	sum := sha256.Sum256(keyFile)
+	return sum[:]
+}
+
+// スロットの種類に応じてKDFに入力する秘密を組み立てます
+// キーファイルを使用しない場合はパスワードをそのまま使用し、既存のスロットと互換性を保ちます
+// 使用後は呼び出し側で Destroy してください
+func compositeSecret(slotType string, password, keyFileDigest []byte) *secret.Buffer {
+	if keyFileDigest == nil {
+		return secret.FromBytes(password)
+	}
+	if slotType == SlotTypeKeyFile {
+		input := secret.FromBytes([]byte("envault/keyfile\x00"))
+		input.Write(keyFileDigest)
+		return input
+	}
+
+	passwordDigest := sha256.Sum256(password)
+	defer secret.Wipe(passwordDigest[:])
+	input := secret.FromBytes([]byte("envault/password+keyfile\x00"))
+	input.Write(passwordDigest[:])
+	input.Write(keyFileDigest)
+	return input
+}
@@ -0,0 +1,93 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPasswordWithKeyFile(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1\n")
+	keyFile, err := GenerateKeyFile()
+	if err != nil {
+		t.Fatalf("キーファイルの生成に失敗しました: %v", err)
+	}
+	otherKeyFile, err := GenerateKeyFile()
+	if err != nil {
+		t.Fatalf("キーファイルの生成に失敗しました: %v", err)
+	}
+
+	recipient := NewPasswordRecipient("test-password", DefaultOptions()).WithKeyFile(keyFile)
+	encrypted, err := EncryptToRecipients(testData, []Recipient{recipient})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	if !RequiresKeyFile(encrypted) {
+		t.Errorf("RequiresKeyFile() = false, want true")
+	}
+
+	if _, err := Decrypt(encrypted, "test-password"); !errors.Is(err, ErrKeyFileRequired) {
+		t.Errorf("Decrypt(キーファイルなし) error = %v, want %v", err, ErrKeyFileRequired)
+	}
+
+	identity := NewPasswordIdentity("test-password").WithKeyFile(keyFile)
+	decrypted, err := DecryptWithIdentities(encrypted, []Identity{identity})
+	if err != nil {
+		t.Fatalf("復号化に失敗しました: %v", err)
+	}
+	if !bytes.Equal(decrypted, testData) {
+		t.Errorf("復号化されたデータが元のデータと一致しません")
+	}
+
+	for name, id := range map[string]*PasswordIdentity{
+		"wrong key file": NewPasswordIdentity("test-password").WithKeyFile(otherKeyFile),
+		"wrong password": NewPasswordIdentity("wrong-password").WithKeyFile(keyFile),
+	} {
+		if _, err := DecryptWithIdentities(encrypted, []Identity{id}); !errors.Is(err, ErrDecryptionFailed) {
+			t.Errorf("%s: error = %v, want %v", name, err, ErrDecryptionFailed)
+		}
+	}
+}
+
+func TestKeyFileOnly(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1\n")
+	keyFile := []byte("any file content can be used as a key file\n")
+
+	encrypted, err := EncryptToRecipients(testData, []Recipient{NewPasswordRecipient("", DefaultOptions()).WithKeyFile(keyFile)})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	header, err := ParseHeader(encrypted)
+	if err != nil {
+		t.Fatalf("ヘッダの解析に失敗しました: %v", err)
+	}
+	if header.Slots[0].Type != SlotTypeKeyFile || !AcceptsKeyFileOnly(encrypted) {
+		t.Errorf("キーファイルのみのスロットとして記録されていません: %+v", header.Slots[0])
+	}
+
+	// パスワードに関係なくキーファイルだけで開けること
+	decrypted, err := DecryptWithIdentities(encrypted, []Identity{NewPasswordIdentity("ignored").WithKeyFile(keyFile)})
+	if err != nil {
+		t.Fatalf("復号化に失敗しました: %v", err)
+	}
+	if !bytes.Equal(decrypted, testData) {
+		t.Errorf("復号化されたデータが元のデータと一致しません")
+	}
+
+	// KDFパラメータを更新しても、キーファイルのみのスロットのまま残ること
+	updated, err := UpdatePasswordSlotParams(encrypted, NewPasswordIdentity("").WithKeyFile(keyFile), DefaultOptions())
+	if err != nil {
+		t.Fatalf("UpdatePasswordSlotParams() error = %v", err)
+	}
+	if !AcceptsKeyFileOnly(updated) {
+		t.Errorf("パラメータの更新でキーファイルのみのスロットが失われました")
+	}
+}
+
+func TestEncryptAgeRejectsKeyFile(t *testing.T) {
+	recipient := NewPasswordRecipient("test-password", DefaultOptions()).WithKeyFile([]byte("key"))
+	if _, err := EncryptAge([]byte("A=1\n"), []Recipient{recipient}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("EncryptAge(key file) error = %v, want %v", err, ErrUnsupported)
+	}
+}
@@ -0,0 +1,44 @@
+package crypto
+
+import (
+	"fmt"
+	"time"
+)
+
+// Metadata は暗号化ファイルのヘッダに平文で記録する情報です
+// パスワードなしで読み取れますが、ヘッダ全体が暗号文の追加認証データ（構造化形式ではMACの対象）となるため、
+// 書き換えられた場合は復号化時に検出されます
+type Metadata struct {
+	Creator     string    `json:"creator,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Environment string    `json:"environment,omitempty"`
+	Description string    `json:"description,omitempty"`
+	// Keys は変数名の一覧です（記録しない場合は nil）
+	Keys []string `json:"keys,omitempty"`
+}
+
+// ReadMetadata は暗号化ファイルのヘッダからメタデータを読み取ります（復号化は行いません）
+// メタデータが記録されていないファイルや、メタデータを持たない形式（旧形式、age形式）の場合は nil を返します
+//
+// 返されるメタデータはこの時点では認証されていません。内容が改ざんされていないことは
+// ファイルを復号化できたことによって確認されます
+func ReadMetadata(encryptedData []byte) (*Metadata, error) {
+	encryptedData, err := decodeVault(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+
+	switch DetectFormat(encryptedData) {
+	case FormatEnvault2, FormatStructured:
+		header, err := ParseHeader(encryptedData)
+		if err != nil {
+			return nil, err
+		}
+		return header.Metadata, nil
+	case FormatEnvault1, FormatAge:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%w: 暗号化ファイルの形式を判別できません", ErrInvalidFile)
+	}
+}
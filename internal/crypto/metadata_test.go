@@ -0,0 +1,117 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testMetadata() *Metadata {
+	created := time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+	return &Metadata{
+		Creator:     "alice@example",
+		CreatedAt:   created,
+		UpdatedAt:   created.Add(time.Hour),
+		Environment: "production",
+		Description: "本番用の設定",
+		Keys:        []string{"DATABASE_URL", "API_KEY"},
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	testData := []byte("DATABASE_URL=postgres://localhost/db\nAPI_KEY=secret\n")
+	recipients := []Recipient{NewPasswordRecipient("test-password", DefaultOptions())}
+
+	encrypted, err := EncryptToRecipientsWithOptions(testData, recipients, EncryptOptions{Metadata: testMetadata()})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	metadata, err := ReadMetadata(encrypted)
+	if err != nil {
+		t.Fatalf("ReadMetadata() error = %v", err)
+	}
+	if !reflect.DeepEqual(metadata, testMetadata()) {
+		t.Errorf("ReadMetadata() = %+v, want %+v", metadata, testMetadata())
+	}
+
+	// パスワードを変更してもメタデータは残り、更新日時だけが新しくなること
+	changed, err := ChangePassword(encrypted, "test-password", "new-password", DefaultOptions())
+	if err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+	metadata, err = ReadMetadata(changed)
+	if err != nil || metadata == nil {
+		t.Fatalf("ChangePassword() 後の ReadMetadata() = %+v, %v", metadata, err)
+	}
+	want := testMetadata()
+	if !metadata.UpdatedAt.After(want.UpdatedAt) {
+		t.Errorf("ChangePassword() 後の UpdatedAt = %v, want after %v", metadata.UpdatedAt, want.UpdatedAt)
+	}
+	want.UpdatedAt = metadata.UpdatedAt
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("ChangePassword() 後の ReadMetadata() = %+v, want %+v", metadata, want)
+	}
+
+	// メタデータのない暗号化ファイルは nil を返すこと
+	plain, err := EncryptToRecipients(testData, recipients)
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	if metadata, err := ReadMetadata(plain); err != nil || metadata != nil {
+		t.Errorf("ReadMetadata() = %+v, %v, want nil", metadata, err)
+	}
+}
+
+func TestMetadataTampering(t *testing.T) {
+	testData := []byte("API_KEY=secret\n")
+	recipients := []Recipient{NewPasswordRecipient("test-password", DefaultOptions())}
+
+	encrypted, err := EncryptToRecipientsWithOptions(testData, recipients, EncryptOptions{Metadata: testMetadata()})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	// 長さを変えずに環境名を書き換えると復号化に失敗すること
+	tampered := bytes.Replace(encrypted, []byte(`"production"`), []byte(`"productiom"`), 1)
+	if bytes.Equal(tampered, encrypted) {
+		t.Fatalf("テストデータに環境名が含まれていません")
+	}
+	if metadata, err := ReadMetadata(tampered); err != nil || metadata.Environment != "productiom" {
+		t.Fatalf("ReadMetadata() = %+v, %v", metadata, err)
+	}
+	if _, err := Decrypt(tampered, "test-password"); err == nil {
+		t.Errorf("メタデータを改ざんしたファイルを復号化できてしまいました")
+	}
+
+	// 構造化形式ではMACで検出されること
+	structured, err := EncryptStructured([]StructuredEntry{{Key: "API_KEY", Value: "secret"}}, recipients, StructuredOptions{Metadata: testMetadata()})
+	if err != nil {
+		t.Fatalf("EncryptStructured() error = %v", err)
+	}
+	if metadata, err := ReadMetadata(structured); err != nil || !reflect.DeepEqual(metadata, testMetadata()) {
+		t.Errorf("ReadMetadata() = %+v, %v", metadata, err)
+	}
+	header, err := ParseHeader(structured)
+	if err != nil {
+		t.Fatalf("ParseHeader() error = %v", err)
+	}
+	header.Metadata.Environment = "staging"
+	identities := []Identity{NewPasswordIdentity("test-password")}
+	_, _, dataKey, err := openStructured(structured, identities)
+	if err != nil {
+		t.Fatalf("openStructured() error = %v", err)
+	}
+	resealed, err := sealStructured(header, dataKey, []StructuredEntry{{Key: "API_KEY", Value: "secret"}})
+	if err != nil {
+		t.Fatalf("sealStructured() error = %v", err)
+	}
+	// ヘッダ行だけを差し替えたファイルはMACが一致しない
+	original := bytes.SplitAfter(structured, []byte("\n"))
+	original[1] = bytes.SplitAfter(resealed, []byte("\n"))[1]
+	if _, err := Decrypt(bytes.Join(original, nil), "test-password"); !errors.Is(err, ErrMACMismatch) {
+		t.Errorf("Decrypt() error = %v, want %v", err, ErrMACMismatch)
+	}
+}
@@ -0,0 +1,201 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"github.com/uzulla/envault/pkg/secret"
+)
+
+const (
+	SlotTypePassword = "password"
+)
+
+// PasswordRecipient はパスワードから導出した鍵でデータ鍵を包む受信者です
+// スロットごとにソルトとArgon2idのパラメータを持ちます
+// キーファイルを指定した場合は、パスワードとキーファイル（またはキーファイルのみ）から鍵を導出します
+type PasswordRecipient struct {
+	password *secret.Buffer
+	keyFile  []byte
+	opts     Options
+}
+
+// PasswordIdentity はパスワードスロットを開くためのパスワード（とキーファイル）です
+type PasswordIdentity struct {
+	password *secret.Buffer
+	keyFile  []byte
+}
+
+// NewPasswordRecipient はパスワードスロットを作成する受信者を返します
+func NewPasswordRecipient(password string, opts Options) *PasswordRecipient {
+	return &PasswordRecipient{password: secret.FromString(password), opts: opts}
+}
+
+// NewPasswordIdentity はパスワードスロットを開くIdentityを返します
+func NewPasswordIdentity(password string) *PasswordIdentity {
+	return &PasswordIdentity{password: secret.FromString(password)}
+}
+
+// NewPasswordRecipientFromSecret は secret.Buffer のパスワードでスロットを作成する受信者を返します
+// パスワードはコピーせずに参照するため、受信者を使い終わるまで Destroy しないでください
+func NewPasswordRecipientFromSecret(password *secret.Buffer, opts Options) *PasswordRecipient {
+	return &PasswordRecipient{password: password, opts: opts}
+}
+
+// NewPasswordIdentityFromSecret は secret.Buffer のパスワードでスロットを開くIdentityを返します
+// パスワードはコピーせずに参照するため、Identityを使い終わるまで Destroy しないでください
+func NewPasswordIdentityFromSecret(password *secret.Buffer) *PasswordIdentity {
+	return &PasswordIdentity{password: password}
+}
+
+// WithKeyFile はキーファイルの内容を組み合わせて鍵を導出する受信者を返します
+// パスワードが空の場合は、キーファイルのみで開けるスロットを作成します
+func (r *PasswordRecipient) WithKeyFile(keyFile []byte) *PasswordRecipient {
+	return &PasswordRecipient{password: r.password, keyFile: keyFileDigest(keyFile), opts: r.opts}
+}
+
+// WithKeyFile はキーファイルの内容を組み合わせてスロットを開くIdentityを返します
+func (i *PasswordIdentity) WithKeyFile(keyFile []byte) *PasswordIdentity {
+	return &PasswordIdentity{password: i.password, keyFile: keyFileDigest(keyFile)}
+}
+
+// Wrap は新しいソルトでパスワードから鍵を導出し、データ鍵を包みます
+func (r *PasswordRecipient) Wrap(dataKey []byte) (*Slot, error) {
+	// 新しいスロットは下限を下回るパラメータで作成しない
+	if err := r.opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, SaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("ソルトの生成に失敗しました: %w", err)
+	}
+
+	kdf := &KDFParams{
+		ID:      KDFArgon2id,
+		Time:    r.opts.ArgonTime,
+		Memory:  r.opts.ArgonMemory,
+		Threads: r.opts.ArgonThreads,
+		Salt:    salt,
+		KeyFile: r.keyFile != nil,
+	}
+	if err := validateKDFParams(kdf); err != nil {
+		return nil, err
+	}
+
+	slotType := SlotTypePassword
+	if r.keyFile != nil && r.password.Len() == 0 {
+		slotType = SlotTypeKeyFile
+	}
+
+	input := compositeSecret(slotType, r.password.Bytes(), r.keyFile)
+	defer input.Destroy()
+	key := deriveKey(input.Bytes(), kdf)
+	defer key.Destroy()
+	wrappedKey, err := sealKey(key.Bytes(), dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Slot{
+		Type:       slotType,
+		KDF:        kdf,
+		WrappedKey: wrappedKey,
+	}, nil
+}
+
+// Unwrap はパスワードスロットからデータ鍵を取り出します
+// パスワードが一致しないスロットや、キーファイルが必要なのに与えられていないスロットは
+// 自分宛てではないものとして扱い、次のスロットを試します
+func (i *PasswordIdentity) Unwrap(slot *Slot) ([]byte, error) {
+	if (slot.Type != SlotTypePassword && slot.Type != SlotTypeKeyFile) || slot.KDF == nil {
+		return nil, errSlotMismatch
+	}
+	if slot.KDF.KeyFile && i.keyFile == nil {
+		return nil, errSlotMismatch
+	}
+	if err := validateKDFParams(slot.KDF); err != nil {
+		return nil, err
+	}
+
+	keyFile := i.keyFile
+	if !slot.KDF.KeyFile {
+		keyFile = nil
+	}
+	input := compositeSecret(slot.Type, i.password.Bytes(), keyFile)
+	defer input.Destroy()
+	key := deriveKey(input.Bytes(), slot.KDF)
+	defer key.Destroy()
+	dataKey, err := openKey(key.Bytes(), slot.WrappedKey)
+	if err == ErrDecryptionFailed {
+		return nil, errSlotMismatch
+	}
+	return dataKey, err
+}
+
+// 同じパスワード（とキーファイル）とパラメータで新しいスロットを作成する受信者を返します
+func (i *PasswordIdentity) recipientFor(slot *Slot) *PasswordRecipient {
+	r := &PasswordRecipient{
+		password: i.password,
+		opts: Options{
+			ArgonTime:    slot.KDF.Time,
+			ArgonMemory:  slot.KDF.Memory,
+			ArgonThreads: slot.KDF.Threads,
+		},
+	}
+	if slot.KDF.KeyFile {
+		r.keyFile = i.keyFile
+	}
+	if slot.Type == SlotTypeKeyFile {
+		r.password = nil
+	}
+	return r
+}
+
+// ChangePassword は旧パスワードで開けるスロットを新しいパスワードとパラメータのスロットに置き換えます
+// データ鍵と他のスロットはそのまま残るため、平文をファイルに書き出さずにパスワードを変更できます
+func ChangePassword(encryptedData []byte, oldPassword, newPassword string, opts Options) ([]byte, error) {
+	return ReplacePasswordSlot(encryptedData, NewPasswordIdentity(oldPassword), NewPasswordRecipient(newPassword, opts))
+}
+
+// ReplacePasswordSlot は oldIdentity で開けるスロットを newRecipient のスロットに置き換えます
+// キーファイルを組み合わせたスロットの変更に使用します
+func ReplacePasswordSlot(encryptedData []byte, oldIdentity *PasswordIdentity, newRecipient *PasswordRecipient) ([]byte, error) {
+	return replacePasswordSlot(encryptedData, oldIdentity, func(*Slot) *PasswordRecipient {
+		return newRecipient
+	})
+}
+
+// UpdatePasswordSlotParams は identity で開けるスロットを、同じパスワード・キーファイルの構成のまま
+// 新しいソルトとKDFパラメータで作り直します
+func UpdatePasswordSlotParams(encryptedData []byte, identity *PasswordIdentity, opts Options) ([]byte, error) {
+	return replacePasswordSlot(encryptedData, identity, func(slot *Slot) *PasswordRecipient {
+		r := identity.recipientFor(slot)
+		r.opts = opts
+		return r
+	})
+}
+
+func replacePasswordSlot(encryptedData []byte, oldIdentity *PasswordIdentity, newRecipient func(*Slot) *PasswordRecipient) ([]byte, error) {
+	v, err := openWithIdentities(encryptedData, []Identity{oldIdentity})
+	if err != nil {
+		return nil, err
+	}
+	defer v.wipe()
+
+	slots := make([]Slot, len(v.header.Slots))
+	copy(slots, v.header.Slots)
+	for i := range slots {
+		if _, err := oldIdentity.Unwrap(&slots[i]); err == nil {
+			newSlot, err := newRecipient(&slots[i]).Wrap(v.dataKey)
+			if err != nil {
+				return nil, err
+			}
+			slots[i] = *newSlot
+			return v.reseal(slots)
+		}
+	}
+
+	return nil, ErrDecryptionFailed
+}
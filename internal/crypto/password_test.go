@@ -0,0 +1,217 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/uzulla/envault/pkg/secret"
+)
+
+func TestMultiplePasswordSlots(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1")
+
+	encrypted, err := Encrypt(testData, "personal")
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	updated, err := AddRecipients(encrypted, []Identity{NewPasswordIdentity("personal")},
+		[]Recipient{NewPasswordRecipient("recovery", Options{ArgonTime: 2, ArgonMemory: 32 * 1024, ArgonThreads: 1})})
+	if err != nil {
+		t.Fatalf("パスワードスロットの追加に失敗しました: %v", err)
+	}
+
+	header, err := ParseHeader(updated)
+	if err != nil {
+		t.Fatalf("ヘッダの読み取りに失敗しました: %v", err)
+	}
+	if len(header.Slots) != 2 || bytes.Equal(header.Slots[0].KDF.Salt, header.Slots[1].KDF.Salt) {
+		t.Fatalf("スロットごとに異なるソルトが記録されていません: %+v", header.Slots)
+	}
+	if header.Slots[1].KDF.Time != 2 || header.Slots[1].KDF.Threads != 1 {
+		t.Errorf("追加したスロットのパラメータが期待と異なります: %+v", header.Slots[1].KDF)
+	}
+
+	for _, password := range []string{"personal", "recovery"} {
+		decrypted, err := Decrypt(updated, password)
+		if err != nil {
+			t.Fatalf("パスワード %q での復号化に失敗しました: %v", password, err)
+		}
+		if !bytes.Equal(testData, decrypted) {
+			t.Errorf("復号化されたデータが元のデータと一致しません")
+		}
+	}
+
+	if _, err := Decrypt(updated, "wrong"); err != ErrDecryptionFailed {
+		t.Errorf("期待されるエラーが返されませんでした。期待: %v, 実際: %v", ErrDecryptionFailed, err)
+	}
+
+	// 個人用パスワードのスロットを回復用パスワードで削除する
+	removed, err := RemoveSlot(updated, []Identity{NewPasswordIdentity("recovery")}, 0)
+	if err != nil {
+		t.Fatalf("スロットの削除に失敗しました: %v", err)
+	}
+	if _, err := Decrypt(removed, "personal"); err != ErrDecryptionFailed {
+		t.Errorf("削除したスロットのパスワードで復号化できてしまいました: %v", err)
+	}
+	if _, err := Decrypt(removed, "recovery"); err != nil {
+		t.Errorf("残したスロットのパスワードで復号化できません: %v", err)
+	}
+
+	if _, err := RemoveSlot(removed, []Identity{NewPasswordIdentity("recovery")}, 0); err != ErrLastRecipient {
+		t.Errorf("最後のスロットの削除で期待されるエラーが返されませんでした。期待: %v, 実際: %v", ErrLastRecipient, err)
+	}
+}
+
+func TestAddPasswordSlotToLegacyFile(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1")
+
+	for name, encrypted := range map[string][]byte{
+		"ENVAULT1":     encryptV1ForTest(t, testData, "personal"),
+		"ENVAULT2 KDF": encryptDirectKDFForTest(t, testData, "personal"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			updated, err := AddRecipients(encrypted, []Identity{NewPasswordIdentity("personal")},
+				[]Recipient{NewPasswordRecipient("recovery", DefaultOptions())})
+			if err != nil {
+				t.Fatalf("パスワードスロットの追加に失敗しました: %v", err)
+			}
+
+			for _, password := range []string{"personal", "recovery"} {
+				decrypted, err := Decrypt(updated, password)
+				if err != nil || !bytes.Equal(testData, decrypted) {
+					t.Errorf("パスワード %q での復号化に失敗しました: %v", password, err)
+				}
+			}
+		})
+	}
+}
+
+// 旧形式のファイルをスロット形式に変換するときは、元のKDFパラメータを引き継ぐ
+func TestLegacyFileKeepsKDFParams(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1")
+
+	tests := []struct {
+		name      string
+		encrypted []byte
+		want      Options
+	}{
+		{"ENVAULT1", encryptV1ForTest(t, testData, "personal"), Options{ArgonTime: 1, ArgonMemory: 64 * 1024, ArgonThreads: 4}},
+		{"ENVAULT2 KDF", encryptDirectKDFWithParamsForTest(t, testData, "personal", &KDFParams{ID: KDFArgon2id, Time: 3, Memory: 32 * 1024, Threads: 2}), Options{ArgonTime: 3, ArgonMemory: 32 * 1024, ArgonThreads: 2}},
+		// 現在の下限を下回るパラメータは引き継がない
+		{"下限未満", encryptDirectKDFWithParamsForTest(t, testData, "personal", &KDFParams{ID: KDFArgon2id, Time: 1, Memory: 8 * 1024, Threads: 1}), DefaultOptions()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated, err := AddRecipients(tt.encrypted, []Identity{NewPasswordIdentity("personal")},
+				[]Recipient{NewPasswordRecipient("recovery", Options{ArgonTime: 2, ArgonMemory: 19 * 1024, ArgonThreads: 1})})
+			if err != nil {
+				t.Fatalf("パスワードスロットの追加に失敗しました: %v", err)
+			}
+			header, err := ParseHeader(updated)
+			if err != nil {
+				t.Fatalf("ParseHeader() error = %v", err)
+			}
+			kdf := header.Slots[0].KDF
+			if kdf == nil || kdf.Time != tt.want.ArgonTime || kdf.Memory != tt.want.ArgonMemory || kdf.Threads != tt.want.ArgonThreads {
+				t.Errorf("変換したスロットのKDFパラメータ = %+v, want %+v", kdf, tt.want)
+			}
+			if decrypted, err := Decrypt(updated, "personal"); err != nil || !bytes.Equal(decrypted, testData) {
+				t.Errorf("元のパスワードで復号化できません: %v", err)
+			}
+		})
+	}
+}
+
+func TestRemoveRecipientsKeepsKnownPasswordSlots(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1")
+	alice := generateIdentityForTest(t)
+	bob := generateIdentityForTest(t)
+
+	encrypted, err := EncryptToRecipients(testData, []Recipient{
+		NewPasswordRecipient("recovery", DefaultOptions()),
+		alice.Recipient(),
+		bob.Recipient(),
+	})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	// パスワードが分からないとパスワードスロットを新しいデータ鍵で作り直せない
+	if _, err := RemoveRecipients(encrypted, []Identity{alice}, []string{bob.Recipient().String()}); err != ErrCannotRewrap {
+		t.Errorf("期待されるエラーが返されませんでした。期待: %v, 実際: %v", ErrCannotRewrap, err)
+	}
+
+	updated, err := RemoveRecipients(encrypted, []Identity{alice, NewPasswordIdentity("recovery")}, []string{bob.Recipient().String()})
+	if err != nil {
+		t.Fatalf("受信者の削除に失敗しました: %v", err)
+	}
+	if _, err := Decrypt(updated, "recovery"); err != nil {
+		t.Errorf("パスワードスロットが失われました: %v", err)
+	}
+	if _, err := DecryptWithIdentities(updated, []Identity{bob}); err != ErrNoIdentityMatched {
+		t.Errorf("削除した受信者で復号化できてしまいました: %v", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1")
+	alice := generateIdentityForTest(t)
+
+	encrypted, err := EncryptToRecipients(testData, []Recipient{
+		NewPasswordRecipient("old", DefaultOptions()),
+		alice.Recipient(),
+	})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	if _, err := ChangePassword(encrypted, "wrong", "new", DefaultOptions()); err != ErrDecryptionFailed {
+		t.Errorf("期待されるエラーが返されませんでした。期待: %v, 実際: %v", ErrDecryptionFailed, err)
+	}
+
+	updated, err := ChangePassword(encrypted, "old", "new", Options{ArgonTime: 3, ArgonMemory: 32 * 1024, ArgonThreads: 2})
+	if err != nil {
+		t.Fatalf("パスワードの変更に失敗しました: %v", err)
+	}
+
+	if _, err := Decrypt(updated, "old"); err != ErrDecryptionFailed {
+		t.Errorf("旧パスワードで復号化できてしまいました: %v", err)
+	}
+	decrypted, err := Decrypt(updated, "new")
+	if err != nil || !bytes.Equal(testData, decrypted) {
+		t.Errorf("新しいパスワードで復号化できません: %v", err)
+	}
+	if _, err := DecryptWithIdentities(updated, []Identity{alice}); err != nil {
+		t.Errorf("他のスロットが失われました: %v", err)
+	}
+
+	header, _ := ParseHeader(updated)
+	if header.Slots[0].KDF.Time != 3 {
+		t.Errorf("新しいパラメータが記録されていません: %+v", header.Slots[0].KDF)
+	}
+}
+
+func TestPasswordFromSecret(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1")
+	password := secret.FromBytes([]byte("buffered"))
+
+	encrypted, err := EncryptToRecipients(testData, []Recipient{NewPasswordRecipientFromSecret(password, DefaultOptions())})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	identity := NewPasswordIdentityFromSecret(password)
+	decrypted, err := DecryptWithIdentities(encrypted, []Identity{identity})
+	if err != nil || !bytes.Equal(decrypted, testData) {
+		t.Fatalf("secret.Buffer のパスワードで復号化できません: %v", err)
+	}
+	if _, err := Decrypt(encrypted, "buffered"); err != nil {
+		t.Errorf("文字列のパスワードで復号化できません: %v", err)
+	}
+
+	// 消去したパスワードでは開けない
+	password.Destroy()
+	if _, err := DecryptWithIdentities(encrypted, []Identity{identity}); err != ErrDecryptionFailed {
+		t.Errorf("消去したパスワードで error = %v, want %v", err, ErrDecryptionFailed)
+	}
+}
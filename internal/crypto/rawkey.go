@@ -0,0 +1,158 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	SlotTypeRawKey = "rawkey"
+
+	// RawKeyPrefix はCI向けの鍵文字列の接頭辞です
+	RawKeyPrefix = "envault_key_"
+
+	rawKeyChecksumSize = 4
+	rawKeyWrapInfo     = "envault/rawkey"
+)
+
+var (
+	ErrInvalidRawKey = errors.New("無効な鍵文字列です")
+)
+
+// RawKey はKDFを使用せずにデータ鍵を包む、ランダムな256ビットの鍵です
+// 高エントロピーの鍵のためArgon2idを省略でき、CIでの復号化に適しています
+// 受信者（Recipient）と秘密鍵（Identity）の両方として使用します
+type RawKey struct {
+	key []byte
+}
+
+// GenerateRawKey は新しいランダムな鍵を生成します
+func GenerateRawKey() (*RawKey, error) {
+	key := make([]byte, KeyLength)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("鍵の生成に失敗しました: %w", err)
+	}
+	return &RawKey{key: key}, nil
+}
+
+// ParseRawKey は「envault_key_」で始まる鍵文字列を読み取り、チェックサムを検証します
+func ParseRawKey(s string) (*RawKey, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, RawKeyPrefix) {
+		return nil, fmt.Errorf("%w: %q で始まっていません", ErrInvalidRawKey, RawKeyPrefix)
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, RawKeyPrefix))
+	if err != nil || len(raw) != KeyLength+rawKeyChecksumSize {
+		return nil, fmt.Errorf("%w: 長さまたは文字が正しくありません", ErrInvalidRawKey)
+	}
+
+	key, checksum := raw[:KeyLength], raw[KeyLength:]
+	if !bytes.Equal(checksum, rawKeyChecksum(key)) {
+		return nil, fmt.Errorf("%w: チェックサムが一致しません", ErrInvalidRawKey)
+	}
+	return &RawKey{key: key}, nil
+}
+
+// String は鍵文字列（接頭辞 + base64url(鍵 + チェックサム)）を返します
+func (k *RawKey) String() string {
+	return RawKeyPrefix + base64.RawURLEncoding.EncodeToString(append(append([]byte{}, k.key...), rawKeyChecksum(k.key)...))
+}
+
+// Wrap はスロットごとのソルトからラップ鍵を導出し、データ鍵を包みます
+func (k *RawKey) Wrap(dataKey []byte) (*Slot, error) {
+	salt := make([]byte, SaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("ソルトの生成に失敗しました: %w", err)
+	}
+
+	wrapKey, err := k.wrapKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := sealKey(wrapKey, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Slot{
+		Type:       SlotTypeRawKey,
+		Salt:       salt,
+		WrappedKey: wrappedKey,
+	}, nil
+}
+
+// Unwrap は鍵文字列のスロットからデータ鍵を取り出します
+// 鍵が一致しないスロットは自分宛てではないものとして扱い、次のスロットを試します
+func (k *RawKey) Unwrap(slot *Slot) ([]byte, error) {
+	if slot.Type != SlotTypeRawKey || len(slot.Salt) < SaltLength {
+		return nil, errSlotMismatch
+	}
+
+	wrapKey, err := k.wrapKey(slot.Salt)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := openKey(wrapKey, slot.WrappedKey)
+	if err == ErrDecryptionFailed {
+		return nil, errSlotMismatch
+	}
+	return dataKey, err
+}
+
+func (k *RawKey) wrapKey(salt []byte) ([]byte, error) {
+	wrapKey := make([]byte, KeyLength)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, k.key, salt, []byte(rawKeyWrapInfo)), wrapKey); err != nil {
+		return nil, fmt.Errorf("ラップ鍵の導出に失敗しました: %w", err)
+	}
+	return wrapKey, nil
+}
+
+// AcceptsRawKey は鍵文字列で復号化できるファイルかどうかを返します
+func (h *Header) AcceptsRawKey() bool {
+	for _, slot := range h.Slots {
+		if slot.Type == SlotTypeRawKey {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresRawKey は鍵文字列でしか復号化できないファイルかどうかを返します
+func RequiresRawKey(data []byte) bool {
+	if format := DetectFormat(data); format != FormatEnvault2 && format != FormatStructured {
+		return false
+	}
+	header, err := ParseHeader(data)
+	if err != nil || header.KDF != nil || len(header.Slots) == 0 {
+		return false
+	}
+	for _, slot := range header.Slots {
+		if slot.Type != SlotTypeRawKey {
+			return false
+		}
+	}
+	return true
+}
+
+func findRawKey(identities []Identity) *RawKey {
+	for _, id := range identities {
+		if k, ok := id.(*RawKey); ok {
+			return k
+		}
+	}
+	return nil
+}
+
+func rawKeyChecksum(key []byte) []byte {
+	sum := sha256.Sum256(key)
+	return sum[:rawKeyChecksumSize]
+}
@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRawKeyEncoding(t *testing.T) {
+	key, err := GenerateRawKey()
+	if err != nil {
+		t.Fatalf("鍵の生成に失敗しました: %v", err)
+	}
+
+	s := key.String()
+	if !strings.HasPrefix(s, RawKeyPrefix) {
+		t.Errorf("String() = %q, 接頭辞 %q がありません", s, RawKeyPrefix)
+	}
+
+	parsed, err := ParseRawKey(s)
+	if err != nil {
+		t.Fatalf("ParseRawKey() error = %v", err)
+	}
+	if !bytes.Equal(parsed.key, key.key) {
+		t.Errorf("ParseRawKey() で別の鍵になりました")
+	}
+
+	// 1文字でも誤っている場合はチェックサムで検出されること
+	broken := []byte(s)
+	i := len(RawKeyPrefix) + 3
+	if broken[i] == 'A' {
+		broken[i] = 'B'
+	} else {
+		broken[i] = 'A'
+	}
+	for _, invalid := range []string{string(broken), "envault_key_short", strings.TrimPrefix(s, RawKeyPrefix)} {
+		if _, err := ParseRawKey(invalid); !errors.Is(err, ErrInvalidRawKey) {
+			t.Errorf("ParseRawKey(%q) error = %v, want %v", invalid, err, ErrInvalidRawKey)
+		}
+	}
+}
+
+func TestPasswordAndRawKeySlots(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1\n")
+	key, err := GenerateRawKey()
+	if err != nil {
+		t.Fatalf("鍵の生成に失敗しました: %v", err)
+	}
+	otherKey, err := GenerateRawKey()
+	if err != nil {
+		t.Fatalf("鍵の生成に失敗しました: %v", err)
+	}
+
+	encrypted, err := EncryptToRecipients(testData, []Recipient{NewPasswordRecipient("test-password", DefaultOptions()), key})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	if RequiresRawKey(encrypted) {
+		t.Errorf("パスワードスロットがあるのに RequiresRawKey() = true")
+	}
+
+	for name, id := range map[string]Identity{"password": NewPasswordIdentity("test-password"), "raw key": key} {
+		decrypted, err := DecryptWithIdentities(encrypted, []Identity{id})
+		if err != nil {
+			t.Fatalf("%s: 復号化に失敗しました: %v", name, err)
+		}
+		if !bytes.Equal(decrypted, testData) {
+			t.Errorf("%s: 復号化されたデータが元のデータと一致しません", name)
+		}
+	}
+
+	if _, err := DecryptWithIdentities(encrypted, []Identity{otherKey}); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("DecryptWithIdentities(other key) error = %v, want %v", err, ErrDecryptionFailed)
+	}
+
+	header, err := ParseHeader(encrypted)
+	if err != nil {
+		t.Fatalf("ヘッダの解析に失敗しました: %v", err)
+	}
+	if header.Slots[1].Type != SlotTypeRawKey || header.Slots[1].KDF != nil {
+		t.Errorf("鍵文字列のスロットがKDFを使用しています: %+v", header.Slots[1])
+	}
+}
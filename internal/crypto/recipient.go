@@ -0,0 +1,558 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/uzulla/envault/pkg/secret"
+)
+
+var (
+	ErrNoRecipients      = errors.New("受信者が指定されていません")
+	ErrNoIdentityMatched = errors.New("このファイルを復号化できる鍵がありません")
+	ErrRecipientExists   = errors.New("受信者は既に登録されています")
+	ErrRecipientNotFound = errors.New("受信者が見つかりません")
+	ErrLastRecipient     = errors.New("すべての受信者を削除することはできません")
+	ErrSlotNotFound      = errors.New("キースロットが見つかりません")
+	ErrCannotRewrap      = errors.New("パスワードが不明なスロットがあるため、データ鍵を更新できません")
+
+	// Identity.Unwrap がスロットを自分宛てではないと判断した場合に返すエラー
+	errSlotMismatch = errors.New("スロットが一致しません")
+)
+
+// Slot はデータ鍵を受信者ごとに包んだキースロットです
+type Slot struct {
+	Type       string     `json:"type"`
+	Recipient  string     `json:"recipient,omitempty"`
+	Ephemeral  []byte     `json:"ephemeral,omitempty"`
+	KDF        *KDFParams `json:"kdf,omitempty"`
+	Salt       []byte     `json:"salt,omitempty"`
+	WrappedKey []byte     `json:"wrapped_key"`
+}
+
+// Recipient はデータ鍵を包んでキースロットを作成できる受信者です
+type Recipient interface {
+	Wrap(dataKey []byte) (*Slot, error)
+}
+
+// Identity はキースロットからデータ鍵を取り出せる秘密鍵です
+// 自分宛てではないスロットに対しては errSlotMismatch を返します
+type Identity interface {
+	Unwrap(slot *Slot) ([]byte, error)
+}
+
+// EncryptToRecipients はランダムなデータ鍵でデータを暗号化し、データ鍵を受信者ごとに包みます
+func EncryptToRecipients(data []byte, recipients []Recipient) ([]byte, error) {
+	return EncryptToRecipientsWithOptions(data, recipients, EncryptOptions{})
+}
+
+// EncryptOptions は受信者への暗号化のオプションです
+type EncryptOptions struct {
+	// Cipher は本文の暗号方式です（空の場合は AES-256-GCM）
+	Cipher string
+	// Metadata はヘッダに平文で記録するメタデータです
+	// ヘッダ全体が追加認証データとなるため、改ざんは復号化時に検出されます
+	Metadata *Metadata
+}
+
+// EncryptToRecipientsWithOptions は暗号方式やメタデータを指定して EncryptToRecipients と同様に暗号化します
+func EncryptToRecipientsWithOptions(data []byte, recipients []Recipient, opts EncryptOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := EncryptStream(&buf, bytes.NewReader(data), recipients, opts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncryptStream は src から読み込んだデータを EncryptToRecipientsWithOptions と同様に暗号化し、dst に書き込みます
+// データ全体をメモリに読み込まず、StreamChunkSize ごとのチャンクに分けて暗号化します
+func EncryptStream(dst io.Writer, src io.Reader, recipients []Recipient, opts EncryptOptions) error {
+	if len(recipients) == 0 {
+		return ErrNoRecipients
+	}
+	suite, err := CipherSuiteByName(opts.Cipher)
+	if err != nil {
+		return err
+	}
+
+	dataKey := make([]byte, KeyLength)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return fmt.Errorf("データ鍵の生成に失敗しました: %w", err)
+	}
+	defer secret.Wipe(dataKey)
+
+	slots := make([]Slot, 0, len(recipients))
+	for _, r := range recipients {
+		slot, err := r.Wrap(dataKey)
+		if err != nil {
+			return err
+		}
+		slots = append(slots, *slot)
+	}
+
+	w, err := newBodyWriter(dst, dataKey, &Header{Cipher: suite.Name(), Slots: slots, Metadata: opts.Metadata})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// DecryptWithIdentities はキースロットをいずれかの秘密鍵で開き、データを復号化します
+// パスワードで直接暗号化された旧形式のファイルは、Identityに含まれるパスワードで復号化します
+// age形式のファイルはageの受信者スタンザをパスワードまたはX25519秘密鍵で開きます
+func DecryptWithIdentities(encryptedData []byte, identities []Identity) ([]byte, error) {
+	encryptedData, err := decodeVault(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+
+	switch DetectFormat(encryptedData) {
+	case FormatAge:
+		return decryptAge(encryptedData, identities)
+	case FormatStructured:
+		return decryptStructured(encryptedData, identities)
+	}
+	if isLegacy(encryptedData) {
+		password := findPasswordIdentity(identities)
+		if password == nil {
+			return nil, ErrNoIdentityMatched
+		}
+		return decryptWithPassword(encryptedData, password.password)
+	}
+
+	v, err := openWithIdentities(encryptedData, identities)
+	if err != nil {
+		return nil, err
+	}
+	secret.Wipe(v.dataKey)
+	return v.plaintext, nil
+}
+
+// AddRecipients は既存のデータ鍵を新しい受信者向けに包み、キースロットを追加します
+// データ鍵を取り出すため、既存の受信者の秘密鍵が必要です
+func AddRecipients(encryptedData []byte, identities []Identity, recipients []Recipient) ([]byte, error) {
+	v, err := openWithIdentities(encryptedData, identities)
+	if err != nil {
+		return nil, err
+	}
+	defer v.wipe()
+
+	slots := v.header.Slots
+	for _, r := range recipients {
+		slot, err := r.Wrap(v.dataKey)
+		if err != nil {
+			return nil, err
+		}
+		for _, existing := range slots {
+			if existing.Recipient != "" && existing.Recipient == slot.Recipient {
+				return nil, fmt.Errorf("%w: %s", ErrRecipientExists, slot.Recipient)
+			}
+		}
+		slots = append(slots, *slot)
+	}
+
+	// ヘッダが変わるため、同じデータ鍵・新しいnonceで本文を暗号化し直す
+	return v.reseal(slots)
+}
+
+// RemoveRecipients は指定した受信者（公開鍵またはフィンガープリント）のキースロットを削除します
+// 削除された受信者が以前のデータ鍵を保持している可能性があるため、新しいデータ鍵で暗号化し直します
+func RemoveRecipients(encryptedData []byte, identities []Identity, keys []string) ([]byte, error) {
+	v, err := openWithIdentities(encryptedData, identities)
+	if err != nil {
+		return nil, err
+	}
+	defer v.wipe()
+	header := v.header
+
+	removed := make(map[int]bool)
+	for _, key := range keys {
+		key = CanonicalRecipient(key)
+		found := false
+		for i, slot := range header.Slots {
+			if slot.Recipient != "" && (slot.Recipient == key || slot.Fingerprint() == key) {
+				removed[i] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrRecipientNotFound, key)
+		}
+	}
+
+	var remaining []Recipient
+	for i := range header.Slots {
+		if removed[i] {
+			continue
+		}
+		r, err := header.Slots[i].recipient(identities)
+		if err != nil {
+			return nil, err
+		}
+		remaining = append(remaining, r)
+	}
+	if len(remaining) == 0 {
+		return nil, ErrLastRecipient
+	}
+
+	return v.reencrypt(remaining)
+}
+
+// RemoveSlot は指定した番号（0始まり）のキースロットを削除します
+// 残りのスロットのパスワードは分からないため、データ鍵は変更しません
+func RemoveSlot(encryptedData []byte, identities []Identity, index int) ([]byte, error) {
+	v, err := openWithIdentities(encryptedData, identities)
+	if err != nil {
+		return nil, err
+	}
+	defer v.wipe()
+	header := v.header
+
+	if index < 0 || index >= len(header.Slots) {
+		return nil, fmt.Errorf("%w: %d", ErrSlotNotFound, index)
+	}
+	if len(header.Slots) == 1 {
+		return nil, ErrLastRecipient
+	}
+
+	slots := make([]Slot, 0, len(header.Slots)-1)
+	slots = append(slots, header.Slots[:index]...)
+	slots = append(slots, header.Slots[index+1:]...)
+
+	return v.reseal(slots)
+}
+
+// ParseHeader はENVAULT2形式（または構造化形式）のデータのヘッダを読み取ります（復号化は行いません）
+func ParseHeader(encryptedData []byte) (*Header, error) {
+	encryptedData, err := decodeVault(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+
+	if DetectFormat(encryptedData) == FormatStructured {
+		return parseStructuredHeader(encryptedData)
+	}
+	header, _, _, err := parseHeader(encryptedData)
+	return header, err
+}
+
+// 秘密鍵で開いた暗号化ファイル
+// 構造化形式のファイルは平文の代わりに変数を保持し、スロットを変更しても構造化形式のまま暗号化し直します
+type openedVault struct {
+	header     *Header
+	dataKey    []byte
+	plaintext  []byte
+	entries    []StructuredEntry
+	structured bool
+}
+
+// 秘密鍵でキースロットを開き、ヘッダ・本文・データ鍵を返します
+// パスワードで直接暗号化された旧形式のファイルは、新しいデータ鍵とパスワードスロットを持つ形に変換して返します
+func openWithIdentities(encryptedData []byte, identities []Identity) (*openedVault, error) {
+	encryptedData, err := decodeVault(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+
+	switch DetectFormat(encryptedData) {
+	case FormatAge:
+		return nil, fmt.Errorf("%w: age形式のファイルのスロットは変更できません", ErrUnsupported)
+	case FormatStructured:
+		header, entries, dataKey, err := openStructured(encryptedData, identities)
+		if err != nil {
+			return nil, err
+		}
+		return &openedVault{header: header, dataKey: dataKey, entries: entries, structured: true}, nil
+	}
+	if isLegacy(encryptedData) {
+		return openLegacy(encryptedData, identities)
+	}
+
+	header, aad, ciphertext, err := parseHeader(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := unwrapDataKey(header, identities)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := openBody(header, dataKey, aad, ciphertext)
+	if err != nil {
+		secret.Wipe(dataKey)
+		return nil, err
+	}
+
+	return &openedVault{header: header, dataKey: dataKey, plaintext: plaintext}, nil
+}
+
+// 同じデータ鍵で、キースロットを置き換えたファイルを作成します
+func (v *openedVault) reseal(slots []Slot) ([]byte, error) {
+	header := v.header.withSlots(slots)
+	if v.structured {
+		return sealStructured(header, v.dataKey, v.entries)
+	}
+	return sealWithDataKey(v.plaintext, v.dataKey, header)
+}
+
+// 新しいデータ鍵で、recipients 宛てに暗号化し直したファイルを作成します
+// 暗号方式・メタデータ（構造化形式ではキー名を隠すかどうかも）は引き継ぎます
+func (v *openedVault) reencrypt(recipients []Recipient) ([]byte, error) {
+	metadata := v.header.updatedMetadata()
+	if v.structured {
+		return EncryptStructured(v.entries, recipients, StructuredOptions{HashKeys: v.header.HashedKeys, Metadata: metadata, Cipher: v.header.Cipher})
+	}
+	return EncryptToRecipientsWithOptions(v.plaintext, recipients, EncryptOptions{Cipher: v.header.Cipher, Metadata: metadata})
+}
+
+// データ鍵と平文を消去します
+func (v *openedVault) wipe() {
+	secret.Wipe(v.dataKey)
+	secret.Wipe(v.plaintext)
+}
+
+// Fingerprint はキースロットの受信者を識別する短い文字列を返します
+func (s *Slot) Fingerprint() string {
+	if s.Recipient == "" {
+		return ""
+	}
+	return Fingerprint(s.Recipient)
+}
+
+// 旧形式のファイルをパスワードで復号化し、パスワードスロット形式に変換します
+func openLegacy(encryptedData []byte, identities []Identity) (*openedVault, error) {
+	password := findPasswordIdentity(identities)
+	if password == nil {
+		return nil, ErrNoIdentityMatched
+	}
+
+	plaintext, err := decryptWithPassword(encryptedData, password.password)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, KeyLength)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("データ鍵の生成に失敗しました: %w", err)
+	}
+
+	opts := legacyOptions(encryptedData)
+	slot, err := NewPasswordRecipientFromSecret(password.password, opts).Wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := &Header{Version: FormatVersion, Cipher: opts.Cipher, Slots: []Slot{*slot}}
+	return &openedVault{header: header, dataKey: dataKey, plaintext: plaintext}, nil
+}
+
+// 旧形式のファイルのKDFパラメータと暗号方式を、スロットを作るための Options として返します
+// ENVAULT1 は当時の固定値、KDFをヘッダに持つENVAULT2はヘッダの値を引き継ぎます
+// 現在の下限を下回るパラメータは引き継がず、デフォルトのパラメータを使用します
+func legacyOptions(encryptedData []byte) Options {
+	opts := DefaultOptions()
+	if header, _, _, err := parseHeader(encryptedData); err == nil && header.KDF != nil {
+		opts.ArgonTime = header.KDF.Time
+		opts.ArgonMemory = header.KDF.Memory
+		opts.ArgonThreads = header.KDF.Threads
+		if header.Cipher != "" {
+			opts.Cipher = header.Cipher
+		}
+	}
+	if opts.Validate() != nil {
+		defaults := DefaultOptions()
+		defaults.Cipher = opts.Cipher
+		return defaults
+	}
+	return opts
+}
+
+// パスワードで直接暗号化されたファイル（ENVAULT1、またはKDFをヘッダに持つENVAULT2）かどうか
+func isLegacy(encryptedData []byte) bool {
+	if len(encryptedData) >= len(MagicBytesV1) && string(encryptedData[:len(MagicBytesV1)]) == MagicBytesV1 {
+		return true
+	}
+	header, _, _, err := parseHeader(encryptedData)
+	return err == nil && header.KDF != nil
+}
+
+// Identityの中から最初のパスワードを探します
+func findPasswordIdentity(identities []Identity) *PasswordIdentity {
+	for _, id := range identities {
+		if p, ok := id.(*PasswordIdentity); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// AcceptsPassword はパスワード（またはキーファイル）で復号化できるファイルかどうかを返します
+func (h *Header) AcceptsPassword() bool {
+	if h.KDF != nil {
+		return true
+	}
+	for _, slot := range h.Slots {
+		if slot.Type == SlotTypePassword || slot.Type == SlotTypeKeyFile {
+			return true
+		}
+	}
+	return false
+}
+
+// キースロットと同じ相手に新しいデータ鍵を包むための受信者を復元します
+// パスワードスロットは、そのスロットを開けるパスワードが与えられている場合のみ復元できます
+func (s *Slot) recipient(identities []Identity) (Recipient, error) {
+	switch s.Type {
+	case SlotTypeX25519:
+		return ParseX25519Recipient(s.Recipient)
+	case SlotTypeSSHEd25519, SlotTypeSSHRSA:
+		return ParseSSHRecipient(s.Recipient)
+	case SlotTypeRawKey:
+		for _, id := range identities {
+			if k, ok := id.(*RawKey); ok {
+				if _, err := k.Unwrap(s); err == nil {
+					return k, nil
+				}
+			}
+		}
+		return nil, ErrCannotRewrap
+	case SlotTypePassword, SlotTypeKeyFile:
+		for _, id := range identities {
+			if p, ok := id.(*PasswordIdentity); ok {
+				if _, err := p.Unwrap(s); err == nil {
+					return p.recipientFor(s), nil
+				}
+			}
+		}
+		return nil, ErrCannotRewrap
+	default:
+		return nil, fmt.Errorf("%w: スロットの種類 %q", ErrUnsupported, s.Type)
+	}
+}
+
+// データ鍵とヘッダ（暗号方式・キースロット・メタデータ）からENVAULT2形式のデータを作成します
+// 本文はチャンク形式で暗号化し、バージョン・nonce・チャンク長はここで設定します
+func sealWithDataKey(data, dataKey []byte, h *Header) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := newBodyWriter(&buf, dataKey, h)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 暗号方式とメタデータを引き継ぎ、キースロットを置き換えたヘッダを返します
+// メタデータの更新日時は現在時刻になります
+func (h *Header) withSlots(slots []Slot) *Header {
+	return &Header{Version: FormatVersion, Cipher: h.Cipher, Slots: slots, HashedKeys: h.HashedKeys, Metadata: h.updatedMetadata()}
+}
+
+// ファイルを書き換えるときに記録するメタデータ（更新日時を現在時刻にしたコピー）を返します
+func (h *Header) updatedMetadata() *Metadata {
+	if h.Metadata == nil {
+		return nil
+	}
+	metadata := *h.Metadata
+	metadata.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	return &metadata
+}
+
+// キースロットを順に試し、いずれかの秘密鍵でデータ鍵を取り出します
+func unwrapDataKey(header *Header, identities []Identity) ([]byte, error) {
+	for i := range header.Slots {
+		for _, id := range identities {
+			dataKey, err := id.Unwrap(&header.Slots[i])
+			if errors.Is(err, errSlotMismatch) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			return dataKey, nil
+		}
+	}
+
+	// パスワードが与えられていた場合は、パスワードの誤りとして扱う
+	// ただしキーファイルが必要なスロットしかない場合は、キーファイルの指定漏れとして扱う
+	if password := findPasswordIdentity(identities); password != nil && header.AcceptsPassword() {
+		if password.keyFile == nil && header.requiresKeyFile() {
+			return nil, ErrKeyFileRequired
+		}
+		return nil, ErrDecryptionFailed
+	}
+	// 鍵文字列が与えられていた場合も同様に、鍵の誤りとして扱う
+	if findRawKey(identities) != nil && header.AcceptsRawKey() {
+		return nil, ErrDecryptionFailed
+	}
+	return nil, ErrNoIdentityMatched
+}
+
+// ヘッダの情報に従って本文を復号化します
+func openBody(header *Header, key, aad, ciphertext []byte) ([]byte, error) {
+	if header.ChunkSize != 0 {
+		r, err := newBodyReader(bytes.NewReader(ciphertext), header, key, aad)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+
+	aead, err := newAEAD(header.Cipher, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(header.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: nonceの長さが不正です", ErrInvalidFile)
+	}
+	if len(ciphertext) < aead.Overhead() {
+		return nil, ErrTruncatedFile
+	}
+
+	plaintext, err := aead.Open(nil, header.Nonce, ciphertext, aad)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	return plaintext, nil
+}
+
+// ラップ鍵でデータ鍵を暗号化します
+// ラップ鍵はスロットごとに一意なので、nonceは固定値を使用します
+func sealKey(wrapKey, dataKey []byte) ([]byte, error) {
+	aesGCM, err := newGCM(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+	return aesGCM.Seal(nil, make([]byte, NonceSize), dataKey, nil), nil
+}
+
+// ラップ鍵で包まれたデータ鍵を取り出します
+func openKey(wrapKey, wrappedKey []byte) ([]byte, error) {
+	aesGCM, err := newGCM(wrapKey)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := aesGCM.Open(nil, make([]byte, NonceSize), wrappedKey, nil)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	if len(dataKey) != KeyLength {
+		return nil, ErrInvalidFile
+	}
+	return dataKey, nil
+}
@@ -0,0 +1,90 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestAddRecipients(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1")
+	alice := generateIdentityForTest(t)
+	bob := generateIdentityForTest(t)
+
+	encrypted, err := EncryptToRecipients(testData, []Recipient{alice.Recipient()})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	// 受信者でない鍵ではスロットを追加できないこと
+	if _, err := AddRecipients(encrypted, []Identity{bob}, []Recipient{bob.Recipient()}); err != ErrNoIdentityMatched {
+		t.Errorf("期待されるエラーが返されませんでした。期待: %v, 実際: %v", ErrNoIdentityMatched, err)
+	}
+
+	updated, err := AddRecipients(encrypted, []Identity{alice}, []Recipient{bob.Recipient()})
+	if err != nil {
+		t.Fatalf("受信者の追加に失敗しました: %v", err)
+	}
+
+	decrypted, err := DecryptWithIdentities(updated, []Identity{bob})
+	if err != nil {
+		t.Fatalf("追加した受信者での復号化に失敗しました: %v", err)
+	}
+	if !bytes.Equal(testData, decrypted) {
+		t.Errorf("復号化されたデータが元のデータと一致しません")
+	}
+
+	if _, err := AddRecipients(updated, []Identity{alice}, []Recipient{bob.Recipient()}); !errors.Is(err, ErrRecipientExists) {
+		t.Errorf("重複した受信者の追加で期待されるエラーが返されませんでした。実際: %v", err)
+	}
+}
+
+func TestRemoveRecipients(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1")
+	alice := generateIdentityForTest(t)
+	bob := generateIdentityForTest(t)
+
+	encrypted, err := EncryptToRecipients(testData, []Recipient{alice.Recipient(), bob.Recipient()})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	oldHeader, err := ParseHeader(encrypted)
+	if err != nil {
+		t.Fatalf("ヘッダの読み取りに失敗しました: %v", err)
+	}
+	oldDataKey, err := alice.Unwrap(&oldHeader.Slots[0])
+	if err != nil {
+		t.Fatalf("データ鍵の取り出しに失敗しました: %v", err)
+	}
+
+	updated, err := RemoveRecipients(encrypted, []Identity{alice}, []string{Fingerprint(bob.Recipient().String())})
+	if err != nil {
+		t.Fatalf("受信者の削除に失敗しました: %v", err)
+	}
+
+	if _, err := DecryptWithIdentities(updated, []Identity{bob}); err != ErrNoIdentityMatched {
+		t.Errorf("削除した受信者で復号化できてしまいました: %v", err)
+	}
+
+	header, err := ParseHeader(updated)
+	if err != nil {
+		t.Fatalf("ヘッダの読み取りに失敗しました: %v", err)
+	}
+	if len(header.Slots) != 1 {
+		t.Fatalf("キースロットの数が期待と異なります: %d", len(header.Slots))
+	}
+	newDataKey, err := alice.Unwrap(&header.Slots[0])
+	if err != nil {
+		t.Fatalf("データ鍵の取り出しに失敗しました: %v", err)
+	}
+	if bytes.Equal(oldDataKey, newDataKey) {
+		t.Errorf("受信者の削除後もデータ鍵が変更されていません")
+	}
+
+	if _, err := RemoveRecipients(updated, []Identity{alice}, []string{alice.Recipient().String()}); err != ErrLastRecipient {
+		t.Errorf("最後の受信者の削除で期待されるエラーが返されませんでした。期待: %v, 実際: %v", ErrLastRecipient, err)
+	}
+	if _, err := RemoveRecipients(updated, []Identity{alice}, []string{"0000000000000000"}); !errors.Is(err, ErrRecipientNotFound) {
+		t.Errorf("存在しない受信者の削除で期待されるエラーが返されませんでした。実際: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/uzulla/envault/pkg/secret"
+)
+
+// 復旧用の分割片
+//
+// 暗号化ファイルのデータ鍵をシャミアの秘密分散で分割し、印刷して保管できる文字列にします
+// 必要数の分割片が揃えばパスワードを忘れてもデータ鍵を復元でき、新しいパスワードのスロットを追加できます
+// データ鍵が変わる操作（再暗号化や recipients remove）を行うと、それ以前の分割片では復元できなくなります
+
+const (
+	// RecoverySharePrefix は分割片の文字列の接頭辞です
+	RecoverySharePrefix = "ENVAULT-RECOVERY-"
+
+	recoveryShareVersion  = 1
+	recoverySetIDSize     = 4
+	recoveryChecksumSize  = 4
+	recoveryShareDataSize = 1 + recoverySetIDSize + 3 + KeyLength
+	recoveryGroupSize     = 5
+)
+
+var (
+	ErrInvalidRecoveryShare = errors.New("無効な分割片です")
+	ErrNotEnoughShares      = errors.New("分割片が足りません")
+	ErrRecoveryShareMixed   = errors.New("別の分割で作られた分割片が混ざっています")
+)
+
+// 分割片の文字列には、手書きや読み上げで間違えにくい大文字と数字だけの base32 を使用する
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// RecoveryShare はデータ鍵の分割片です
+type RecoveryShare struct {
+	SetID     []byte // 同じ分割で作られた分割片に共通のID
+	Index     int    // 分割片の番号（1始まり）
+	Total     int    // 分割数
+	Threshold int    // 復元に必要な分割片の数
+	Value     []byte
+}
+
+// SplitRecoveryShares は暗号化ファイルのデータ鍵を取り出し、threshold 個で復元できる total 個の分割片に分けます
+// データ鍵を取り出すため、既存のスロットを開ける秘密鍵（パスワードなど）が必要です
+func SplitRecoveryShares(encryptedData []byte, identities []Identity, total, threshold int) ([]*RecoveryShare, error) {
+	vault, err := decodeVault(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+	// 旧形式のファイルはデータ鍵を持たないため、分割してもファイルを開けない
+	if isLegacy(vault) {
+		return nil, fmt.Errorf("%w: 旧形式のファイルは envault upgrade で変換してから分割してください", ErrUnsupported)
+	}
+
+	v, err := openWithIdentities(vault, identities)
+	if err != nil {
+		return nil, err
+	}
+	defer v.wipe()
+	dataKey := v.dataKey
+
+	values, err := splitSecret(dataKey, total, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	setID := make([]byte, recoverySetIDSize)
+	if _, err := io.ReadFull(rand.Reader, setID); err != nil {
+		return nil, fmt.Errorf("乱数の生成に失敗しました: %w", err)
+	}
+
+	shares := make([]*RecoveryShare, total)
+	for i, value := range values {
+		shares[i] = &RecoveryShare{SetID: setID, Index: i + 1, Total: total, Threshold: threshold, Value: value}
+	}
+	return shares, nil
+}
+
+// CombineRecoveryShares は分割片からデータ鍵を復元し、暗号化ファイルを開ける Identity を返します
+// 復元した鍵が正しいかどうかは、その Identity でファイルを開いたときに確認されます
+// 使用後は呼び出し側で Destroy してください
+func CombineRecoveryShares(shares []*RecoveryShare) (*RecoveredKey, error) {
+	if len(shares) == 0 {
+		return nil, ErrNotEnoughShares
+	}
+
+	first := shares[0]
+	var xs []byte
+	var ys [][]byte
+	for _, s := range shares {
+		if !bytes.Equal(s.SetID, first.SetID) || s.Threshold != first.Threshold || s.Total != first.Total {
+			return nil, ErrRecoveryShareMixed
+		}
+		if bytes.Contains(xs, []byte{byte(s.Index)}) {
+			// 同じ分割片が2回入力された場合は1つとして扱う
+			continue
+		}
+		xs = append(xs, byte(s.Index))
+		ys = append(ys, s.Value)
+	}
+	if len(xs) < first.Threshold {
+		return nil, fmt.Errorf("%w: %d個のうち%d個が必要です", ErrNotEnoughShares, len(xs), first.Threshold)
+	}
+
+	dataKey, err := combineSecret(xs[:first.Threshold], ys[:first.Threshold])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecoveryShare, err)
+	}
+	defer secret.Wipe(dataKey)
+	return &RecoveredKey{key: secret.FromBytes(dataKey)}, nil
+}
+
+// ParseRecoveryShare は分割片の文字列を読み取り、チェックサムを検証します
+// 空白やハイフンの位置、大文字・小文字、接頭辞の有無は問いません
+func ParseRecoveryShare(s string) (*RecoveryShare, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, RecoverySharePrefix)
+	s = strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, s)
+
+	raw, err := recoveryEncoding.DecodeString(s)
+	if err != nil || len(raw) != recoveryShareDataSize+recoveryChecksumSize {
+		return nil, fmt.Errorf("%w: 長さまたは文字が正しくありません", ErrInvalidRecoveryShare)
+	}
+	data, checksum := raw[:recoveryShareDataSize], raw[recoveryShareDataSize:]
+	if !bytes.Equal(checksum, recoveryChecksum(data)) {
+		return nil, fmt.Errorf("%w: チェックサムが一致しません（入力に誤りがあります）", ErrInvalidRecoveryShare)
+	}
+	if data[0] != recoveryShareVersion {
+		return nil, fmt.Errorf("%w: 未対応のバージョンです (%d)", ErrInvalidRecoveryShare, data[0])
+	}
+
+	setID := data[1 : 1+recoverySetIDSize]
+	params := data[1+recoverySetIDSize:]
+	share := &RecoveryShare{
+		SetID:     append([]byte{}, setID...),
+		Index:     int(params[0]),
+		Total:     int(params[1]),
+		Threshold: int(params[2]),
+		Value:     append([]byte{}, params[3:]...),
+	}
+	if share.Index == 0 || share.Index > share.Total || share.Threshold < 2 || share.Threshold > share.Total {
+		return nil, fmt.Errorf("%w: 番号または必要数が正しくありません", ErrInvalidRecoveryShare)
+	}
+	return share, nil
+}
+
+// String は分割片を印刷用の文字列（接頭辞 + 5文字ごとにハイフンで区切った base32）で返します
+func (s *RecoveryShare) String() string {
+	data := make([]byte, 0, recoveryShareDataSize+recoveryChecksumSize)
+	data = append(data, recoveryShareVersion)
+	data = append(data, s.SetID...)
+	data = append(data, byte(s.Index), byte(s.Total), byte(s.Threshold))
+	data = append(data, s.Value...)
+	data = append(data, recoveryChecksum(data)...)
+
+	encoded := recoveryEncoding.EncodeToString(data)
+	var groups []string
+	for len(encoded) > 0 {
+		n := min(recoveryGroupSize, len(encoded))
+		groups = append(groups, encoded[:n])
+		encoded = encoded[n:]
+	}
+	return RecoverySharePrefix + strings.Join(groups, "-")
+}
+
+// SetIDString は分割片の組を識別する短い文字列を返します
+func (s *RecoveryShare) SetIDString() string {
+	return hex.EncodeToString(s.SetID)
+}
+
+func recoveryChecksum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:recoveryChecksumSize]
+}
+
+// RecoveredKey は分割片から復元したデータ鍵です
+// どのスロットに対してもデータ鍵をそのまま返し、正しい鍵かどうかは本文の認証で確認されます
+type RecoveredKey struct {
+	key *secret.Buffer
+}
+
+func (k *RecoveredKey) Unwrap(slot *Slot) ([]byte, error) {
+	if k.key.Len() == 0 {
+		return nil, errors.New("復元したデータ鍵は消去されています")
+	}
+	return append([]byte{}, k.key.Bytes()...), nil
+}
+
+// Destroy は復元したデータ鍵を消去します
+func (k *RecoveredKey) Destroy() {
+	k.key.Destroy()
+}
@@ -0,0 +1,157 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSplitCombineSecret(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	shares, err := splitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("splitSecret() error = %v", err)
+	}
+
+	// 任意の3個の組み合わせで復元できること
+	for a := 0; a < 5; a++ {
+		for b := a + 1; b < 5; b++ {
+			for c := b + 1; c < 5; c++ {
+				xs := []byte{byte(a + 1), byte(b + 1), byte(c + 1)}
+				got, err := combineSecret(xs, [][]byte{shares[a], shares[b], shares[c]})
+				if err != nil || !bytes.Equal(got, secret) {
+					t.Errorf("分割片 %v で復元できません: %v", xs, err)
+				}
+			}
+		}
+	}
+
+	// 2個では元の秘密にならないこと
+	got, err := combineSecret([]byte{1, 2}, [][]byte{shares[0], shares[1]})
+	if err != nil || bytes.Equal(got, secret) {
+		t.Errorf("必要数より少ない分割片で秘密が復元されました: %v", err)
+	}
+
+	for _, tt := range []struct{ n, threshold int }{{5, 1}, {3, 4}, {256, 3}} {
+		if _, err := splitSecret(secret, tt.n, tt.threshold); err == nil {
+			t.Errorf("splitSecret(n=%d, threshold=%d) でエラーが返されませんでした", tt.n, tt.threshold)
+		}
+	}
+	if _, err := combineSecret([]byte{1, 1}, [][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("x座標が重複した分割片でエラーが返されませんでした")
+	}
+}
+
+func TestRecoveryShareString(t *testing.T) {
+	share := &RecoveryShare{
+		SetID:     []byte{1, 2, 3, 4},
+		Index:     2,
+		Total:     5,
+		Threshold: 3,
+		Value:     bytes.Repeat([]byte{0xab}, KeyLength),
+	}
+	s := share.String()
+	if !strings.HasPrefix(s, RecoverySharePrefix) {
+		t.Fatalf("String() = %q, want %q で始まる文字列", s, RecoverySharePrefix)
+	}
+
+	// 小文字や空白区切りで入力しても読み取れること
+	for _, input := range []string{s, strings.ToLower(s), strings.ReplaceAll(strings.TrimPrefix(s, RecoverySharePrefix), "-", " ")} {
+		parsed, err := ParseRecoveryShare(input)
+		if err != nil {
+			t.Fatalf("ParseRecoveryShare(%q) error = %v", input, err)
+		}
+		if parsed.Index != 2 || parsed.Total != 5 || parsed.Threshold != 3 || parsed.SetIDString() != "01020304" || !bytes.Equal(parsed.Value, share.Value) {
+			t.Errorf("ParseRecoveryShare() = %+v", parsed)
+		}
+	}
+
+	// 1文字の入力ミスをチェックサムで検出すること
+	typo := []byte(s)
+	i := len(RecoverySharePrefix) + 10
+	if typo[i] == 'A' {
+		typo[i] = 'B'
+	} else {
+		typo[i] = 'A'
+	}
+	if _, err := ParseRecoveryShare(string(typo)); !errors.Is(err, ErrInvalidRecoveryShare) {
+		t.Errorf("入力ミスのある分割片で error = %v, want %v", err, ErrInvalidRecoveryShare)
+	}
+	if _, err := ParseRecoveryShare(s[:len(s)-5]); !errors.Is(err, ErrInvalidRecoveryShare) {
+		t.Errorf("短い分割片で error = %v, want %v", err, ErrInvalidRecoveryShare)
+	}
+}
+
+func TestRecoverySharesRoundTrip(t *testing.T) {
+	password := "test-password"
+	data := []byte("TEST_VAR1=value1\n")
+	encrypted, err := Encrypt(data, password)
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	shares, err := SplitRecoveryShares(encrypted, []Identity{NewPasswordIdentity(password)}, 5, 3)
+	if err != nil {
+		t.Fatalf("SplitRecoveryShares() error = %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("分割片の数 = %d, want 5", len(shares))
+	}
+
+	// 印刷した文字列から読み取った分割片で復元し、新しいパスワードのスロットを追加する
+	var parsed []*RecoveryShare
+	for _, i := range []int{4, 1, 2} {
+		share, err := ParseRecoveryShare(shares[i].String())
+		if err != nil {
+			t.Fatalf("ParseRecoveryShare() error = %v", err)
+		}
+		parsed = append(parsed, share)
+	}
+	identity, err := CombineRecoveryShares(parsed)
+	if err != nil {
+		t.Fatalf("CombineRecoveryShares() error = %v", err)
+	}
+	updated, err := AddRecipients(encrypted, []Identity{identity}, []Recipient{NewPasswordRecipient("new-password", DefaultOptions())})
+	if err != nil {
+		t.Fatalf("AddRecipients() error = %v", err)
+	}
+	plaintext, err := Decrypt(updated, "new-password")
+	if err != nil || !bytes.Equal(plaintext, data) {
+		t.Errorf("新しいパスワードで復号化できません: %q, %v", plaintext, err)
+	}
+
+	if _, err := CombineRecoveryShares(parsed[:2]); !errors.Is(err, ErrNotEnoughShares) {
+		t.Errorf("2個の分割片で error = %v, want %v", err, ErrNotEnoughShares)
+	}
+	if _, err := CombineRecoveryShares([]*RecoveryShare{shares[0], shares[0], shares[1]}); !errors.Is(err, ErrNotEnoughShares) {
+		t.Errorf("重複した分割片で error = %v, want %v", err, ErrNotEnoughShares)
+	}
+
+	// 別のファイルの分割片が混ざっている場合
+	other, err := SplitRecoveryShares(updated, []Identity{NewPasswordIdentity(password)}, 3, 2)
+	if err != nil {
+		t.Fatalf("SplitRecoveryShares() error = %v", err)
+	}
+	if _, err := CombineRecoveryShares([]*RecoveryShare{shares[0], other[1]}); !errors.Is(err, ErrRecoveryShareMixed) {
+		t.Errorf("別の分割の分割片で error = %v, want %v", err, ErrRecoveryShareMixed)
+	}
+
+	// データ鍵の異なるファイルは開けない
+	another, err := Encrypt(data, password)
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	if _, err := DecryptWithIdentities(another, []Identity{identity}); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("別のファイルで error = %v, want %v", err, ErrDecryptionFailed)
+	}
+
+	// Destroy した後は復元した鍵を使用できない
+	identity.Destroy()
+	if key, err := identity.Unwrap(nil); err == nil || len(key) != 0 {
+		t.Errorf("Destroy() 後の Unwrap() = %x, %v", key, err)
+	}
+	if _, err := DecryptWithIdentities(updated, []Identity{identity}); err == nil {
+		t.Error("Destroy() 後の鍵で復号化できてしまいました")
+	}
+}
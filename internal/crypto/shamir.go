@@ -0,0 +1,125 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// GF(2^8) 上のシャミアの秘密分散
+//
+// 秘密の各バイトを定数項とする threshold-1 次のランダムな多項式を作り、x = 1..n での値を分割片とします
+// threshold 個の分割片からラグランジュ補間で x = 0 の値（秘密）を復元します
+// 体の既約多項式は AES と同じ x^8 + x^4 + x^3 + x + 1 です
+
+var (
+	gfExp [510]byte
+	gfLog [256]byte
+)
+
+func init() {
+	// 生成元 3 のべき乗で指数表と対数表を作成する
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfExp[i+255] = x
+		gfLog[x] = byte(i)
+		x = gfMulNoTable(x, 3)
+	}
+}
+
+func gfMulNoTable(a, b byte) byte {
+	var p byte
+	for b > 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	// b は0以外（呼び出し側で x 座標が重複しないことを確認済み）
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// splitSecret は secret を threshold 個で復元できる n 個の分割片に分けます
+// 分割片 i（0始まり）の x 座標は i+1 で、値は secret と同じ長さです
+func splitSecret(secret []byte, n, threshold int) ([][]byte, error) {
+	if threshold < 2 || threshold > n || n > 255 {
+		return nil, fmt.Errorf("分割数と必要数は 2 ≤ 必要数 ≤ 分割数 ≤ 255 の範囲で指定してください（分割数 %d、必要数 %d）", n, threshold)
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret))
+	}
+
+	coefficients := make([]byte, threshold)
+	for j, s := range secret {
+		coefficients[0] = s
+		if _, err := io.ReadFull(rand.Reader, coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("乱数の生成に失敗しました: %w", err)
+		}
+		for i := range shares {
+			// ホーナー法で多項式を x = i+1 で評価する
+			x := byte(i + 1)
+			var y byte
+			for k := threshold - 1; k >= 0; k-- {
+				y = gfMul(y, x) ^ coefficients[k]
+			}
+			shares[i][j] = y
+		}
+	}
+	clear(coefficients)
+	return shares, nil
+}
+
+// combineSecret は x 座標と値の組から秘密を復元します
+func combineSecret(xs []byte, ys [][]byte) ([]byte, error) {
+	if len(xs) == 0 || len(xs) != len(ys) {
+		return nil, errors.New("分割片がありません")
+	}
+	for i := range xs {
+		if xs[i] == 0 || len(ys[i]) != len(ys[0]) {
+			return nil, errors.New("分割片の形式が正しくありません")
+		}
+		for j := 0; j < i; j++ {
+			if xs[i] == xs[j] {
+				return nil, errors.New("同じ番号の分割片が重複しています")
+			}
+		}
+	}
+
+	secret := make([]byte, len(ys[0]))
+	for i := range xs {
+		// x = 0 でのラグランジュ基底多項式の値
+		basis := byte(1)
+		for j := range xs {
+			if i != j {
+				basis = gfMul(basis, gfDiv(xs[j], xs[j]^xs[i]))
+			}
+		}
+		for k := range secret {
+			secret[k] ^= gfMul(ys[i][k], basis)
+		}
+	}
+	return secret, nil
+}
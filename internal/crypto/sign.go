@@ -0,0 +1,338 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/uzulla/envault/internal/armor"
+)
+
+// 暗号化ファイルのEd25519署名
+//
+// AES-GCMの認証はパスワードを知らない人による改ざんを検出しますが、共有パスワードを知っている人は
+// 新しい暗号化ファイルを作成できます。署名は、信頼された署名者が作成したファイルであることを確認するために使用します
+// 署名の対象は暗号化ファイルの内容（ASCII armorを外し、埋め込み署名を除いたもの）のSHA-512ハッシュです
+
+const (
+	SigningPublicKeyPrefix = "envault-sign-pub-"
+	SigningSecretKeyPrefix = "ENVAULT-SIGN-SECRET-KEY-"
+	SignaturePrefix        = "envault-sig-"
+
+	// 署名する内容の先頭に付ける文字列（他の用途の署名と区別するため）
+	signatureContext = "envault/signature/v1\x00"
+
+	// 埋め込み署名は「暗号化ファイル ‖ 署名ブロック ‖ 署名ブロックの長さ（4バイト）‖ マジック」の形式でファイル末尾に置きます
+	signatureTrailerMagic = "ENVSIG01"
+	// SignatureFooterSize はファイル末尾の署名ブロックの長さとマジックのバイト数です
+	SignatureFooterSize = 4 + len(signatureTrailerMagic)
+	// 壊れたファイルで巨大なメモリを確保しないための署名ブロックの上限
+	maxSignatureBlockSize = 1 << 20
+)
+
+var (
+	ErrNoSignature      = errors.New("署名がありません")
+	ErrInvalidSignature = errors.New("署名が一致しません（ファイルが署名後に変更されています）")
+	ErrUntrustedSigner  = errors.New("信頼された署名者による署名がありません")
+)
+
+// SigningKey は暗号化ファイルに署名するEd25519の秘密鍵です
+type SigningKey struct {
+	privateKey ed25519.PrivateKey
+}
+
+// SigningPublicKey は署名を検証するEd25519の公開鍵です
+type SigningPublicKey struct {
+	publicKey ed25519.PublicKey
+}
+
+// Signature は署名者の公開鍵と署名の値の組です
+type Signature struct {
+	Signer *SigningPublicKey
+	Value  []byte
+}
+
+// SignerEntry は信頼された署名者のファイルの1行（公開鍵とラベル）です
+type SignerEntry struct {
+	PublicKey string
+	Label     string
+}
+
+// GenerateSigningKey は新しい署名用の秘密鍵を生成します
+func GenerateSigningKey() (*SigningKey, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("署名鍵の生成に失敗しました: %w", err)
+	}
+	return &SigningKey{privateKey: privateKey}, nil
+}
+
+// ParseSigningKey は「ENVAULT-SIGN-SECRET-KEY-」で始まる秘密鍵を読み取ります
+func ParseSigningKey(s string) (*SigningKey, error) {
+	seed, err := decodeKeyString(s, SigningSecretKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("署名鍵を読み取れません: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("署名鍵の長さが不正です: %dバイト", len(seed))
+	}
+	return &SigningKey{privateKey: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// ParseSigningKeyFile は署名鍵ファイルの内容から秘密鍵を読み取ります
+// 空行と「#」で始まる行は無視されます
+func ParseSigningKeyFile(data []byte) (*SigningKey, error) {
+	var key *SigningKey
+	err := scanKeyLines(data, func(line string) error {
+		if key != nil {
+			return errors.New("署名鍵ファイルには秘密鍵を1つだけ記述してください")
+		}
+		k, err := ParseSigningKey(line)
+		if err != nil {
+			return err
+		}
+		key = k
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, errors.New("署名鍵ファイルに秘密鍵がありません")
+	}
+	return key, nil
+}
+
+// String は秘密鍵を文字列（接頭辞 + base64url(シード)）で返します
+func (k *SigningKey) String() string {
+	return SigningSecretKeyPrefix + base64.RawURLEncoding.EncodeToString(k.privateKey.Seed())
+}
+
+// Public は秘密鍵に対応する公開鍵を返します
+func (k *SigningKey) Public() *SigningPublicKey {
+	return &SigningPublicKey{publicKey: k.privateKey.Public().(ed25519.PublicKey)}
+}
+
+// Sign は DigestVault で計算したハッシュに署名します
+func (k *SigningKey) Sign(digest []byte) *Signature {
+	return &Signature{
+		Signer: k.Public(),
+		Value:  ed25519.Sign(k.privateKey, signedMessage(digest)),
+	}
+}
+
+// ParseSigningPublicKey は「envault-sign-pub-」で始まる公開鍵を読み取ります
+func ParseSigningPublicKey(s string) (*SigningPublicKey, error) {
+	raw, err := decodeKeyString(s, SigningPublicKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("署名者の公開鍵を読み取れません: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("署名者の公開鍵の長さが不正です: %dバイト", len(raw))
+	}
+	return &SigningPublicKey{publicKey: ed25519.PublicKey(raw)}, nil
+}
+
+// String は公開鍵を文字列（接頭辞 + base64url(公開鍵)）で返します
+func (p *SigningPublicKey) String() string {
+	return SigningPublicKeyPrefix + base64.RawURLEncoding.EncodeToString(p.publicKey)
+}
+
+// Fingerprint は公開鍵のフィンガープリントを返します
+func (p *SigningPublicKey) Fingerprint() string {
+	return Fingerprint(p.String())
+}
+
+// Equal は同じ公開鍵かどうかを返します
+func (p *SigningPublicKey) Equal(other *SigningPublicKey) bool {
+	return p.publicKey.Equal(other.publicKey)
+}
+
+// Verify は署名が DigestVault で計算したハッシュに対して正しいかどうかを返します
+func (s *Signature) Verify(digest []byte) bool {
+	return ed25519.Verify(s.Signer.publicKey, signedMessage(digest), s.Value)
+}
+
+// String は署名を1行の文字列「公開鍵 署名」で返します
+func (s *Signature) String() string {
+	return s.Signer.String() + " " + SignaturePrefix + base64.RawURLEncoding.EncodeToString(s.Value)
+}
+
+func signedMessage(digest []byte) []byte {
+	return append([]byte(signatureContext), digest...)
+}
+
+// DigestVault は署名の対象となる暗号化ファイルの内容のハッシュを計算します
+// r には ASCII armor を外し、埋め込み署名を除いた内容を渡します
+func DigestVault(r io.Reader) ([]byte, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// ParseSignatures は署名ファイル（1行に1つの署名）の内容を読み取ります
+// 空行と「#」で始まる行は無視されます
+func ParseSignatures(data []byte) ([]*Signature, error) {
+	var signatures []*Signature
+	err := scanKeyLines(data, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return errors.New("署名は「公開鍵 署名」の形式で記述してください")
+		}
+		signer, err := ParseSigningPublicKey(fields[0])
+		if err != nil {
+			return err
+		}
+		value, err := decodeKeyString(fields[1], SignaturePrefix)
+		if err != nil || len(value) != ed25519.SignatureSize {
+			return errors.New("署名を読み取れません")
+		}
+		signatures = append(signatures, &Signature{Signer: signer, Value: value})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return signatures, nil
+}
+
+// MarshalSignatures は署名を署名ファイルの形式（1行に1つの署名）で返します
+func MarshalSignatures(signatures []*Signature) []byte {
+	var buf bytes.Buffer
+	for _, s := range signatures {
+		buf.WriteString(s.String() + "\n")
+	}
+	return buf.Bytes()
+}
+
+// AddSignature は署名のリストに新しい署名を加えます
+// 同じ署名者の古い署名と、digest に対して正しくない（ファイルの変更前の）署名は取り除きます
+func AddSignature(signatures []*Signature, signature *Signature, digest []byte) []*Signature {
+	result := make([]*Signature, 0, len(signatures)+1)
+	for _, s := range signatures {
+		if s.Signer.Equal(signature.Signer) || !s.Verify(digest) {
+			continue
+		}
+		result = append(result, s)
+	}
+	return append(result, signature)
+}
+
+// EmbedSignatures は暗号化ファイルの末尾に署名を埋め込んだデータを返します
+// 署名がない場合は vault をそのまま返します
+func EmbedSignatures(vault []byte, signatures []*Signature) []byte {
+	if len(signatures) == 0 {
+		return vault
+	}
+	block := MarshalSignatures(signatures)
+
+	result := make([]byte, 0, len(vault)+len(block)+SignatureFooterSize)
+	result = append(result, vault...)
+	result = append(result, block...)
+	result = binary.BigEndian.AppendUint32(result, uint32(len(block)))
+	return append(result, signatureTrailerMagic...)
+}
+
+// SignatureTrailerSize はファイル末尾の SignatureFooterSize バイトから、埋め込み署名全体の長さを返します
+// 署名が埋め込まれていない場合は0を返します
+func SignatureTrailerSize(footer []byte) (int, error) {
+	if len(footer) != SignatureFooterSize || !bytes.HasSuffix(footer, []byte(signatureTrailerMagic)) {
+		return 0, nil
+	}
+	blockSize := binary.BigEndian.Uint32(footer)
+	if blockSize > maxSignatureBlockSize {
+		return 0, fmt.Errorf("%w: 埋め込み署名の長さが不正です (%d バイト)", ErrInvalidFile, blockSize)
+	}
+	return int(blockSize) + SignatureFooterSize, nil
+}
+
+// SplitSignatures は暗号化ファイルと埋め込み署名を分けます
+// 署名が埋め込まれていない場合は data をそのまま返します
+func SplitSignatures(data []byte) (vault []byte, signatures []*Signature, err error) {
+	if len(data) < SignatureFooterSize {
+		return data, nil, nil
+	}
+	trailerSize, err := SignatureTrailerSize(data[len(data)-SignatureFooterSize:])
+	if err != nil {
+		return nil, nil, err
+	}
+	if trailerSize == 0 {
+		return data, nil, nil
+	}
+	if trailerSize > len(data) {
+		return nil, nil, ErrTruncatedFile
+	}
+
+	vault = data[:len(data)-trailerSize]
+	signatures, err = ParseSignatures(data[len(vault) : len(data)-SignatureFooterSize])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: 埋め込み署名を読み取れません: %v", ErrInvalidFile, err)
+	}
+	return vault, signatures, nil
+}
+
+// VerifySignatures は信頼された署名者による正しい署名を探し、最初に見つかったものを返します
+// 署名がない場合は ErrNoSignature、正しい署名がない場合は ErrInvalidSignature、
+// 正しい署名があっても信頼された署名者のものでない場合は ErrUntrustedSigner を返します
+func VerifySignatures(digest []byte, signatures []*Signature, trusted []*SigningPublicKey) (*Signature, error) {
+	if len(signatures) == 0 {
+		return nil, ErrNoSignature
+	}
+
+	verified := false
+	for _, s := range signatures {
+		if !s.Verify(digest) {
+			continue
+		}
+		verified = true
+		for _, t := range trusted {
+			if s.Signer.Equal(t) {
+				return s, nil
+			}
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidSignature
+	}
+	return nil, ErrUntrustedSigner
+}
+
+// ParseSignerEntries は信頼された署名者のファイルの内容を読み取ります
+// 空行と「#」で始まる行は無視され、それ以外の各行は「公開鍵 [ラベル]」として扱われます
+func ParseSignerEntries(data []byte) ([]SignerEntry, error) {
+	var entries []SignerEntry
+	err := scanKeyLines(data, func(line string) error {
+		fields := strings.Fields(line)
+		if _, err := ParseSigningPublicKey(fields[0]); err != nil {
+			return err
+		}
+		entries = append(entries, SignerEntry{
+			PublicKey: fields[0],
+			Label:     strings.Join(fields[1:], " "),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// decodeVault はASCII armorと埋め込み署名を外し、暗号化ファイル本体を返します
+func decodeVault(data []byte) ([]byte, error) {
+	data, err := armor.DecodeIfArmored(data)
+	if err != nil {
+		return nil, err
+	}
+	vault, _, err := SplitSignatures(data)
+	return vault, err
+}
@@ -0,0 +1,187 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/uzulla/envault/internal/armor"
+)
+
+func generateSigningKeyForTest(t *testing.T) *SigningKey {
+	t.Helper()
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey() error = %v", err)
+	}
+	return key
+}
+
+func TestSigningKeyString(t *testing.T) {
+	key := generateSigningKeyForTest(t)
+
+	parsed, err := ParseSigningKeyFile([]byte("# コメント\n" + key.String() + "\n"))
+	if err != nil {
+		t.Fatalf("ParseSigningKeyFile() error = %v", err)
+	}
+	if !parsed.Public().Equal(key.Public()) {
+		t.Error("読み取った署名鍵の公開鍵が一致しません")
+	}
+
+	publicKey, err := ParseSigningPublicKey(key.Public().String())
+	if err != nil {
+		t.Fatalf("ParseSigningPublicKey() error = %v", err)
+	}
+	if !publicKey.Equal(key.Public()) {
+		t.Error("読み取った公開鍵が一致しません")
+	}
+
+	invalid := []string{
+		"",
+		key.Public().String(),
+		SigningSecretKeyPrefix + "AAAA",
+		key.String() + "\n" + key.String(),
+	}
+	for _, s := range invalid {
+		if _, err := ParseSigningKeyFile([]byte(s)); err == nil {
+			t.Errorf("ParseSigningKeyFile(%q) でエラーが返されませんでした", s)
+		}
+	}
+	if _, err := ParseSigningPublicKey(key.String()); err == nil {
+		t.Error("秘密鍵を公開鍵として読み取れてしまいました")
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	alice := generateSigningKeyForTest(t)
+	bob := generateSigningKeyForTest(t)
+
+	vault, err := Encrypt([]byte("TEST_VAR1=value1"), "test-password")
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	digest, err := DigestVault(bytes.NewReader(vault))
+	if err != nil {
+		t.Fatalf("DigestVault() error = %v", err)
+	}
+
+	signature := alice.Sign(digest)
+	signatures, err := ParseSignatures(MarshalSignatures([]*Signature{signature}))
+	if err != nil {
+		t.Fatalf("ParseSignatures() error = %v", err)
+	}
+
+	tampered := append([]byte{}, vault...)
+	tampered[len(tampered)-1] ^= 1
+	tamperedDigest, _ := DigestVault(bytes.NewReader(tampered))
+
+	tests := []struct {
+		name       string
+		digest     []byte
+		signatures []*Signature
+		trusted    []*SigningPublicKey
+		wantErr    error
+	}{
+		{"信頼された署名者", digest, signatures, []*SigningPublicKey{bob.Public(), alice.Public()}, nil},
+		{"署名がない", digest, nil, []*SigningPublicKey{alice.Public()}, ErrNoSignature},
+		{"信頼されていない署名者", digest, signatures, []*SigningPublicKey{bob.Public()}, ErrUntrustedSigner},
+		{"署名後に変更された", tamperedDigest, signatures, []*SigningPublicKey{alice.Public()}, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := VerifySignatures(tt.digest, tt.signatures, tt.trusted)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifySignatures() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !signer.Signer.Equal(alice.Public()) {
+				t.Error("VerifySignatures() が別の署名者を返しました")
+			}
+		})
+	}
+}
+
+func TestAddSignature(t *testing.T) {
+	alice := generateSigningKeyForTest(t)
+	bob := generateSigningKeyForTest(t)
+	oldDigest := []byte("old")
+	digest := []byte("new")
+
+	// ファイルの変更前の署名と、同じ署名者の古い署名は取り除かれる
+	signatures := []*Signature{alice.Sign(oldDigest), bob.Sign(digest)}
+	signatures = AddSignature(signatures, bob.Sign(digest), digest)
+	if len(signatures) != 1 || !signatures[0].Signer.Equal(bob.Public()) {
+		t.Fatalf("AddSignature() = %d件, want bobの署名1件", len(signatures))
+	}
+
+	signatures = AddSignature(signatures, alice.Sign(digest), digest)
+	if len(signatures) != 2 {
+		t.Errorf("AddSignature() = %d件, want 2件", len(signatures))
+	}
+}
+
+func TestEmbedSignatures(t *testing.T) {
+	key := generateSigningKeyForTest(t)
+	password := "test-password"
+
+	vault, err := Encrypt([]byte("TEST_VAR1=value1"), password)
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+	digest, _ := DigestVault(bytes.NewReader(vault))
+	signed := EmbedSignatures(vault, []*Signature{key.Sign(digest)})
+
+	body, signatures, err := SplitSignatures(signed)
+	if err != nil {
+		t.Fatalf("SplitSignatures() error = %v", err)
+	}
+	if !bytes.Equal(body, vault) || len(signatures) != 1 || !signatures[0].Verify(digest) {
+		t.Error("SplitSignatures() が埋め込み前の内容と署名を返しません")
+	}
+
+	// 署名を埋め込んだファイル（armor形式を含む）もそのまま復号化・解析できること
+	for name, data := range map[string][]byte{"通常の形式": signed, "ASCII armor形式": armor.Encode(signed)} {
+		plaintext, err := Decrypt(data, password)
+		if err != nil || string(plaintext) != "TEST_VAR1=value1" {
+			t.Errorf("%s: Decrypt() = %q, %v", name, plaintext, err)
+		}
+		info, err := Inspect(data)
+		if err != nil {
+			t.Fatalf("%s: Inspect() error = %v", name, err)
+		}
+		if len(info.Signers) != 1 || info.Signers[0] != key.Public().Fingerprint() {
+			t.Errorf("%s: Inspect().Signers = %v", name, info.Signers)
+		}
+	}
+
+	// 署名がない場合はそのまま返す
+	if body, signatures, err := SplitSignatures(vault); err != nil || !bytes.Equal(body, vault) || signatures != nil {
+		t.Errorf("SplitSignatures(署名なし) = %d バイト, %v, %v", len(body), signatures, err)
+	}
+
+	broken := append([]byte{}, signed...)
+	copy(broken[len(vault):], "envault-sign-pub-!!")
+	if _, _, err := SplitSignatures(broken); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("壊れた埋め込み署名で error = %v, want %v", err, ErrInvalidFile)
+	}
+	if _, _, err := SplitSignatures(signed[len(signed)-SignatureFooterSize-10:]); !errors.Is(err, ErrTruncatedFile) {
+		t.Errorf("切り詰めた埋め込み署名で error = %v, want %v", err, ErrTruncatedFile)
+	}
+}
+
+func TestParseSignerEntries(t *testing.T) {
+	key := generateSigningKeyForTest(t)
+	data := "# 信頼された署名者\n\n" + key.Public().String() + " alice <alice@example.com>\n"
+
+	entries, err := ParseSignerEntries([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseSignerEntries() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].PublicKey != key.Public().String() || entries[0].Label != "alice <alice@example.com>" {
+		t.Errorf("ParseSignerEntries() = %+v", entries)
+	}
+
+	if _, err := ParseSignerEntries([]byte("envault-pub-invalid\n")); err == nil || !strings.Contains(err.Error(), "1行目") {
+		t.Errorf("不正な公開鍵で error = %v, want 1行目のエラー", err)
+	}
+}
@@ -0,0 +1,255 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"filippo.io/edwards25519"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	SlotTypeSSHEd25519 = "ssh-ed25519"
+	SlotTypeSSHRSA     = "ssh-rsa"
+
+	sshEd25519WrapInfo = "envault/ssh-ed25519"
+	sshRSAOAEPLabel    = "envault/ssh-rsa"
+
+	// 受け付けるRSA鍵の最小ビット数
+	minRSAKeyBits = 2048
+)
+
+var (
+	ErrUnsupportedSSHKey = errors.New("未対応のSSH鍵です（ssh-ed25519 または ssh-rsa のみ対応しています）")
+	ErrSSHPassphrase     = errors.New("SSH秘密鍵のパスフレーズが正しくありません")
+)
+
+// SSHRecipient はSSH公開鍵（ssh-ed25519 または ssh-rsa）の受信者です
+// ed25519鍵はX25519鍵に変換して鍵交換を行い、RSA鍵はRSA-OAEPでデータ鍵を包みます
+type SSHRecipient struct {
+	publicKey ssh.PublicKey
+	x25519    *ecdh.PublicKey
+}
+
+// SSHIdentity はSSH秘密鍵です
+type SSHIdentity struct {
+	publicKey  ssh.PublicKey
+	ed25519Key ed25519.PrivateKey
+	rsaKey     *rsa.PrivateKey
+	x25519     *ecdh.PrivateKey
+}
+
+// ParseSSHRecipient は authorized_keys 形式の1行（「ssh-ed25519 AAAA... comment」など）を読み取ります
+func ParseSSHRecipient(s string) (*SSHRecipient, error) {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s))
+	if err != nil {
+		return nil, fmt.Errorf("無効なSSH公開鍵です: %w", err)
+	}
+	return newSSHRecipient(publicKey)
+}
+
+// ParseSSHRecipients は .pub ファイルまたは authorized_keys 形式のファイルの内容を読み取ります
+// 空行と「#」で始まる行は無視されます
+func ParseSSHRecipients(data []byte) ([]Recipient, error) {
+	var recipients []Recipient
+	err := scanKeyLines(data, func(line string) error {
+		r, err := ParseSSHRecipient(line)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("SSH公開鍵が含まれていません")
+	}
+	return recipients, nil
+}
+
+func newSSHRecipient(publicKey ssh.PublicKey) (*SSHRecipient, error) {
+	cryptoKey, ok := publicKey.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, ErrUnsupportedSSHKey
+	}
+
+	r := &SSHRecipient{publicKey: publicKey}
+	switch publicKey.Type() {
+	case ssh.KeyAlgoED25519:
+		x25519, err := ed25519PublicKeyToX25519(cryptoKey.CryptoPublicKey().(ed25519.PublicKey))
+		if err != nil {
+			return nil, err
+		}
+		r.x25519 = x25519
+	case ssh.KeyAlgoRSA:
+		if cryptoKey.CryptoPublicKey().(*rsa.PublicKey).Size()*8 < minRSAKeyBits {
+			return nil, fmt.Errorf("%w: RSA鍵は%dビット以上が必要です", ErrUnsupportedSSHKey, minRSAKeyBits)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedSSHKey, publicKey.Type())
+	}
+	return r, nil
+}
+
+// ParseSSHIdentity はOpenSSHまたはPEM形式のSSH秘密鍵を読み取ります
+// 鍵がパスフレーズで保護されている場合のみ passphrase が呼び出されます
+func ParseSSHIdentity(pemBytes []byte, passphrase func() ([]byte, error)) (*SSHIdentity, error) {
+	key, err := ssh.ParseRawPrivateKey(pemBytes)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		if passphrase == nil {
+			return nil, fmt.Errorf("SSH秘密鍵がパスフレーズで保護されています")
+		}
+		pass, perr := passphrase()
+		if perr != nil {
+			return nil, perr
+		}
+		key, err = ssh.ParseRawPrivateKeyWithPassphrase(pemBytes, pass)
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			return nil, ErrSSHPassphrase
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("無効なSSH秘密鍵です: %w", err)
+	}
+
+	id := &SSHIdentity{}
+	switch k := key.(type) {
+	case *ed25519.PrivateKey:
+		id.ed25519Key = *k
+	case ed25519.PrivateKey:
+		id.ed25519Key = k
+	case *rsa.PrivateKey:
+		id.rsaKey = k
+	default:
+		return nil, ErrUnsupportedSSHKey
+	}
+
+	var publicKey ssh.PublicKey
+	if id.ed25519Key != nil {
+		publicKey, err = ssh.NewPublicKey(id.ed25519Key.Public())
+		if err == nil {
+			id.x25519, err = ed25519PrivateKeyToX25519(id.ed25519Key)
+		}
+	} else {
+		publicKey, err = ssh.NewPublicKey(&id.rsaKey.PublicKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("無効なSSH秘密鍵です: %w", err)
+	}
+	id.publicKey = publicKey
+	return id, nil
+}
+
+// String はSSH公開鍵を authorized_keys 形式（コメントなし）で返します
+func (r *SSHRecipient) String() string {
+	return sshPublicKeyString(r.publicKey)
+}
+
+// Wrap はSSH公開鍵でデータ鍵を包みます
+func (r *SSHRecipient) Wrap(dataKey []byte) (*Slot, error) {
+	if r.publicKey.Type() == ssh.KeyAlgoRSA {
+		rsaKey := r.publicKey.(ssh.CryptoPublicKey).CryptoPublicKey().(*rsa.PublicKey)
+		wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaKey, dataKey, []byte(sshRSAOAEPLabel))
+		if err != nil {
+			return nil, fmt.Errorf("データ鍵の暗号化に失敗しました: %w", err)
+		}
+		return &Slot{
+			Type:       SlotTypeSSHRSA,
+			Recipient:  r.String(),
+			WrappedKey: wrappedKey,
+		}, nil
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("エフェメラル鍵の生成に失敗しました: %w", err)
+	}
+	shared, err := ephemeral.ECDH(r.x25519)
+	if err != nil {
+		return nil, fmt.Errorf("鍵交換に失敗しました: %w", err)
+	}
+
+	ephemeralPublic := ephemeral.PublicKey().Bytes()
+	wrapKey, err := x25519WrapKey(shared, ephemeralPublic, r.x25519.Bytes(), sshEd25519WrapInfo)
+	if err != nil {
+		return nil, err
+	}
+	wrappedKey, err := sealKey(wrapKey, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Slot{
+		Type:       SlotTypeSSHEd25519,
+		Recipient:  r.String(),
+		Ephemeral:  ephemeralPublic,
+		WrappedKey: wrappedKey,
+	}, nil
+}
+
+// Recipient は秘密鍵に対応する公開鍵を返します
+func (i *SSHIdentity) Recipient() *SSHRecipient {
+	r, _ := newSSHRecipient(i.publicKey)
+	return r
+}
+
+// Unwrap は自分宛てのSSHスロットからデータ鍵を取り出します
+func (i *SSHIdentity) Unwrap(slot *Slot) ([]byte, error) {
+	if slot.Type != i.publicKey.Type() || slot.Recipient != sshPublicKeyString(i.publicKey) {
+		return nil, errSlotMismatch
+	}
+
+	if i.rsaKey != nil {
+		dataKey, err := rsa.DecryptOAEP(sha256.New(), nil, i.rsaKey, slot.WrappedKey, []byte(sshRSAOAEPLabel))
+		if err != nil {
+			return nil, ErrDecryptionFailed
+		}
+		return dataKey, nil
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(slot.Ephemeral)
+	if err != nil {
+		return nil, ErrInvalidFile
+	}
+	shared, err := i.x25519.ECDH(ephemeral)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	wrapKey, err := x25519WrapKey(shared, slot.Ephemeral, i.x25519.PublicKey().Bytes(), sshEd25519WrapInfo)
+	if err != nil {
+		return nil, err
+	}
+	return openKey(wrapKey, slot.WrappedKey)
+}
+
+// authorized_keys 形式からコメントと改行を除いた公開鍵文字列を返します
+func sshPublicKeyString(publicKey ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+}
+
+// ed25519公開鍵を対応するX25519公開鍵（Montgomery形式）に変換します
+func ed25519PublicKeyToX25519(publicKey ed25519.PublicKey) (*ecdh.PublicKey, error) {
+	point, err := new(edwards25519.Point).SetBytes(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("無効なed25519公開鍵です: %w", err)
+	}
+	return ecdh.X25519().NewPublicKey(point.BytesMontgomery())
+}
+
+// ed25519秘密鍵を対応するX25519秘密鍵に変換します（RFC 8032のスカラー導出）
+func ed25519PrivateKeyToX25519(privateKey ed25519.PrivateKey) (*ecdh.PrivateKey, error) {
+	h := sha512.Sum512(privateKey.Seed())
+	return ecdh.X25519().NewPrivateKey(h[:32])
+}
@@ -0,0 +1,130 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// テスト用のSSH秘密鍵（OpenSSH形式）と公開鍵（authorized_keys形式）を作成する
+func generateSSHKeyForTest(t *testing.T, keyType string, passphrase string) ([]byte, string) {
+	t.Helper()
+
+	var privateKey interface{}
+	var publicKey interface{}
+	switch keyType {
+	case ssh.KeyAlgoED25519:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("ed25519鍵の生成に失敗しました: %v", err)
+		}
+		privateKey, publicKey = priv, pub
+	case ssh.KeyAlgoRSA:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("RSA鍵の生成に失敗しました: %v", err)
+		}
+		privateKey, publicKey = priv, &priv.PublicKey
+	}
+
+	var block *pem.Block
+	var err error
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(privateKey, "test")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(privateKey, "test", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatalf("SSH秘密鍵の作成に失敗しました: %v", err)
+	}
+
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("SSH公開鍵の作成に失敗しました: %v", err)
+	}
+	return pem.EncodeToMemory(block), string(ssh.MarshalAuthorizedKey(sshPublicKey))
+}
+
+func TestSSHRecipients(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1\n")
+	edPrivate, edPublic := generateSSHKeyForTest(t, ssh.KeyAlgoED25519, "")
+	rsaPrivate, rsaPublic := generateSSHKeyForTest(t, ssh.KeyAlgoRSA, "")
+	otherPrivate, _ := generateSSHKeyForTest(t, ssh.KeyAlgoED25519, "")
+
+	recipients, err := ParseSSHRecipients([]byte("# authorized_keys\n" + edPublic + "no-pty " + rsaPublic))
+	if err != nil {
+		t.Fatalf("ParseSSHRecipients() error = %v", err)
+	}
+	if len(recipients) != 2 {
+		t.Fatalf("受信者の数 = %d, want 2", len(recipients))
+	}
+
+	encrypted, err := EncryptToRecipients(testData, recipients)
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	for _, key := range [][]byte{edPrivate, rsaPrivate} {
+		id, err := ParseSSHIdentity(key, nil)
+		if err != nil {
+			t.Fatalf("ParseSSHIdentity() error = %v", err)
+		}
+		decrypted, err := DecryptWithIdentities(encrypted, []Identity{id})
+		if err != nil {
+			t.Fatalf("%s で復号化できません: %v", id.publicKey.Type(), err)
+		}
+		if !bytes.Equal(decrypted, testData) {
+			t.Errorf("復号化されたデータが元のデータと一致しません")
+		}
+	}
+
+	other, err := ParseSSHIdentity(otherPrivate, nil)
+	if err != nil {
+		t.Fatalf("ParseSSHIdentity() error = %v", err)
+	}
+	if _, err := DecryptWithIdentities(encrypted, []Identity{other}); !errors.Is(err, ErrNoIdentityMatched) {
+		t.Errorf("DecryptWithIdentities(other) error = %v, want %v", err, ErrNoIdentityMatched)
+	}
+
+	// age形式でも同じ鍵を使用できること
+	ageEncrypted, err := EncryptAge(testData, recipients[:1])
+	if err != nil {
+		t.Fatalf("age形式の暗号化に失敗しました: %v", err)
+	}
+	edIdentity, _ := ParseSSHIdentity(edPrivate, nil)
+	if decrypted, err := DecryptWithIdentities(ageEncrypted, []Identity{edIdentity}); err != nil || !bytes.Equal(decrypted, testData) {
+		t.Errorf("age形式のファイルをSSH秘密鍵で復号化できません: %v", err)
+	}
+}
+
+func TestParseSSHIdentityWithPassphrase(t *testing.T) {
+	privateKey, _ := generateSSHKeyForTest(t, ssh.KeyAlgoED25519, "ssh-passphrase")
+
+	if _, err := ParseSSHIdentity(privateKey, nil); err == nil {
+		t.Errorf("パスフレーズなしで保護された鍵を読み込めてしまいました")
+	}
+
+	if _, err := ParseSSHIdentity(privateKey, func() ([]byte, error) {
+		return []byte("wrong"), nil
+	}); !errors.Is(err, ErrSSHPassphrase) {
+		t.Errorf("ParseSSHIdentity(wrong passphrase) error = %v, want %v", err, ErrSSHPassphrase)
+	}
+
+	if _, err := ParseSSHIdentity(privateKey, func() ([]byte, error) {
+		return []byte("ssh-passphrase"), nil
+	}); err != nil {
+		t.Errorf("ParseSSHIdentity(passphrase) error = %v", err)
+	}
+}
+
+func TestParseSSHRecipientRejectsUnsupportedKeys(t *testing.T) {
+	if _, err := ParseSSHRecipient("ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBEmKSENjQEezOmxkZMy7opKgwFB9nkt5YRrYMjNuG5N87uRgg6CLrbo5wAdT/y6v0mKV0U2w0WZ2YB/++Tpockg="); !errors.Is(err, ErrUnsupportedSSHKey) {
+		t.Errorf("ParseSSHRecipient(ecdsa) error = %v, want %v", err, ErrUnsupportedSSHKey)
+	}
+}
@@ -0,0 +1,418 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/uzulla/envault/pkg/secret"
+)
+
+// STREAM構成（Hoang, Reyhanitabar, Rogaway, Vizár 2015）によるチャンク単位の暗号化
+//
+// 平文を StreamChunkSize ごとのチャンクに分け、チャンクごとに認証付き暗号化します
+// 各チャンクのnonceは「ランダムな接頭辞 ‖ チャンク番号（4バイト）‖ 最終チャンクフラグ（1バイト）」です
+// チャンクの並べ替え・差し替えはnonceの不一致で、末尾の切り詰めは最終チャンクフラグで検出されます
+
+const (
+	// StreamChunkSize は平文のチャンクの長さです（最終チャンクのみ短くなります）
+	StreamChunkSize = 64 * 1024
+
+	// nonceのうちチャンク番号と最終チャンクフラグが占めるバイト数
+	streamNonceSuffixSize = 4 + 1
+	// 細工されたヘッダで過大なメモリを確保しないためのチャンク長の上限
+	maxStreamChunkSize = 1 << 20
+)
+
+var errStreamClosed = errors.New("暗号化ストリームは既に閉じられています")
+
+// NewEncryptWriter は書き込まれたデータを32バイトの鍵で暗号化し、w に書き込む WriteCloser を返します
+// 暗号方式は AES-256-GCM で、先頭にランダムなnonceの接頭辞を書き込みます
+// 最終チャンクは Close で書き込まれるため、Close を呼ばずに終えたデータは復号時に切り詰めとして扱われます
+// Close は w を閉じません
+func NewEncryptWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, aead.NonceSize()-streamNonceSuffixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, fmt.Errorf("nonceの生成に失敗しました: %w", err)
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return nil, err
+	}
+
+	return newStreamWriter(w, aead, prefix, nil, StreamChunkSize), nil
+}
+
+// NewDecryptReader は NewEncryptWriter で暗号化されたデータを復号化しながら読み出す Reader を返します
+// 各チャンクは認証されてから読み出されます
+// データが途中で切り詰められている場合、Read は ErrTruncatedFile または ErrCorruptedFile を返します
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, aead.NonceSize()-streamNonceSuffixSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrTruncatedFile
+		}
+		return nil, err
+	}
+
+	return newStreamReader(r, aead, prefix, nil, StreamChunkSize), nil
+}
+
+func newStreamAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeyLength {
+		return nil, fmt.Errorf("鍵の長さが不正です: %dバイト（%dバイトが必要です）", len(key), KeyLength)
+	}
+	return newAEAD(CipherAES256GCM, key)
+}
+
+// チャンク番号と最終チャンクフラグからnonceを組み立てます
+func streamNonce(dst, prefix []byte, counter uint32, last bool) []byte {
+	dst = append(dst[:0], prefix...)
+	dst = binary.BigEndian.AppendUint32(dst, counter)
+	if last {
+		return append(dst, 1)
+	}
+	return append(dst, 0)
+}
+
+// streamWriter は平文をチャンクごとに暗号化して書き込みます
+type streamWriter struct {
+	dst       io.Writer
+	aead      cipher.AEAD
+	prefix    []byte
+	aad       []byte
+	chunkSize int
+
+	plain   *secret.Buffer // buf のメモリ（Close でゼロ埋めする）
+	buf     []byte         // 暗号化前の平文（最大 chunkSize）
+	out     []byte
+	nonce   []byte
+	counter uint32
+	closed  bool
+	err     error
+}
+
+func newStreamWriter(dst io.Writer, aead cipher.AEAD, prefix, aad []byte, chunkSize int) *streamWriter {
+	plain := secret.New(chunkSize)
+	return &streamWriter{
+		dst:       dst,
+		aead:      aead,
+		prefix:    prefix,
+		aad:       aad,
+		chunkSize: chunkSize,
+		plain:     plain,
+		buf:       plain.Bytes()[:0],
+	}
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errStreamClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n := 0
+	for len(p) > 0 {
+		// 続きのデータがあるので、いっぱいになったチャンクは最終チャンクではない
+		if len(w.buf) == w.chunkSize {
+			if err := w.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(w.buf[len(w.buf):w.chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Close は残りのデータを最終チャンクとして書き込みます
+// データが空の場合も、空の最終チャンクを書き込みます
+func (w *streamWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	defer func() {
+		w.plain.Destroy()
+		w.buf = nil
+	}()
+	if w.err != nil {
+		return w.err
+	}
+	return w.flush(true)
+}
+
+func (w *streamWriter) flush(last bool) error {
+	if !last && w.counter == math.MaxUint32 {
+		w.err = errors.New("データが大きすぎるため暗号化できません")
+		return w.err
+	}
+
+	w.nonce = streamNonce(w.nonce, w.prefix, w.counter, last)
+	w.out = w.aead.Seal(w.out[:0], w.nonce, w.buf, w.aad)
+	if _, err := w.dst.Write(w.out); err != nil {
+		w.err = err
+		return err
+	}
+
+	w.buf = w.buf[:0]
+	w.counter++
+	return nil
+}
+
+// streamReader はチャンクごとに認証・復号化しながら平文を読み出します
+type streamReader struct {
+	src    *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	aad    []byte
+
+	in      []byte         // 暗号化されたチャンク1つ分のバッファ
+	outBuf  *secret.Buffer // out のメモリ（読み終えたときにゼロ埋めする）
+	out     []byte         // 復号化したチャンクのバッファ
+	plain   []byte         // out のうちまだ読み出していない部分
+	nonce   []byte
+	counter uint32
+	done    bool
+	err     error
+}
+
+func newStreamReader(src io.Reader, aead cipher.AEAD, prefix, aad []byte, chunkSize int) *streamReader {
+	outBuf := secret.New(chunkSize)
+	return &streamReader{
+		src:    bufio.NewReader(src),
+		aead:   aead,
+		prefix: prefix,
+		aad:    aad,
+		in:     make([]byte, chunkSize+aead.Overhead()),
+		outBuf: outBuf,
+		out:    outBuf.Bytes()[:0],
+	}
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil || r.done {
+			// 読み終えた平文のバッファは不要になるので消去する
+			r.outBuf.Destroy()
+			r.out = nil
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.readChunk(); err != nil {
+			r.err = err
+		}
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *streamReader) readChunk() error {
+	n, err := io.ReadFull(r.src, r.in)
+	last := false
+	switch {
+	case errors.Is(err, io.EOF):
+		// 最終チャンクを読む前にデータが終わっている
+		return ErrTruncatedFile
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case err != nil:
+		return err
+	default:
+		// ちょうどチャンク1つ分で終わっている場合も最終チャンクになる
+		if _, err := r.src.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	chunk := r.in[:n]
+	if len(chunk) < r.aead.Overhead() {
+		return ErrTruncatedFile
+	}
+	if !last && r.counter == math.MaxUint32 {
+		return fmt.Errorf("%w: チャンクが多すぎます", ErrInvalidFile)
+	}
+
+	r.nonce = streamNonce(r.nonce, r.prefix, r.counter, last)
+	plain, err := r.aead.Open(r.out[:0], r.nonce, chunk, r.aad)
+	if err != nil {
+		if last {
+			// 最終チャンクでないチャンクとして開ける場合は、その後ろが切り詰められている
+			r.nonce = streamNonce(r.nonce, r.prefix, r.counter, false)
+			if _, err := r.aead.Open(nil, r.nonce, chunk, r.aad); err == nil {
+				return ErrTruncatedFile
+			}
+		}
+		if r.counter > 0 {
+			// 先頭のチャンクを開けているので、鍵は正しい
+			return ErrCorruptedFile
+		}
+		return ErrDecryptionFailed
+	}
+	if last && len(plain) == 0 && r.counter > 0 {
+		// 暗号化側は空の最終チャンクをデータが空の場合にしか書き込まない
+		return fmt.Errorf("%w: 空の最終チャンクがあります", ErrInvalidFile)
+	}
+
+	r.out = plain
+	r.plain = plain
+	r.counter++
+	r.done = last
+	return nil
+}
+
+// ENVAULT2形式のヘッダを書き込み、本文をチャンク形式で暗号化する WriteCloser を返します
+// ヘッダ全体を各チャンクの追加認証データとするため、ヘッダの改ざんはどのチャンクの復号化でも検出されます
+func newBodyWriter(dst io.Writer, dataKey []byte, h *Header) (io.WriteCloser, error) {
+	aead, err := newAEAD(h.Cipher, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, aead.NonceSize()-streamNonceSuffixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, fmt.Errorf("nonceの生成に失敗しました: %w", err)
+	}
+
+	header, err := marshalHeader(&Header{
+		Version:   FormatVersion,
+		Cipher:    h.Cipher,
+		Nonce:     prefix,
+		ChunkSize: StreamChunkSize,
+		Slots:     h.Slots,
+		Metadata:  h.Metadata,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+
+	return newStreamWriter(dst, aead, prefix, header, StreamChunkSize), nil
+}
+
+// チャンク形式の本文を復号化しながら読み出す Reader を返します
+func newBodyReader(src io.Reader, header *Header, key, aad []byte) (io.Reader, error) {
+	aead, err := newAEAD(header.Cipher, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(header.Nonce) != aead.NonceSize()-streamNonceSuffixSize {
+		return nil, fmt.Errorf("%w: nonceの長さが不正です", ErrInvalidFile)
+	}
+	if header.ChunkSize < 1 || header.ChunkSize > maxStreamChunkSize {
+		return nil, fmt.Errorf("%w: チャンク長が不正です (%d バイト)", ErrInvalidFile, header.ChunkSize)
+	}
+
+	return newStreamReader(src, aead, header.Nonce, aad, header.ChunkSize), nil
+}
+
+// ReadHead は src から暗号化ファイルの先頭を読み取ります
+// ENVAULT2形式の場合はヘッダ部分だけを読み取り、body は残りの暗号文を返します
+// それ以外の形式はヘッダだけを切り出せないため、データ全体を head として返します
+// head は ParseHeader や AcceptsPassword などに渡して、復号化に必要な鍵を判断するために使用できます
+func ReadHead(src io.Reader) (head []byte, body io.Reader, err error) {
+	prefix := make([]byte, len(MagicBytes)+headerLengthSize)
+	n, err := io.ReadFull(src, prefix)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, nil, err
+	}
+	prefix = prefix[:n]
+
+	if n < len(prefix) || !bytes.HasPrefix(prefix, []byte(MagicBytes)) {
+		rest, err := io.ReadAll(src)
+		if err != nil {
+			return nil, nil, err
+		}
+		return append(prefix, rest...), bytes.NewReader(nil), nil
+	}
+
+	headerLen := binary.BigEndian.Uint32(prefix[len(MagicBytes):])
+	if headerLen > maxHeaderLength {
+		return nil, nil, fmt.Errorf("%w: ヘッダ長が不正です (%d バイト)", ErrInvalidFile, headerLen)
+	}
+
+	head = make([]byte, len(prefix)+int(headerLen))
+	copy(head, prefix)
+	if _, err := io.ReadFull(src, head[len(prefix):]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, nil, ErrTruncatedFile
+		}
+		return nil, nil, err
+	}
+
+	return head, src, nil
+}
+
+// DecryptStream は src の暗号化データを DecryptWithIdentities と同様に復号化し、dst に書き込みます
+// チャンク形式のENVAULT2ファイルは、データ全体をメモリに読み込まずにチャンクごとに認証・復号化します
+// それ以外の形式（旧形式、age形式、構造化形式、ASCII armor形式）はデータ全体を読み込んでから復号化します
+// 途中のチャンクで認証に失敗した場合、それまでのチャンクの平文は既に dst に書き込まれています
+func DecryptStream(dst io.Writer, src io.Reader, identities []Identity) error {
+	head, body, err := ReadHead(src)
+	if err != nil {
+		return err
+	}
+
+	var header *Header
+	var aad []byte
+	if bytes.HasPrefix(head, []byte(MagicBytes)) {
+		header, aad, _, err = parseHeader(head)
+		if err != nil {
+			return err
+		}
+	}
+	if header == nil || header.ChunkSize == 0 || header.KDF != nil {
+		data, err := io.ReadAll(io.MultiReader(bytes.NewReader(head), body))
+		if err != nil {
+			return err
+		}
+		plaintext, err := DecryptWithIdentities(data, identities)
+		if err != nil {
+			return err
+		}
+		defer secret.Wipe(plaintext)
+		_, err = dst.Write(plaintext)
+		return err
+	}
+
+	dataKey, err := unwrapDataKey(header, identities)
+	if err != nil {
+		return err
+	}
+	defer secret.Wipe(dataKey)
+	r, err := newBodyReader(body, header, dataKey, aad)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, r)
+	return err
+}
@@ -0,0 +1,280 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+// テスト用に、チャンク境界の前後を含む長さのデータを作成する
+func streamTestData(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("テストデータの作成に失敗しました: %v", err)
+	}
+	return data
+}
+
+func encryptStreamForTest(t *testing.T, key, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, key)
+	if err != nil {
+		t.Fatalf("NewEncryptWriter() error = %v", err)
+	}
+	// 書き込みの単位がチャンク境界と一致しなくても正しく分割されること
+	for len(data) > 0 {
+		n := min(1000, len(data))
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		data = data[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decryptStreamForTest(key, encrypted []byte) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(encrypted), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestEncryptWriterRoundTrip(t *testing.T) {
+	key := streamTestData(t, KeyLength)
+	prefixSize := NonceSize - streamNonceSuffixSize
+
+	tests := []struct {
+		name   string
+		size   int
+		chunks int
+	}{
+		{"空のデータ", 0, 1},
+		{"1バイト", 1, 1},
+		{"チャンク長-1", StreamChunkSize - 1, 1},
+		{"チャンク長ちょうど", StreamChunkSize, 1},
+		{"チャンク長+1", StreamChunkSize + 1, 2},
+		{"複数チャンク", 3*StreamChunkSize + 5, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := streamTestData(t, tt.size)
+			encrypted := encryptStreamForTest(t, key, data)
+
+			if want := prefixSize + tt.size + tt.chunks*gcmTagSize; len(encrypted) != want {
+				t.Errorf("暗号文の長さ = %d, want %d", len(encrypted), want)
+			}
+
+			decrypted, err := decryptStreamForTest(key, encrypted)
+			if err != nil {
+				t.Fatalf("復号化に失敗しました: %v", err)
+			}
+			if !bytes.Equal(decrypted, data) {
+				t.Errorf("復号化したデータが元のデータと一致しません")
+			}
+		})
+	}
+}
+
+func TestDecryptReaderTampering(t *testing.T) {
+	key := streamTestData(t, KeyLength)
+	data := streamTestData(t, 3*StreamChunkSize+100)
+	encrypted := encryptStreamForTest(t, key, data)
+
+	prefixSize := NonceSize - streamNonceSuffixSize
+	chunk := StreamChunkSize + gcmTagSize
+	chunkAt := func(i int) []byte {
+		start := prefixSize + i*chunk
+		return encrypted[start:min(start+chunk, len(encrypted))]
+	}
+
+	swapped := append([]byte{}, encrypted[:prefixSize]...)
+	swapped = append(swapped, chunkAt(1)...)
+	swapped = append(swapped, chunkAt(0)...)
+	swapped = append(swapped, chunkAt(2)...)
+	swapped = append(swapped, chunkAt(3)...)
+
+	flipped := append([]byte{}, encrypted...)
+	flipped[prefixSize+chunk+10] ^= 1
+
+	tests := []struct {
+		name    string
+		data    []byte
+		key     []byte
+		wantErr error
+	}{
+		{"最終チャンクがない", encrypted[:prefixSize+3*chunk], key, ErrTruncatedFile},
+		{"チャンクの途中で切れている", encrypted[:prefixSize+chunk+10], key, ErrTruncatedFile},
+		{"nonceの接頭辞だけ", encrypted[:prefixSize], key, ErrTruncatedFile},
+		{"nonceの途中で切れている", encrypted[:3], key, ErrTruncatedFile},
+		{"チャンクの入れ替え", swapped, key, ErrDecryptionFailed},
+		{"チャンクの改ざん", flipped, key, ErrCorruptedFile},
+		{"末尾にデータを追加", append(append([]byte{}, encrypted...), chunkAt(0)...), key, ErrCorruptedFile},
+		{"鍵が違う", encrypted, streamTestData(t, KeyLength), ErrDecryptionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decryptStreamForTest(tt.key, tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("復号化 error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecryptReaderStopsAtFailedChunk(t *testing.T) {
+	key := streamTestData(t, KeyLength)
+	data := streamTestData(t, 2*StreamChunkSize+1)
+	encrypted := encryptStreamForTest(t, key, data)
+	encrypted[len(encrypted)-1] ^= 1
+
+	r, err := NewDecryptReader(bytes.NewReader(encrypted), key)
+	if err != nil {
+		t.Fatalf("NewDecryptReader() error = %v", err)
+	}
+	var got bytes.Buffer
+	if _, err := io.Copy(&got, r); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("復号化 error = %v, want %v", err, ErrCorruptedFile)
+	}
+	// 認証に失敗したチャンクの平文は読み出されないこと
+	if !bytes.Equal(got.Bytes(), data[:2*StreamChunkSize]) {
+		t.Errorf("読み出されたデータ = %dバイト, want 認証済みの %dバイト", got.Len(), 2*StreamChunkSize)
+	}
+}
+
+func TestNewEncryptWriterInvalidKey(t *testing.T) {
+	if _, err := NewEncryptWriter(io.Discard, make([]byte, 16)); err == nil {
+		t.Error("16バイトの鍵でエラーが返されませんでした")
+	}
+	if _, err := NewDecryptReader(bytes.NewReader(nil), make([]byte, 16)); err == nil {
+		t.Error("16バイトの鍵でエラーが返されませんでした")
+	}
+}
+
+func TestEncryptStream(t *testing.T) {
+	password := "test-password"
+	data := streamTestData(t, 2*StreamChunkSize+123)
+	identities := []Identity{NewPasswordIdentity(password)}
+
+	var buf bytes.Buffer
+	recipients := []Recipient{NewPasswordRecipient(password, DefaultOptions())}
+	if err := EncryptStream(&buf, bytes.NewReader(data), recipients, EncryptOptions{}); err != nil {
+		t.Fatalf("EncryptStream() error = %v", err)
+	}
+	encrypted := buf.Bytes()
+
+	header, err := ParseHeader(encrypted)
+	if err != nil {
+		t.Fatalf("ParseHeader() error = %v", err)
+	}
+	if header.ChunkSize != StreamChunkSize {
+		t.Errorf("ChunkSize = %d, want %d", header.ChunkSize, StreamChunkSize)
+	}
+
+	var decrypted bytes.Buffer
+	if err := DecryptStream(&decrypted, bytes.NewReader(encrypted), identities); err != nil {
+		t.Fatalf("DecryptStream() error = %v", err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), data) {
+		t.Error("DecryptStream() の結果が元のデータと一致しません")
+	}
+
+	plaintext, err := Decrypt(encrypted, password)
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if !bytes.Equal(plaintext, data) {
+		t.Error("Decrypt() の結果が元のデータと一致しません")
+	}
+
+	// ヘッダは各チャンクの追加認証データとして認証されること
+	_, _, body, err := parseHeader(encrypted)
+	if err != nil {
+		t.Fatalf("parseHeader() error = %v", err)
+	}
+	header.Metadata = &Metadata{Environment: "production"}
+	tampered, err := marshalHeader(header)
+	if err != nil {
+		t.Fatalf("marshalHeader() error = %v", err)
+	}
+	tampered = append(tampered, body...)
+	if err := DecryptStream(io.Discard, bytes.NewReader(tampered), identities); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("ヘッダを改ざんしたファイルで error = %v, want %v", err, ErrDecryptionFailed)
+	}
+
+	if err := DecryptStream(io.Discard, bytes.NewReader(encrypted[:len(encrypted)-StreamChunkSize]), identities); !errors.Is(err, ErrCorruptedFile) {
+		t.Errorf("チャンクの途中で切り詰めたファイルで error = %v, want %v", err, ErrCorruptedFile)
+	}
+}
+
+func TestDecryptSingleShotBody(t *testing.T) {
+	// チャンク形式を導入する前のENVAULT2ファイル（本文全体を1回で暗号化）も復号化できること
+	password := "test-password"
+	data := []byte("TEST_VAR1=value1\n")
+
+	dataKey := streamTestData(t, KeyLength)
+	slot, err := NewPasswordRecipient(password, DefaultOptions()).Wrap(dataKey)
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	nonce := streamTestData(t, NonceSize)
+	header, err := marshalHeader(&Header{Version: FormatVersion, Cipher: CipherAES256GCM, Nonce: nonce, Slots: []Slot{*slot}})
+	if err != nil {
+		t.Fatalf("marshalHeader() error = %v", err)
+	}
+	aead, err := newAEAD(CipherAES256GCM, dataKey)
+	if err != nil {
+		t.Fatalf("newAEAD() error = %v", err)
+	}
+	encrypted := aead.Seal(header, nonce, data, header)
+
+	var decrypted bytes.Buffer
+	if err := DecryptStream(&decrypted, bytes.NewReader(encrypted), []Identity{NewPasswordIdentity(password)}); err != nil {
+		t.Fatalf("DecryptStream() error = %v", err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), data) {
+		t.Errorf("DecryptStream() = %q, want %q", decrypted.Bytes(), data)
+	}
+	if _, err := Decrypt(encrypted[:len(header)+gcmTagSize-1], password); !errors.Is(err, ErrTruncatedFile) {
+		t.Errorf("切り詰めたファイルで error = %v, want %v", err, ErrTruncatedFile)
+	}
+}
+
+func TestReadHead(t *testing.T) {
+	encrypted, err := Encrypt([]byte("TEST_VAR1=value1"), "test-password")
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	head, body, err := ReadHead(bytes.NewReader(encrypted))
+	if err != nil {
+		t.Fatalf("ReadHead() error = %v", err)
+	}
+	if _, err := ParseHeader(head); err != nil {
+		t.Errorf("ヘッダ部分を読み取れません: %v", err)
+	}
+	rest, _ := io.ReadAll(body)
+	if !bytes.Equal(append(head, rest...), encrypted) {
+		t.Error("ヘッダと残りのデータを連結しても元のデータになりません")
+	}
+
+	// ENVAULT2以外の形式は全体を返す
+	age, err := EncryptAge([]byte("TEST_VAR1=value1"), []Recipient{NewPasswordRecipient("test-password", DefaultOptions())})
+	if err != nil {
+		t.Fatalf("EncryptAge() error = %v", err)
+	}
+	head, _, err = ReadHead(bytes.NewReader(age))
+	if err != nil || !bytes.Equal(head, age) {
+		t.Errorf("ReadHead(age) = %d バイト, %v", len(head), err)
+	}
+
+	if _, _, err := ReadHead(bytes.NewReader(encrypted[:len(MagicBytes)+headerLengthSize+5])); !errors.Is(err, ErrTruncatedFile) {
+		t.Errorf("ヘッダの途中で切れたファイルで error = %v, want %v", err, ErrTruncatedFile)
+	}
+}
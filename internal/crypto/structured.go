@@ -0,0 +1,344 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/uzulla/envault/pkg/secret"
+	"golang.org/x/crypto/hkdf"
+)
+
+// 値ごとに暗号化する構造化形式
+//
+//	#envault-structured-v1
+//	#header:<base64(JSONヘッダ)>
+//	DATABASE_URL=<base64(nonce + 暗号文)>
+//	API_KEY=<base64(nonce + 暗号文)>
+//	#mac:<base64(HMAC-SHA256)>
+//
+// キー名は平文のまま（またはHMACで置き換えて）残るため、gitの差分でどの変数が変わったかを確認できます。
+// 値のnonceはデータ鍵から導出した鍵による (キー名, 値) のHMACから決めるため、
+// 同じデータ鍵で暗号化し直した場合、変更していない値の行はそのまま残ります。
+// ファイル全体（ヘッダ・行の順序を含む）はMACで認証されます。
+
+const (
+	// StructuredMagic は構造化形式のファイルの1行目です
+	StructuredMagic = "#envault-structured-v1\n"
+
+	structuredHeaderPrefix = "#header:"
+	structuredMACPrefix    = "#mac:"
+
+	structuredValueInfo = "envault/structured/value"
+	structuredNonceInfo = "envault/structured/nonce"
+	structuredNameInfo  = "envault/structured/name"
+	structuredMACInfo   = "envault/structured/mac"
+
+	// HMACで置き換えたキー名の長さ（バイト数）
+	hashedKeyLength = 16
+)
+
+var (
+	ErrMACMismatch = errors.New("ファイルの認証に失敗しました（改ざんされているか、鍵が正しくありません）")
+)
+
+// StructuredEntry は構造化形式で暗号化する1つの変数です
+// Value は .env ファイルの「=」の右側の表記（引用符を含む）をそのまま保持します
+type StructuredEntry struct {
+	Key   string
+	Value string
+}
+
+// StructuredOptions は構造化形式の暗号化オプションです
+type StructuredOptions struct {
+	// HashKeys を指定すると、キー名もHMACで置き換えて隠します
+	HashKeys bool
+	// Metadata はヘッダに平文で記録するメタデータです（MACで認証されます）
+	Metadata *Metadata
+	// Cipher は値の暗号方式です（空の場合は AES-256-GCM）
+	Cipher string
+}
+
+// 構造化形式で使用する、データ鍵から導出した鍵
+type structuredKeys struct {
+	value []byte
+	nonce []byte
+	name  []byte
+	mac   []byte
+}
+
+// EncryptStructured は変数ごとに値を暗号化した構造化形式のファイルを作成します
+func EncryptStructured(entries []StructuredEntry, recipients []Recipient, opts StructuredOptions) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+	suite, err := CipherSuiteByName(opts.Cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, KeyLength)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("データ鍵の生成に失敗しました: %w", err)
+	}
+	defer secret.Wipe(dataKey)
+
+	slots := make([]Slot, 0, len(recipients))
+	for _, r := range recipients {
+		slot, err := r.Wrap(dataKey)
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, *slot)
+	}
+
+	header := &Header{Version: FormatVersion, Cipher: suite.Name(), Slots: slots, HashedKeys: opts.HashKeys, Metadata: opts.Metadata}
+	return sealStructured(header, dataKey, entries)
+}
+
+// UpdateStructured は既存の構造化形式のファイルと同じデータ鍵・スロットで変数を暗号化し直します
+// 変更していない値の行は同じ内容になるため、差分には変更した変数だけが現れます
+// ヘッダのメタデータは metadata に置き換えられます
+func UpdateStructured(encryptedData []byte, identities []Identity, entries []StructuredEntry, metadata *Metadata) ([]byte, error) {
+	encryptedData, err := decodeVault(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+
+	header, _, dataKey, err := openStructured(encryptedData, identities)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.Wipe(dataKey)
+	header.Metadata = metadata
+	return sealStructured(header, dataKey, entries)
+}
+
+// 構造化形式のファイルを復号化し、.env形式のテキストを返します
+func decryptStructured(encryptedData []byte, identities []Identity) ([]byte, error) {
+	_, entries, _, err := openStructured(encryptedData, identities)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		buf.WriteString(e.Key)
+		buf.WriteByte('=')
+		buf.WriteString(e.Value)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func sealStructured(header *Header, dataKey []byte, entries []StructuredEntry) ([]byte, error) {
+	keys, err := deriveStructuredKeys(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("ヘッダのエンコードに失敗しました: %w", err)
+	}
+
+	aead, err := newAEAD(header.Cipher, keys.value)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(StructuredMagic)
+	buf.WriteString(structuredHeaderPrefix + base64.StdEncoding.EncodeToString(headerJSON) + "\n")
+
+	for _, e := range entries {
+		if e.Key == "" || strings.ContainsAny(e.Key, "=\n") || strings.HasPrefix(e.Key, "#") {
+			return nil, fmt.Errorf("無効なキー名です: %q", e.Key)
+		}
+
+		name, plaintext := e.Key, []byte(e.Value)
+		if header.HashedKeys {
+			name = hashKeyName(keys.name, e.Key)
+			plaintext = append([]byte(e.Key+"\x00"), plaintext...)
+		}
+
+		nonce := structuredNonce(keys.nonce, name, plaintext, aead.NonceSize())
+		ciphertext := aead.Seal(nonce, nonce, plaintext, []byte(name))
+		buf.WriteString(name + "=" + base64.StdEncoding.EncodeToString(ciphertext) + "\n")
+	}
+
+	mac := hmac.New(sha256.New, keys.mac)
+	mac.Write(buf.Bytes())
+	buf.WriteString(structuredMACPrefix + base64.StdEncoding.EncodeToString(mac.Sum(nil)) + "\n")
+
+	return buf.Bytes(), nil
+}
+
+// 構造化形式のファイルを開き、ヘッダ・変数・データ鍵を返します
+func openStructured(encryptedData []byte, identities []Identity) (*Header, []StructuredEntry, []byte, error) {
+	header, err := parseStructuredHeader(encryptedData)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	dataKey, err := unwrapDataKey(header, identities)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	keys, err := deriveStructuredKeys(dataKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// MAC行を切り離し、それより前の内容全体を検証する
+	signed, expected, err := splitStructuredMAC(encryptedData)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	mac := hmac.New(sha256.New, keys.mac)
+	mac.Write(signed)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return nil, nil, nil, ErrMACMismatch
+	}
+
+	aead, err := newAEAD(header.Cipher, keys.value)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	nonceSize := aead.NonceSize()
+
+	var entries []StructuredEntry
+	scanner := bufio.NewScanner(bytes.NewReader(signed))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxHeaderLength)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, encoded, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("%w: 不正な行です", ErrInvalidFile)
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(ciphertext) < nonceSize {
+			return nil, nil, nil, fmt.Errorf("%w: %s の値を読み取れません", ErrInvalidFile, name)
+		}
+		plaintext, err := aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], []byte(name))
+		if err != nil {
+			return nil, nil, nil, ErrDecryptionFailed
+		}
+
+		entry := StructuredEntry{Key: name, Value: string(plaintext)}
+		if header.HashedKeys {
+			key, value, ok := strings.Cut(string(plaintext), "\x00")
+			if !ok || hashKeyName(keys.name, key) != name {
+				return nil, nil, nil, ErrDecryptionFailed
+			}
+			entry = StructuredEntry{Key: key, Value: value}
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+
+	return header, entries, dataKey, nil
+}
+
+// 構造化形式のファイルを、MACの対象となる部分と最後の行のMACに分けます
+func splitStructuredMAC(data []byte) (signed, mac []byte, err error) {
+	body := bytes.TrimSuffix(data, []byte("\n"))
+	macStart := bytes.LastIndex(body, []byte("\n"+structuredMACPrefix))
+	if macStart < 0 {
+		// 最後の行（MAC）が欠けている
+		return nil, nil, fmt.Errorf("%w: MACがありません", ErrTruncatedFile)
+	}
+
+	mac, err = base64.StdEncoding.DecodeString(string(body[macStart+1+len(structuredMACPrefix):]))
+	if err != nil || len(mac) != sha256.Size {
+		return nil, nil, fmt.Errorf("%w: MACを読み取れません", ErrTruncatedFile)
+	}
+	return body[:macStart+1], mac, nil
+}
+
+// 構造化形式のファイルからヘッダを読み取ります（復号化は行いません）
+func parseStructuredHeader(data []byte) (*Header, error) {
+	if !bytes.HasPrefix(data, []byte(StructuredMagic)) {
+		return nil, ErrInvalidFile
+	}
+
+	rest := data[len(StructuredMagic):]
+	line, _, _ := bytes.Cut(rest, []byte("\n"))
+	if !bytes.HasPrefix(line, []byte(structuredHeaderPrefix)) {
+		return nil, fmt.Errorf("%w: ヘッダがありません", ErrInvalidFile)
+	}
+
+	headerJSON, err := base64.StdEncoding.DecodeString(string(line[len(structuredHeaderPrefix):]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: ヘッダを読み取れません", ErrInvalidFile)
+	}
+
+	header := &Header{}
+	if err := json.Unmarshal(headerJSON, header); err != nil {
+		return nil, fmt.Errorf("%w: ヘッダを読み取れません", ErrInvalidFile)
+	}
+	if header.Version != FormatVersion {
+		return nil, fmt.Errorf("%w (%d)", ErrUnknownVersion, header.Version)
+	}
+	if header.KDF != nil {
+		return nil, ErrUnsupported
+	}
+	if _, err := CipherSuiteByName(header.Cipher); err != nil || header.Cipher == "" {
+		return nil, fmt.Errorf("%w: 暗号方式 %q", ErrUnsupported, header.Cipher)
+	}
+	return header, nil
+}
+
+func deriveStructuredKeys(dataKey []byte) (*structuredKeys, error) {
+	keys := &structuredKeys{}
+	for _, k := range []struct {
+		dst  *[]byte
+		info string
+	}{
+		{&keys.value, structuredValueInfo},
+		{&keys.nonce, structuredNonceInfo},
+		{&keys.name, structuredNameInfo},
+		{&keys.mac, structuredMACInfo},
+	} {
+		*k.dst = make([]byte, KeyLength)
+		if _, err := io.ReadFull(hkdf.New(sha256.New, dataKey, nil, []byte(k.info)), *k.dst); err != nil {
+			return nil, fmt.Errorf("鍵の導出に失敗しました: %w", err)
+		}
+	}
+	return keys, nil
+}
+
+// (キー名, 平文) から決定的にnonceを導出します
+// 同じ (キー名, 平文) の組でのみ同じnonceになるため、nonceの再利用による問題は起きません
+func structuredNonce(key []byte, name string, plaintext []byte, size int) []byte {
+	mac := hmac.New(sha256.New, key)
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(name)))
+	mac.Write(length[:])
+	mac.Write([]byte(name))
+	mac.Write(plaintext)
+	return mac.Sum(nil)[:size]
+}
+
+// キー名をHMACで置き換えた識別子を返します
+func hashKeyName(key []byte, name string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	return "_" + hex.EncodeToString(mac.Sum(nil)[:hashedKeyLength])
+}
@@ -0,0 +1,119 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testStructuredEntries() []StructuredEntry {
+	return []StructuredEntry{
+		{Key: "DATABASE_URL", Value: "postgres://localhost/db"},
+		{Key: "API_KEY", Value: `"secret value"`},
+		{Key: "EMPTY", Value: ""},
+	}
+}
+
+func TestStructuredRoundTrip(t *testing.T) {
+	for _, hashKeys := range []bool{false, true} {
+		recipients := []Recipient{NewPasswordRecipient("test-password", DefaultOptions())}
+		encrypted, err := EncryptStructured(testStructuredEntries(), recipients, StructuredOptions{HashKeys: hashKeys})
+		if err != nil {
+			t.Fatalf("EncryptStructured(HashKeys=%v) error = %v", hashKeys, err)
+		}
+		if DetectFormat(encrypted) != FormatStructured {
+			t.Errorf("DetectFormat() = %v, want %v", DetectFormat(encrypted), FormatStructured)
+		}
+
+		// キー名はHashKeysを指定しない場合のみ平文で見えること、値は常に見えないこと
+		if got := bytes.Contains(encrypted, []byte("\nDATABASE_URL=")); got == hashKeys {
+			t.Errorf("HashKeys=%v でキー名が平文で含まれる = %v", hashKeys, got)
+		}
+		if bytes.Contains(encrypted, []byte("postgres://")) {
+			t.Errorf("値が平文で含まれています")
+		}
+
+		decrypted, err := Decrypt(encrypted, "test-password")
+		if err != nil {
+			t.Fatalf("Decrypt(HashKeys=%v) error = %v", hashKeys, err)
+		}
+		want := "DATABASE_URL=postgres://localhost/db\nAPI_KEY=\"secret value\"\nEMPTY=\n"
+		if string(decrypted) != want {
+			t.Errorf("Decrypt(HashKeys=%v) = %q, want %q", hashKeys, decrypted, want)
+		}
+
+		if _, err := Decrypt(encrypted, "wrong-password"); err == nil {
+			t.Errorf("誤ったパスワードで復号化できてしまいました")
+		}
+	}
+}
+
+func TestStructuredTamperDetection(t *testing.T) {
+	recipients := []Recipient{NewPasswordRecipient("test-password", DefaultOptions())}
+	encrypted, err := EncryptStructured(testStructuredEntries(), recipients, StructuredOptions{})
+	if err != nil {
+		t.Fatalf("EncryptStructured() error = %v", err)
+	}
+	lines := strings.SplitAfter(string(encrypted), "\n")
+
+	// 値の行を入れ替える
+	swapped := append([]string{}, lines...)
+	swapped[2], swapped[3] = swapped[3], swapped[2]
+
+	// 値の行を削除する
+	removed := append(append([]string{}, lines[:3]...), lines[4:]...)
+
+	// キー名を書き換える
+	renamed := append([]string{}, lines...)
+	renamed[2] = strings.Replace(renamed[2], "DATABASE_URL=", "DATABASE_UR1=", 1)
+
+	for name, tampered := range map[string][]string{"swapped": swapped, "removed": removed, "renamed": renamed} {
+		_, err := Decrypt([]byte(strings.Join(tampered, "")), "test-password")
+		if !errors.Is(err, ErrMACMismatch) {
+			t.Errorf("%s: Decrypt() error = %v, want %v", name, err, ErrMACMismatch)
+		}
+	}
+}
+
+func TestUpdateStructuredKeepsUnchangedLines(t *testing.T) {
+	recipients := []Recipient{NewPasswordRecipient("test-password", DefaultOptions())}
+	identities := []Identity{NewPasswordIdentity("test-password")}
+	entries := testStructuredEntries()
+
+	encrypted, err := EncryptStructured(entries, recipients, StructuredOptions{})
+	if err != nil {
+		t.Fatalf("EncryptStructured() error = %v", err)
+	}
+
+	entries[1].Value = "changed"
+	updated, err := UpdateStructured(encrypted, identities, entries, nil)
+	if err != nil {
+		t.Fatalf("UpdateStructured() error = %v", err)
+	}
+
+	before := strings.Split(string(encrypted), "\n")
+	after := strings.Split(string(updated), "\n")
+	if len(before) != len(after) {
+		t.Fatalf("行数が変わりました: %d -> %d", len(before), len(after))
+	}
+	var changed []string
+	for i := range before {
+		if before[i] != after[i] {
+			name, _, _ := strings.Cut(after[i], "=")
+			name, _, _ = strings.Cut(name, ":")
+			changed = append(changed, name)
+		}
+	}
+	if strings.Join(changed, ",") != "API_KEY,#mac" {
+		t.Errorf("変更された行 = %v, want [API_KEY #mac]", changed)
+	}
+
+	decrypted, err := Decrypt(updated, "test-password")
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if !strings.Contains(string(decrypted), "API_KEY=changed\n") {
+		t.Errorf("更新した値が復号化されません: %q", decrypted)
+	}
+}
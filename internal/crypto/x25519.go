@@ -0,0 +1,277 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	SlotTypeX25519 = "x25519"
+
+	// 公開鍵・秘密鍵の文字列表現の接頭辞
+	X25519PublicKeyPrefix = "envault-pub-"
+	X25519SecretKeyPrefix = "ENVAULT-SECRET-KEY-"
+
+	x25519WrapInfo = "envault/x25519"
+)
+
+// X25519Recipient はX25519公開鍵の受信者です
+type X25519Recipient struct {
+	publicKey *ecdh.PublicKey
+}
+
+// X25519Identity はX25519秘密鍵です
+type X25519Identity struct {
+	privateKey *ecdh.PrivateKey
+}
+
+// GenerateX25519Identity は新しいX25519秘密鍵を生成します
+func GenerateX25519Identity() (*X25519Identity, error) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("鍵の生成に失敗しました: %w", err)
+	}
+	return &X25519Identity{privateKey: privateKey}, nil
+}
+
+// ParseX25519Recipient は「envault-pub-」で始まる公開鍵文字列を読み取ります
+// ageの公開鍵（age1...）も受け付けます
+func ParseX25519Recipient(s string) (*X25519Recipient, error) {
+	raw, err := decodeX25519KeyString(s, X25519PublicKeyPrefix, ageRecipientHRP)
+	if err != nil {
+		return nil, fmt.Errorf("無効な公開鍵です: %w", err)
+	}
+	publicKey, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("無効な公開鍵です: %w", err)
+	}
+	return &X25519Recipient{publicKey: publicKey}, nil
+}
+
+// ParseX25519Identity は「ENVAULT-SECRET-KEY-」で始まる秘密鍵文字列を読み取ります
+// ageの秘密鍵（AGE-SECRET-KEY-1...）も受け付けます
+func ParseX25519Identity(s string) (*X25519Identity, error) {
+	raw, err := decodeX25519KeyString(s, X25519SecretKeyPrefix, ageSecretKeyHRP)
+	if err != nil {
+		return nil, fmt.Errorf("無効な秘密鍵です: %w", err)
+	}
+	privateKey, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("無効な秘密鍵です: %w", err)
+	}
+	return &X25519Identity{privateKey: privateKey}, nil
+}
+
+// ParseIdentities は秘密鍵ファイルの内容を読み取ります
+// 空行と「#」で始まる行は無視され、それ以外の各行が1つの秘密鍵として扱われます
+func ParseIdentities(data []byte) ([]Identity, error) {
+	var identities []Identity
+	err := scanKeyLines(data, func(line string) error {
+		id, err := ParseX25519Identity(line)
+		if err != nil {
+			return err
+		}
+		identities = append(identities, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("秘密鍵が含まれていません")
+	}
+	return identities, nil
+}
+
+// RecipientEntry は受信者ファイルの1行（公開鍵とラベル）です
+type RecipientEntry struct {
+	PublicKey string
+	Label     string
+}
+
+// ParseRecipientEntries は受信者ファイルの内容を読み取ります
+// 空行と「#」で始まる行は無視され、それ以外の各行は「公開鍵 [ラベル]」として扱われます
+// ageの公開鍵（age1...）で書かれた行も、PublicKey は envault-pub-... の形式で返します
+func ParseRecipientEntries(data []byte) ([]RecipientEntry, error) {
+	var entries []RecipientEntry
+	err := scanKeyLines(data, func(line string) error {
+		fields := strings.Fields(line)
+		r, err := ParseX25519Recipient(fields[0])
+		if err != nil {
+			return err
+		}
+		entries = append(entries, RecipientEntry{
+			PublicKey: r.String(),
+			Label:     strings.Join(fields[1:], " "),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ParseRecipients は受信者ファイルの内容を読み取り、受信者のリストを返します
+func ParseRecipients(data []byte) ([]Recipient, error) {
+	entries, err := ParseRecipientEntries(data)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := make([]Recipient, 0, len(entries))
+	for _, e := range entries {
+		r, err := ParseX25519Recipient(e.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// CanonicalRecipient は公開鍵を暗号化ファイルのスロットに記録される形式（envault-pub-...）にします
+// ageの公開鍵（age1...）も同じ鍵の envault-pub-... に変換します
+// 公開鍵として読み取れない文字列（フィンガープリントなど）は前後の空白を除いてそのまま返します
+func CanonicalRecipient(key string) string {
+	key = strings.TrimSpace(key)
+	if r, err := ParseX25519Recipient(key); err == nil {
+		return r.String()
+	}
+	return key
+}
+
+// Fingerprint は公開鍵文字列のSHA-256ハッシュの先頭8バイトを16進数で返します
+func Fingerprint(publicKey string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(publicKey)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// String は公開鍵の文字列表現を返します
+func (r *X25519Recipient) String() string {
+	return X25519PublicKeyPrefix + base64.RawURLEncoding.EncodeToString(r.publicKey.Bytes())
+}
+
+// Wrap はエフェメラル鍵との共有秘密からラップ鍵を導出し、データ鍵を包みます
+func (r *X25519Recipient) Wrap(dataKey []byte) (*Slot, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("エフェメラル鍵の生成に失敗しました: %w", err)
+	}
+
+	shared, err := ephemeral.ECDH(r.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("鍵交換に失敗しました: %w", err)
+	}
+
+	ephemeralPublic := ephemeral.PublicKey().Bytes()
+	wrapKey, err := x25519WrapKey(shared, ephemeralPublic, r.publicKey.Bytes(), x25519WrapInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := sealKey(wrapKey, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Slot{
+		Type:       SlotTypeX25519,
+		Recipient:  r.String(),
+		Ephemeral:  ephemeralPublic,
+		WrappedKey: wrappedKey,
+	}, nil
+}
+
+// Recipient は秘密鍵に対応する公開鍵を返します
+func (i *X25519Identity) Recipient() *X25519Recipient {
+	return &X25519Recipient{publicKey: i.privateKey.PublicKey()}
+}
+
+// String は秘密鍵の文字列表現を返します
+func (i *X25519Identity) String() string {
+	return X25519SecretKeyPrefix + base64.RawURLEncoding.EncodeToString(i.privateKey.Bytes())
+}
+
+// Unwrap は自分宛てのX25519スロットからデータ鍵を取り出します
+func (i *X25519Identity) Unwrap(slot *Slot) ([]byte, error) {
+	if slot.Type != SlotTypeX25519 || slot.Recipient != i.Recipient().String() {
+		return nil, errSlotMismatch
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(slot.Ephemeral)
+	if err != nil {
+		return nil, ErrInvalidFile
+	}
+
+	shared, err := i.privateKey.ECDH(ephemeral)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	wrapKey, err := x25519WrapKey(shared, slot.Ephemeral, i.privateKey.PublicKey().Bytes(), x25519WrapInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return openKey(wrapKey, slot.WrappedKey)
+}
+
+// 共有秘密とエフェメラル公開鍵・受信者公開鍵からラップ鍵を導出します
+// info はスロットの種類ごとに異なる値を使用し、別の種類のスロットとして開けないようにします
+func x25519WrapKey(shared, ephemeralPublic, recipientPublic []byte, info string) ([]byte, error) {
+	salt := make([]byte, 0, len(ephemeralPublic)+len(recipientPublic))
+	salt = append(salt, ephemeralPublic...)
+	salt = append(salt, recipientPublic...)
+
+	wrapKey := make([]byte, KeyLength)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(info)), wrapKey); err != nil {
+		return nil, fmt.Errorf("ラップ鍵の導出に失敗しました: %w", err)
+	}
+	return wrapKey, nil
+}
+
+// 接頭辞付きのbase64文字列から鍵のバイト列を取り出します
+func decodeKeyString(s, prefix string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, prefix) {
+		return nil, fmt.Errorf("%q で始まっていません", prefix)
+	}
+	return base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, prefix))
+}
+
+// envault形式またはage形式の鍵文字列から鍵のバイト列を取り出します
+func decodeX25519KeyString(s, prefix, ageHRP string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(strings.ToLower(s), strings.ToLower(ageHRP)+"1") {
+		return decodeAgeKeyString(s, ageHRP)
+	}
+	return decodeKeyString(s, prefix)
+}
+
+// 鍵ファイルの各行（空行とコメントを除く）に対して関数を呼び出します
+func scanKeyLines(data []byte, fn func(line string) error) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return fmt.Errorf("%d行目: %w", lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
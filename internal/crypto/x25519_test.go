@@ -0,0 +1,109 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func generateIdentityForTest(t *testing.T) *X25519Identity {
+	t.Helper()
+
+	id, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("鍵の生成に失敗しました: %v", err)
+	}
+	return id
+}
+
+func TestEncryptToRecipients(t *testing.T) {
+	testData := []byte("TEST_VAR1=value1\nTEST_VAR2=value2")
+	alice := generateIdentityForTest(t)
+	bob := generateIdentityForTest(t)
+	mallory := generateIdentityForTest(t)
+
+	encrypted, err := EncryptToRecipients(testData, []Recipient{alice.Recipient(), bob.Recipient()})
+	if err != nil {
+		t.Fatalf("暗号化に失敗しました: %v", err)
+	}
+
+	for _, id := range []*X25519Identity{alice, bob} {
+		decrypted, err := DecryptWithIdentities(encrypted, []Identity{id})
+		if err != nil {
+			t.Fatalf("復号化に失敗しました: %v", err)
+		}
+		if !bytes.Equal(testData, decrypted) {
+			t.Errorf("復号化されたデータが元のデータと一致しません")
+		}
+	}
+
+	if _, err := DecryptWithIdentities(encrypted, []Identity{mallory}); err != ErrNoIdentityMatched {
+		t.Errorf("受信者以外の鍵で期待されるエラーが返されませんでした。期待: %v, 実際: %v", ErrNoIdentityMatched, err)
+	}
+
+	if _, err := Decrypt(encrypted, "password"); err != ErrNoIdentityMatched {
+		t.Errorf("パスワードでの復号化で期待されるエラーが返されませんでした。期待: %v, 実際: %v", ErrNoIdentityMatched, err)
+	}
+}
+
+func TestEncryptToRecipientsWithoutRecipients(t *testing.T) {
+	if _, err := EncryptToRecipients([]byte("TEST_VAR1=value1"), nil); err != ErrNoRecipients {
+		t.Errorf("期待されるエラーが返されませんでした。期待: %v, 実際: %v", ErrNoRecipients, err)
+	}
+}
+
+func TestX25519KeyEncoding(t *testing.T) {
+	id := generateIdentityForTest(t)
+
+	parsedID, err := ParseX25519Identity(id.String())
+	if err != nil {
+		t.Fatalf("秘密鍵の読み取りに失敗しました: %v", err)
+	}
+	if parsedID.String() != id.String() {
+		t.Errorf("秘密鍵が一致しません")
+	}
+
+	recipient, err := ParseX25519Recipient(id.Recipient().String())
+	if err != nil {
+		t.Fatalf("公開鍵の読み取りに失敗しました: %v", err)
+	}
+	if recipient.String() != id.Recipient().String() {
+		t.Errorf("公開鍵が一致しません")
+	}
+
+	if _, err := ParseX25519Recipient(id.String()); err == nil {
+		t.Errorf("秘密鍵を公開鍵として読み取れてしまいました")
+	}
+}
+
+func TestParseIdentitiesAndRecipients(t *testing.T) {
+	alice := generateIdentityForTest(t)
+	bob := generateIdentityForTest(t)
+
+	identityFile := "# created: test\n# public key: " + alice.Recipient().String() + "\n" + alice.String() + "\n"
+	identities, err := ParseIdentities([]byte(identityFile))
+	if err != nil {
+		t.Fatalf("秘密鍵ファイルの読み取りに失敗しました: %v", err)
+	}
+	if len(identities) != 1 {
+		t.Errorf("秘密鍵の数が期待と異なります: %d", len(identities))
+	}
+
+	recipientsFile := strings.Join([]string{
+		"# team",
+		alice.Recipient().String(),
+		"",
+		bob.Recipient().String(),
+	}, "\n")
+	recipients, err := ParseRecipients([]byte(recipientsFile))
+	if err != nil {
+		t.Fatalf("受信者ファイルの読み取りに失敗しました: %v", err)
+	}
+	if len(recipients) != 2 {
+		t.Errorf("受信者の数が期待と異なります: %d", len(recipients))
+	}
+
+	if _, err := ParseRecipients([]byte("not-a-key\n")); err == nil {
+		t.Errorf("無効な受信者ファイルの読み取りが成功しました")
+	}
+}
@@ -0,0 +1,63 @@
+package env
+
+import "fmt"
+
+// Severity は書式の問題の重大度です
+type Severity int
+
+const (
+	// SeverityWarning は意図どおりに読み取れている可能性が高い問題です（重複したキーなど）
+	SeverityWarning Severity = iota
+	// SeverityError は内容の一部が無視されたり、意図と異なる値として読み取られる問題です
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "エラー"
+	}
+	return "警告"
+}
+
+// Diagnostic は.envファイルの書式の問題です
+// 秘密の値を出力しないよう、メッセージには値を含めません
+type Diagnostic struct {
+	Line     int // 行番号（1から）
+	Column   int // 列番号（1から、文字単位）
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+// Diagnostics は書式の問題の一覧です
+type Diagnostics []Diagnostic
+
+// HasErrors はエラーの問題が含まれているかを返します
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidKey はキーがシェルの変数名として使える名前（英字か _ で始まり、英数字と _ のみ）かを返します
+func IsValidKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c == '_', 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,225 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrKeyNotFound = errors.New("キーが見つかりません")
+	ErrKeyExists   = errors.New("キーは既に存在します")
+	ErrInvalidKey  = errors.New("無効なキー名です（英字か _ で始まり、英数字と _ のみ使用できます）")
+)
+
+// Document は.envファイルの内容を、空行・コメント・引用符の種類・並び順を含めて保持します
+// キーの取得・設定・削除・名前の変更は該当する行の該当する部分だけを書き換えるため、
+// 変更しなければ Bytes は元の内容とバイト単位で同じ内容を返します
+type Document struct {
+	data     []byte
+	segments []segment
+	diags    Diagnostics
+}
+
+// ParseDocument は.envファイルの内容から Document を作成します
+// 書式の問題がある行も、書かれたとおりに保持します
+func ParseDocument(data []byte) *Document {
+	d := &Document{}
+	d.reset(append([]byte(nil), data...))
+	return d
+}
+
+// 内容を置き換えて解析し直す
+func (d *Document) reset(data []byte) {
+	d.data = data
+	d.segments, d.diags = parseSegments(data)
+}
+
+// Bytes は現在の内容を返します
+func (d *Document) Bytes() []byte {
+	return append([]byte(nil), d.data...)
+}
+
+func (d *Document) String() string {
+	return string(d.data)
+}
+
+// Entries は変数を出現順に返します（Parse と同じ結果です）
+func (d *Document) Entries() []Entry {
+	var entries []Entry
+	for _, seg := range d.segments {
+		if seg.entry != nil {
+			entries = append(entries, *seg.entry)
+		}
+	}
+	return entries
+}
+
+// Diagnostics は書式の問題を返します
+func (d *Document) Diagnostics() Diagnostics {
+	return d.diags
+}
+
+// Keys はキーを最初に出現した順に返します（重複したキーは1回のみ）
+func (d *Document) Keys() []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, seg := range d.segments {
+		if seg.entry != nil && !seen[seg.entry.Key] {
+			seen[seg.entry.Key] = true
+			keys = append(keys, seg.entry.Key)
+		}
+	}
+	return keys
+}
+
+// Get はキーの値を返します（同じキーが複数ある場合は最後の値）
+func (d *Document) Get(key string) (string, bool) {
+	if i := d.lastIndex(key); i >= 0 {
+		return d.segments[i].entry.Value, true
+	}
+	return "", false
+}
+
+// Set はキーの値を設定します
+// キーがある場合は最後の出現の値の表記だけを置き換え、export やコメント、インデントはそのまま残します
+// 引用符はできるだけ元の種類を使用します。キーがない場合は末尾に「KEY=value」の行を追加します
+func (d *Document) Set(key, value string) error {
+	if !IsValidKey(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	i := d.lastIndex(key)
+	if i < 0 {
+		data := d.data
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		data = append(data, key+"="+QuoteValue(value, Unquoted)+"\n"...)
+		d.reset(data)
+		return nil
+	}
+
+	seg := d.segments[i]
+	d.splice(seg.valueStart, seg.valueEnd, QuoteValue(value, seg.entry.Quote))
+	return nil
+}
+
+// Delete はキーの行をすべて削除します（直前のコメント行は残します）
+// キーがなかった場合は false を返します
+func (d *Document) Delete(key string) bool {
+	var data []byte
+	deleted := false
+	prev := 0
+	for _, seg := range d.segments {
+		if seg.entry != nil && seg.entry.Key == key {
+			data = append(data, d.data[prev:seg.start]...)
+			prev = seg.end
+			deleted = true
+		}
+	}
+	if !deleted {
+		return false
+	}
+
+	d.reset(append(data, d.data[prev:]...))
+	return true
+}
+
+// Rename はキーの名前を変更します（同じキーが複数ある場合はすべて変更します）
+// 値や他の値の中の変数参照は変更しません
+func (d *Document) Rename(oldKey, newKey string) error {
+	if !IsValidKey(newKey) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, newKey)
+	}
+	if d.lastIndex(oldKey) < 0 {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, oldKey)
+	}
+	if oldKey == newKey {
+		return nil
+	}
+	if d.lastIndex(newKey) >= 0 {
+		return fmt.Errorf("%w: %s", ErrKeyExists, newKey)
+	}
+
+	// 後ろから置き換えて、前の位置がずれないようにする
+	for i := len(d.segments) - 1; i >= 0; i-- {
+		seg := d.segments[i]
+		if seg.entry != nil && seg.entry.Key == oldKey {
+			d.data = spliceBytes(d.data, seg.keyStart, seg.keyStart+len(oldKey), newKey)
+		}
+	}
+	d.reset(d.data)
+	return nil
+}
+
+// キーの最後の出現の位置を返す（ない場合は -1）
+func (d *Document) lastIndex(key string) int {
+	for i := len(d.segments) - 1; i >= 0; i-- {
+		if d.segments[i].entry != nil && d.segments[i].entry.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// data の [start, end) を s に置き換えて解析し直す
+func (d *Document) splice(start, end int, s string) {
+	d.reset(spliceBytes(d.data, start, end, s))
+}
+
+func spliceBytes(data []byte, start, end int, s string) []byte {
+	result := make([]byte, 0, len(data)-(end-start)+len(s))
+	result = append(result, data[:start]...)
+	result = append(result, s...)
+	return append(result, data[end:]...)
+}
+
+// QuoteValue は値を、Parse で同じ値として読み取れ、変数参照として展開されない表記にします
+// preferred の引用符で表せる場合はそれを使用します。引用符なしを指定した場合でも、
+// 空白や「#」「$」、引用符などを含む値はシングルクォート（値に ' を含む場合はダブルクォート）で囲みます
+func QuoteValue(value string, preferred QuoteStyle) string {
+	// シングルクォートとバッククォートの中の CRLF は LF として読み取られるため、CR はエスケープする
+	if strings.Contains(value, "\r") {
+		return doubleQuote(value)
+	}
+
+	switch preferred {
+	case Unquoted:
+		if !strings.ContainsAny(value, " \t\r\n#'\"`$\\") {
+			return value
+		}
+	case BacktickQuoted:
+		if !strings.Contains(value, "`") {
+			return "`" + value + "`"
+		}
+	case DoubleQuoted:
+		return doubleQuote(value)
+	}
+
+	if !strings.Contains(value, "'") {
+		return "'" + value + "'"
+	}
+	return doubleQuote(value)
+}
+
+// ダブルクォートで囲み、ダブルクォート内で特別な意味を持つ文字をエスケープする
+// 改行はそのまま残し、CRは改行の一部として扱われないよう \r と書く
+func doubleQuote(value string) string {
+	var b strings.Builder
+	b.Grow(len(value) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '"', '\\', '$', '`':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,172 @@
+package env
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const documentContent = "# アプリケーションの設定\r\n" +
+	"\n" +
+	"  export APP_ENV = production   # 本番\n" +
+	"DB_URL=\"postgres://localhost\"\n" +
+	"CERT='-----BEGIN-----\n" +
+	"abc\n" +
+	"-----END-----'\n" +
+	"garbage line\n" +
+	"\t\n" +
+	"EMPTY= # あとで設定\n" +
+	"TICK=`x`\n" +
+	"DUP=1\n" +
+	"DUP=2\n" +
+	"LAST=no-newline"
+
+func TestDocumentRoundTrip(t *testing.T) {
+	for _, content := range []string{documentContent, "", "\n", "A=1", "# only comment", "A=\"unterminated\nB=2\n", "\r\n\r\n"} {
+		doc := ParseDocument([]byte(content))
+		if got := string(doc.Bytes()); got != content {
+			t.Errorf("Bytes() = %q, want %q", got, content)
+		}
+		want, _ := Parse([]byte(content))
+		if got := doc.Entries(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Entries() = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestDocumentGetAndKeys(t *testing.T) {
+	doc := ParseDocument([]byte(documentContent))
+
+	wantKeys := []string{"APP_ENV", "DB_URL", "CERT", "EMPTY", "TICK", "DUP", "LAST"}
+	if got := doc.Keys(); !reflect.DeepEqual(got, wantKeys) {
+		t.Errorf("Keys() = %v, want %v", got, wantKeys)
+	}
+	for key, want := range map[string]string{"APP_ENV": "production", "CERT": "-----BEGIN-----\nabc\n-----END-----", "DUP": "2", "EMPTY": ""} {
+		if got, ok := doc.Get(key); !ok || got != want {
+			t.Errorf("Get(%s) = %q, %v, want %q", key, got, ok, want)
+		}
+	}
+	if _, ok := doc.Get("MISSING"); ok {
+		t.Error("Get(MISSING) が見つかりました")
+	}
+	if len(doc.Diagnostics()) == 0 {
+		t.Error("Diagnostics() が書式の問題を返しませんでした")
+	}
+}
+
+func TestDocumentSet(t *testing.T) {
+	doc := ParseDocument([]byte(documentContent))
+	sets := []struct{ key, value string }{
+		{"APP_ENV", "staging"},
+		{"DB_URL", `postgres://u:p@h/"db"`},
+		{"CERT", "new\ncert"},
+		{"EMPTY", "filled"},
+		{"TICK", "it's"},
+		{"DUP", "3"},
+		{"LAST", "has space"},
+		{"NEW_KEY", "$HOME"},
+	}
+	for _, s := range sets {
+		if err := doc.Set(s.key, s.value); err != nil {
+			t.Fatalf("Set(%s) error = %v", s.key, err)
+		}
+	}
+
+	want := "# アプリケーションの設定\r\n" +
+		"\n" +
+		"  export APP_ENV = staging   # 本番\n" +
+		"DB_URL=\"postgres://u:p@h/\\\"db\\\"\"\n" +
+		"CERT='new\n" +
+		"cert'\n" +
+		"garbage line\n" +
+		"\t\n" +
+		"EMPTY=filled # あとで設定\n" +
+		"TICK=`it's`\n" +
+		"DUP=1\n" +
+		"DUP=3\n" +
+		"LAST='has space'\n" +
+		"NEW_KEY='$HOME'\n"
+	if got := doc.String(); got != want {
+		t.Errorf("Set() の結果 =\n%q\nwant\n%q", got, want)
+	}
+
+	// 設定した値は展開せずにそのまま読み取れる
+	entries, err := Interpolate(doc.Entries(), InterpolateOptions{})
+	if err != nil {
+		t.Fatalf("Interpolate() error = %v", err)
+	}
+	values := EnvMap(entries)
+	for _, s := range sets {
+		if values[s.key] != s.value {
+			t.Errorf("%s = %q, want %q", s.key, values[s.key], s.value)
+		}
+	}
+
+	if err := doc.Set("BAD KEY", "x"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Set(無効なキー) error = %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestDocumentDeleteAndRename(t *testing.T) {
+	doc := ParseDocument([]byte(documentContent))
+
+	if !doc.Delete("DUP") {
+		t.Error("Delete(DUP) = false")
+	}
+	if doc.Delete("DUP") {
+		t.Error("削除済みのキーで Delete(DUP) = true")
+	}
+	if err := doc.Rename("CERT", "TLS_CERT"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if err := doc.Rename("APP_ENV", "APP_ENV"); err != nil {
+		t.Errorf("同じ名前への Rename() error = %v", err)
+	}
+
+	want := "# アプリケーションの設定\r\n" +
+		"\n" +
+		"  export APP_ENV = production   # 本番\n" +
+		"DB_URL=\"postgres://localhost\"\n" +
+		"TLS_CERT='-----BEGIN-----\n" +
+		"abc\n" +
+		"-----END-----'\n" +
+		"garbage line\n" +
+		"\t\n" +
+		"EMPTY= # あとで設定\n" +
+		"TICK=`x`\n" +
+		"LAST=no-newline"
+	if got := doc.String(); got != want {
+		t.Errorf("Delete()/Rename() の結果 =\n%q\nwant\n%q", got, want)
+	}
+
+	if err := doc.Rename("MISSING", "OTHER"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Rename(存在しないキー) error = %v, want %v", err, ErrKeyNotFound)
+	}
+	if err := doc.Rename("TICK", "LAST"); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("Rename(既存のキー) error = %v, want %v", err, ErrKeyExists)
+	}
+	if err := doc.Rename("TICK", "1BAD"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Rename(無効なキー) error = %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestQuoteValue(t *testing.T) {
+	values := []string{"", "plain", "with space", "it's", `say "hi"`, "$HOME ${X:-y}", "a\\nb", "line1\nline2", "cr\r\nlf", "#hash", "both ' and \"", "`tick`", " padded "}
+	styles := []QuoteStyle{Unquoted, SingleQuoted, DoubleQuoted, BacktickQuoted}
+
+	// どの引用符を指定しても、展開の有無によらず同じ値として読み取れる
+	for _, value := range values {
+		for _, style := range styles {
+			content := "KEY=" + QuoteValue(value, style) + "\n"
+			entries, diags := ParseWithDiagnostics([]byte(content))
+			if len(entries) != 1 || entries[0].Value != value || len(diags) != 0 {
+				t.Errorf("QuoteValue(%q, %d) = %q: entries = %+v, diags = %v", value, style, content, entries, diags)
+				continue
+			}
+			expanded, err := Interpolate(entries, InterpolateOptions{})
+			if err != nil || expanded[0].Value != value {
+				t.Errorf("QuoteValue(%q, %d) = %q を展開した値 = %q, %v", value, style, content, expanded[0].Value, err)
+			}
+		}
+	}
+}
@@ -1,165 +1,168 @@
 package env
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/uzulla/envault/internal/tui"
+	"github.com/uzulla/envault/pkg/secret"
 )
 
 // .envファイルの内容をパースして環境変数のマップを返します
+// 書式は Parse を参照してください。同じキーが複数回出現した場合は最後の値を使用します
+// 変数参照は展開しません（展開する場合は Parse と Interpolate を使用してください）
 func ParseEnvContent(data []byte) (map[string]string, error) {
-	envVars := make(map[string]string)
-	
-	scanner := bufio.NewScanner(bytes.NewReader(data))
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		
-		// 空行やコメント行をスキップ
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		
-		// = がない行を不正として無視
-		if !strings.Contains(line, "=") {
-			continue
-		}
-		
-		// Key=Value の形式を解析
-		parts := strings.SplitN(line, "=", 2)
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-		
-		// クォーテーションを削除
-		if (strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")) ||
-			(strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'")) {
-			value = value[1 : len(value)-1]
-		}
-		
-		envVars[key] = value
+	entries, err := Parse(data)
+	if err != nil {
+		return nil, err
 	}
-	
-	if err := scanner.Err(); err != nil {
+	return EnvMap(entries), nil
+}
+
+// EnvMap は変数の並びから環境変数のマップを作成します（同じキーは最後の値を使用）
+func EnvMap(entries []Entry) map[string]string {
+	envVars := make(map[string]string, len(entries))
+	for _, e := range entries {
+		envVars[e.Key] = e.Value
+	}
+	return envVars
+}
+
+// RawEntry は.envファイルの1つの変数です
+// RawValue は「=」の右側の表記（引用符を含む）をそのまま保持します
+type RawEntry struct {
+	Key      string
+	RawValue string
+}
+
+// .envファイルの内容を、値の表記を変えずに変数の並びとして返します
+// 結果を「Key=RawValue」の行として書き出すと、ParseEnvContent で同じマップが得られます
+func ParseRawEntries(data []byte) ([]RawEntry, error) {
+	parsed, err := Parse(data)
+	if err != nil {
 		return nil, err
 	}
-	
-	return envVars, nil
+
+	entries := make([]RawEntry, 0, len(parsed))
+	for _, e := range parsed {
+		entries = append(entries, RawEntry{Key: e.Key, RawValue: e.RawValue})
+	}
+
+	return entries, nil
 }
 
 // .envファイルの内容をパースして環境変数リストを返します（コメント付き）
 func ParseEnvContentWithComments(data []byte) ([]tui.EnvVar, error) {
-	var result []tui.EnvVar
-	var orderedKeys []string // 環境変数の出現順を保持
-	var envVarsWithComments = make(map[string]tui.EnvVar) // キーと環境変数オブジェクトのマップ
-	
-	envVarsMap, err := ParseEnvContent(data)
+	entries, err := Parse(data)
 	if err != nil {
 		return nil, err
 	}
-	
-	// コメントを再度スキャンして環境変数に関連付ける
-	scanner := bufio.NewScanner(bytes.NewReader(data))
-	var lastComment string
-	
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		
-		// コメント行を保存（複数行のコメントを連結）
-		if strings.HasPrefix(line, "#") {
-			comment := strings.TrimPrefix(line, "#")
-			comment = strings.TrimSpace(comment)
-			
-			// 複数行のコメントを連結
-			if lastComment != "" {
-				lastComment += " " + comment
-			} else {
-				lastComment = comment
-			}
-			continue
+	return EnvVarList(entries), nil
+}
+
+// EnvVarList は変数の並びからTUIで選択する環境変数リストを作成します
+// 直前のコメント行（なければ行末のコメント）を変数の説明として使用し、
+// 同じキーが複数回出現した場合は最初の位置に最後の値を使用します
+func EnvVarList(entries []Entry) []tui.EnvVar {
+	var result []tui.EnvVar
+	index := make(map[string]int) // キーと result 内の位置のマップ
+	for _, e := range entries {
+		comment := e.Comment
+		if comment == "" {
+			comment = e.InlineComment
 		}
-		
-		// Key=Value の行を処理
-		if strings.Contains(line, "=") {
-			parts := strings.SplitN(line, "=", 2)
-			key := strings.TrimSpace(parts[0])
-			
-			// マップから値を取得し、出現順を保持
-			if value, exists := envVarsMap[key]; exists {
-				// 同じキーが複数回出現した場合は最後の値を使用
-				// ただし順序リストには一度だけ追加
-				alreadyAdded := false
-				for _, existingKey := range orderedKeys {
-					if existingKey == key {
-						alreadyAdded = true
-						break
-					}
-				}
-				
-				if !alreadyAdded {
-					orderedKeys = append(orderedKeys, key)
-				}
-				
-				// 環境変数オブジェクトを作成しマップに保存
-				envVarsWithComments[key] = tui.EnvVar{
-					Key:     key,
-					Value:   value,
-					Comment: lastComment,
-					Enabled: true,
-				}
-				
-				lastComment = "" // コメントをリセット
-			}
-		} else {
-			lastComment = "" // Key=Value の形式でない行ではコメントをリセット
+		envVar := tui.EnvVar{
+			Key:     e.Key,
+			Value:   e.Value,
+			Comment: comment,
+			Enabled: true,
 		}
-	}
-	
-	// 出現順に基づいて結果を構築
-	for _, key := range orderedKeys {
-		if envVar, exists := envVarsWithComments[key]; exists {
-			result = append(result, envVar)
+
+		if i, exists := index[e.Key]; exists {
+			result[i] = envVar
+			continue
 		}
+		index[e.Key] = len(result)
+		result = append(result, envVar)
 	}
-	
-	return result, nil
+
+	return result
 }
 
 // エクスポート用のスクリプトを生成します
-func GenerateExportScript(envVars map[string]string) string {
-	var script strings.Builder
+// 値はシングルクォートで囲むため、$ やバッククォートなどを含む値も展開・実行されません
+// シェルの変数名として使えないキーがある場合はエラーを返します
+// スクリプトには値がそのまま含まれるため、使用後は呼び出し側で Destroy してください
+func GenerateExportScript(envVars map[string]string) (*secret.Buffer, error) {
+	keys := make([]string, 0, len(envVars))
+	for key := range envVars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	script := secret.New(0)
 	script.WriteString("#!/bin/bash\n\n")
-	
-	for key, value := range envVars {
-		if strings.ContainsAny(value, " \t\n\r\"'`$&|;<>(){}[]\\") {
-			script.WriteString(fmt.Sprintf("export %s=\"%s\"\n", key, escapeValue(value)))
-		} else {
-			script.WriteString(fmt.Sprintf("export %s=%s\n", key, value))
+
+	for _, key := range keys {
+		if err := writeExport(script, key, envVars[key]); err != nil {
+			script.Destroy()
+			return nil, err
 		}
 	}
-	
-	return script.String()
+
+	return script, nil
 }
 
 // TUI選択後の環境変数リストからエクスポートスクリプトを生成します
-func GenerateExportScriptFromEnvVarList(envVars []tui.EnvVar) string {
-	var script strings.Builder
+// シェルの変数名として使えないキーがある場合はエラーを返します
+// スクリプトには値がそのまま含まれるため、使用後は呼び出し側で Destroy してください
+func GenerateExportScriptFromEnvVarList(envVars []tui.EnvVar) (*secret.Buffer, error) {
+	script := secret.New(0)
 	script.WriteString("#!/bin/bash\n\n")
-	
+
 	for _, ev := range envVars {
 		if !ev.Enabled {
 			continue // 無効な環境変数はスキップ
 		}
-		
-		if strings.ContainsAny(ev.Value, " \t\n\r\"'`$&|;<>(){}[]\\") {
-			script.WriteString(fmt.Sprintf("export %s=\"%s\"\n", ev.Key, escapeValue(ev.Value)))
-		} else {
-			script.WriteString(fmt.Sprintf("export %s=%s\n", ev.Key, ev.Value))
+		if err := writeExport(script, ev.Key, ev.Value); err != nil {
+			script.Destroy()
+			return nil, err
 		}
 	}
-	
-	return script.String()
+
+	return script, nil
+}
+
+// export 文を1行書き込みます
+// 値はシングルクォートで囲み、値の中の ' はクォートを一度閉じて \' を置き、クォートを開き直して書きます
+// 値の複製を作らないよう、fmt やエスケープ済みの文字列を経由せずに直接書き込みます
+func writeExport(script *secret.Buffer, key, value string) error {
+	if err := checkShellKey(key); err != nil {
+		return err
+	}
+
+	script.WriteString("export ")
+	script.WriteString(key)
+	script.WriteString("='")
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\'' {
+			script.WriteString(`'\''`)
+			continue
+		}
+		script.WriteByte(value[i])
+	}
+	script.WriteString("'\n")
+	return nil
+}
+
+// キーがシェルの変数名として使えるか確認します
+// 使えないキーをそのままスクリプトに書くと、キー名に含まれるコマンドが実行されるおそれがあります
+func checkShellKey(key string) error {
+	if !IsValidKey(key) {
+		return fmt.Errorf("%w: %q はシェルの変数名として使えないため、スクリプトを生成できません", ErrInvalidKey, key)
+	}
+	return nil
 }
 
 // TUI選択後の環境変数リストから有効な環境変数のマップを生成します
@@ -187,34 +190,42 @@ func CountEnabledEnvVars(envVars []tui.EnvVar) int {
 }
 
 // アンセット用のスクリプトを生成します
-func GenerateUnsetScript(envVars map[string]string) string {
+// シェルの変数名として使えないキーがある場合はエラーを返します
+func GenerateUnsetScript(envVars map[string]string) (string, error) {
+	keys := make([]string, 0, len(envVars))
+	for key := range envVars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
 	var script strings.Builder
 	script.WriteString("#!/bin/bash\n\n")
-	
-	for key := range envVars {
-		script.WriteString(fmt.Sprintf("unset %s\n", key))
+
+	for _, key := range keys {
+		if err := checkShellKey(key); err != nil {
+			return "", err
+		}
+		script.WriteString("unset " + key + "\n")
 	}
-	
-	return script.String()
+
+	return script.String(), nil
 }
 
 // TUI選択後の環境変数リストからアンセットスクリプトを生成します
-func GenerateUnsetScriptFromEnvVarList(envVars []tui.EnvVar) string {
+// シェルの変数名として使えないキーがある場合はエラーを返します
+func GenerateUnsetScriptFromEnvVarList(envVars []tui.EnvVar) (string, error) {
 	var script strings.Builder
 	script.WriteString("#!/bin/bash\n\n")
-	
+
 	for _, ev := range envVars {
 		if !ev.Enabled {
 			continue // 無効な環境変数はスキップ
 		}
-		
-		script.WriteString(fmt.Sprintf("unset %s\n", ev.Key))
+		if err := checkShellKey(ev.Key); err != nil {
+			return "", err
+		}
+		script.WriteString("unset " + ev.Key + "\n")
 	}
-	
-	return script.String()
-}
 
-// シェルスクリプト内でのエスケープ処理を行います
-func escapeValue(value string) string {
-	return strings.ReplaceAll(value, "\"", "\\\"")
-}
\ No newline at end of file
+	return script.String(), nil
+}
@@ -1,9 +1,16 @@
 package env
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/uzulla/envault/internal/tui"
 )
 
 func TestParseEnvContent(t *testing.T) {
@@ -53,31 +60,157 @@ func TestParseEnvContent(t *testing.T) {
 	}
 }
 
+func TestParseRawEntries(t *testing.T) {
+	content := "# コメント\nKEY1=value1\n\nKEY2=\"quoted value\"\nKEY3='single quoted'\n"
+
+	entries, err := ParseRawEntries([]byte(content))
+	if err != nil {
+		t.Fatalf("ParseRawEntries() error = %v", err)
+	}
+	expected := []RawEntry{
+		{Key: "KEY1", RawValue: "value1"},
+		{Key: "KEY2", RawValue: "\"quoted value\""},
+		{Key: "KEY3", RawValue: "'single quoted'"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("ParseRawEntries() = %v, want %v", entries, expected)
+	}
+
+	// 書き出した内容は元の内容と同じ変数として読み取れること
+	var lines []string
+	for _, e := range entries {
+		lines = append(lines, e.Key+"="+e.RawValue)
+	}
+	want, _ := ParseEnvContent([]byte(content))
+	got, _ := ParseEnvContent([]byte(strings.Join(lines, "\n")))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("書き出した内容 = %v, want %v", got, want)
+	}
+}
+
 func TestGenerateExportScript(t *testing.T) {
 	envVars := map[string]string{
 		"KEY1": "value1",
 		"KEY2": "value with spaces",
 		"KEY3": "value\"with\"quotes",
+		"KEY4": "it's",
+		"KEY5": "",
+	}
+
+	buf, err := GenerateExportScript(envVars)
+	if err != nil {
+		t.Fatalf("GenerateExportScript() error = %v", err)
+	}
+	defer buf.Destroy()
+
+	want := "#!/bin/bash\n\n" +
+		"export KEY1='value1'\n" +
+		"export KEY2='value with spaces'\n" +
+		"export KEY3='value\"with\"quotes'\n" +
+		"export KEY4='it'\\''s'\n" +
+		"export KEY5=''\n"
+	if got := string(buf.Bytes()); got != want {
+		t.Errorf("GenerateExportScript() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// 悪意のある値を含むスクリプトを bash で実行し、値がそのまま設定され、値の中のコマンドが実行されないことを確認する
+func TestGenerateExportScriptAdversarialValues(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash が見つかりません")
 	}
 
-	script := GenerateExportScript(envVars)
+	marker := filepath.Join(t.TempDir(), "pwned")
+	values := []string{
+		"$(touch " + marker + ")",
+		"`touch " + marker + "`",
+		"${HOME}$HOME",
+		"'; touch " + marker + "; echo '",
+		"'\\''",
+		"\"; touch " + marker + "; \"",
+		"a;touch " + marker,
+		"a && touch " + marker + " || b",
+		"back\\slash\\",
+		"line1\nline2\n",
+		"tab\there\r\n",
+		"!!history! $? $$ $0 $@ *",
+		"<(touch " + marker + ") >" + marker,
+		"'",
+		"''",
+		"",
+		" leading and trailing ",
+		"日本語の値",
+	}
 
-	if !strings.HasPrefix(script, "#!/bin/bash") {
-		t.Errorf("スクリプトが#!/bin/bashで始まっていません")
+	envVars := make(map[string]string, len(values))
+	var list []tui.EnvVar
+	for i, value := range values {
+		key := fmt.Sprintf("ADVERSARIAL_%d", i)
+		envVars[key] = value
+		list = append(list, tui.EnvVar{Key: key, Value: value, Enabled: true})
 	}
+	list = append(list, tui.EnvVar{Key: "DISABLED", Value: "$(touch " + marker + ")", Enabled: false})
 
-	for key := range envVars {
-		if !strings.Contains(script, "export "+key+"=") {
-			t.Errorf("スクリプトに環境変数 %s のエクスポートが含まれていません", key)
+	fromMap, err := GenerateExportScript(envVars)
+	if err != nil {
+		t.Fatalf("GenerateExportScript() error = %v", err)
+	}
+	defer fromMap.Destroy()
+	fromList, err := GenerateExportScriptFromEnvVarList(list)
+	if err != nil {
+		t.Fatalf("GenerateExportScriptFromEnvVarList() error = %v", err)
+	}
+	defer fromList.Destroy()
+
+	for name, script := range map[string][]byte{"map": fromMap.Bytes(), "list": fromList.Bytes()} {
+		// eval "$(envault export -o)" と同じように評価し、設定された値を NUL 区切りで出力する
+		cmd := exec.Command("bash", "-c", `eval "$1"; for i in $(seq 0 $2); do eval "printf '%s\\0' \"\$ADVERSARIAL_$i\""; done`,
+			"bash", string(script), fmt.Sprint(len(values)-1))
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%s: スクリプトの実行に失敗しました: %v\n%s", name, err, script)
+		}
+
+		got := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+		if !reflect.DeepEqual(got, values) {
+			t.Errorf("%s: 設定された値 = %q, want %q", name, got, values)
+		}
+		if _, err := os.Stat(marker); !os.IsNotExist(err) {
+			t.Fatalf("%s: 値の中のコマンドが実行されました\n%s", name, script)
 		}
 	}
+}
+
+func TestGenerateScriptInvalidKeys(t *testing.T) {
+	keys := []string{"A;touch pwned", "$(touch pwned)", "`touch pwned`", "A B", "A=B", "1A", "A-B", "", "A\nB"}
 
-	if !strings.Contains(script, "export KEY2=\"value with spaces\"") {
-		t.Errorf("スペースを含む値が適切にエスケープされていません")
+	for _, key := range keys {
+		envVars := map[string]string{"VALID": "x", key: "value"}
+		list := []tui.EnvVar{{Key: "VALID", Value: "x", Enabled: true}, {Key: key, Value: "value", Enabled: true}}
+
+		if _, err := GenerateExportScript(envVars); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("GenerateExportScript(%q) error = %v, want %v", key, err, ErrInvalidKey)
+		}
+		if _, err := GenerateExportScriptFromEnvVarList(list); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("GenerateExportScriptFromEnvVarList(%q) error = %v, want %v", key, err, ErrInvalidKey)
+		}
+		if _, err := GenerateUnsetScript(envVars); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("GenerateUnsetScript(%q) error = %v, want %v", key, err, ErrInvalidKey)
+		}
+		if _, err := GenerateUnsetScriptFromEnvVarList(list); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("GenerateUnsetScriptFromEnvVarList(%q) error = %v, want %v", key, err, ErrInvalidKey)
+		}
 	}
 
-	if !strings.Contains(script, "export KEY3=\"value\\\"with\\\"quotes\"") {
-		t.Errorf("引用符を含む値が適切にエスケープされていません")
+	// 無効にした環境変数のキーは確認しない
+	list := []tui.EnvVar{{Key: "VALID", Value: "x", Enabled: true}, {Key: "A;touch pwned", Value: "value", Enabled: false}}
+	script, err := GenerateExportScriptFromEnvVarList(list)
+	if err != nil {
+		t.Fatalf("GenerateExportScriptFromEnvVarList() error = %v", err)
+	}
+	defer script.Destroy()
+	if strings.Contains(string(script.Bytes()), "pwned") {
+		t.Errorf("無効にした環境変数がスクリプトに含まれています: %s", script.Bytes())
 	}
 }
 
@@ -87,15 +220,12 @@ func TestGenerateUnsetScript(t *testing.T) {
 		"KEY2": "value2",
 	}
 
-	script := GenerateUnsetScript(envVars)
-
-	if !strings.HasPrefix(script, "#!/bin/bash") {
-		t.Errorf("スクリプトが#!/bin/bashで始まっていません")
+	script, err := GenerateUnsetScript(envVars)
+	if err != nil {
+		t.Fatalf("GenerateUnsetScript() error = %v", err)
 	}
 
-	for key := range envVars {
-		if !strings.Contains(script, "unset "+key) {
-			t.Errorf("スクリプトに環境変数 %s のアンセットが含まれていません", key)
-		}
+	if want := "#!/bin/bash\n\nunset KEY1\nunset KEY2\n"; script != want {
+		t.Errorf("GenerateUnsetScript() = %q, want %q", script, want)
 	}
 }
@@ -0,0 +1,224 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInterpolationCycle = errors.New("変数の参照が循環しています")
+	ErrRequiredVariable   = errors.New("必須の変数が設定されていません")
+	ErrInvalidReference   = errors.New("無効な変数参照です")
+)
+
+// InterpolateOptions は変数参照の展開方法です
+type InterpolateOptions struct {
+	// LookupEnv はファイルにないキーを参照したときに値を探す関数です（os.LookupEnv など）
+	// nil の場合、ファイルにないキーは未定義として扱い、プロセスの環境変数は参照しません
+	LookupEnv func(key string) (string, bool)
+}
+
+// Interpolate は値の中の変数参照を展開した entries を返します
+//   - $VAR と ${VAR} はファイル内の VAR の値（同じキーが複数ある場合は最後の値）に置き換える
+//   - ${VAR:-default} は VAR が未定義か空の場合に default を使う（default の中の参照も展開する）
+//   - ${VAR:?message} は VAR が未定義か空の場合にエラーとする
+//   - 未定義の変数は空文字列に置き換える
+//   - シングルクォートとバッククォートで囲んだ値は展開しない。「\$」と書くと $ そのものになる
+//   - 参照はファイル内の順序によらず解決し、参照が循環している場合はエラーとする
+//   - 値の中で自身のキーを参照した場合（PATH=/extra:$PATH など）は、ファイル内のそれより前の定義の値を使う
+//     前の定義がない場合は、ファイルにないキーと同じように扱う
+func Interpolate(entries []Entry, opts InterpolateOptions) ([]Entry, error) {
+	ip := &interpolator{
+		entries:   entries,
+		defs:      make(map[string][]int, len(entries)),
+		resolved:  make(map[int]string, len(entries)),
+		lookupEnv: opts.LookupEnv,
+	}
+	for i := range entries {
+		ip.defs[entries[i].Key] = append(ip.defs[entries[i].Key], i)
+	}
+
+	result := make([]Entry, len(entries))
+	for i, e := range entries {
+		value, err := ip.resolveEntry(i)
+		if err != nil {
+			return nil, fmt.Errorf("%d行目のキー %s: %w", e.Line, e.Key, err)
+		}
+		e.Value = value
+		result[i] = e
+	}
+
+	return result, nil
+}
+
+// interpolator はキーの値を参照先から順に展開します
+type interpolator struct {
+	entries   []Entry
+	defs      map[string][]int // キーごとの定義の位置（出現順）
+	resolved  map[int]string   // 展開済みの値（entries の位置ごと）
+	resolving []int            // 展開中の entries の位置（循環の検出に使用）
+	lookupEnv func(key string) (string, bool)
+}
+
+// 展開中の値から参照したキーの値を返す。未定義の場合は ok = false を返す
+// 他のキーは最後の定義を、自身のキーはそれより前の最後の定義を参照する
+func (ip *interpolator) resolve(key string) (value string, ok bool, err error) {
+	defs := ip.defs[key]
+	if n := len(ip.resolving); n > 0 {
+		if current := ip.resolving[n-1]; ip.entries[current].Key == key {
+			// 自身より前の定義に絞り込む
+			i := 0
+			for i < len(defs) && defs[i] < current {
+				i++
+			}
+			defs = defs[:i]
+		}
+	}
+
+	if len(defs) == 0 {
+		if ip.lookupEnv != nil {
+			v, ok := ip.lookupEnv(key)
+			return v, ok, nil
+		}
+		return "", false, nil
+	}
+
+	value, err = ip.resolveEntry(defs[len(defs)-1])
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// entries[i] の展開後の値を返す
+func (ip *interpolator) resolveEntry(i int) (string, error) {
+	if v, ok := ip.resolved[i]; ok {
+		return v, nil
+	}
+
+	for n, j := range ip.resolving {
+		if j == i {
+			var chain []string
+			for _, k := range ip.resolving[n:] {
+				chain = append(chain, ip.entries[k].Key)
+			}
+			chain = append(chain, ip.entries[i].Key)
+			return "", fmt.Errorf("%w: %s", ErrInterpolationCycle, strings.Join(chain, " -> "))
+		}
+	}
+	ip.resolving = append(ip.resolving, i)
+	value, err := ip.expandEntry(&ip.entries[i])
+	ip.resolving = ip.resolving[:len(ip.resolving)-1]
+	if err != nil {
+		return "", err
+	}
+
+	ip.resolved[i] = value
+	return value, nil
+}
+
+// 引用符の種類に応じて値を展開する
+func (ip *interpolator) expandEntry(e *Entry) (string, error) {
+	switch e.Quote {
+	case SingleQuoted, BacktickQuoted:
+		return e.Value, nil
+	case DoubleQuoted:
+		return ip.expand(e.RawValue[1:len(e.RawValue)-1], true)
+	default:
+		return ip.expand(e.RawValue, false)
+	}
+}
+
+// 値の表記の中の変数参照を展開する
+func (ip *interpolator) expand(s string, double bool) (string, error) {
+	return decodeValue(s, double, func(ref string) (int, string, error) {
+		return ip.expandReference(ref, double)
+	})
+}
+
+// 「$」で始まる s の先頭の変数参照を展開し、参照の長さと値を返す
+func (ip *interpolator) expandReference(s string, double bool) (int, string, error) {
+	if len(s) < 2 {
+		return 0, "", nil
+	}
+
+	// $VAR
+	if s[1] != '{' {
+		name := identifierPrefix(s[1:])
+		if name == "" {
+			return 0, "", nil
+		}
+		value, _, err := ip.resolve(name)
+		return 1 + len(name), value, err
+	}
+
+	// ${VAR}、${VAR:-default}、${VAR:?message}
+	end := closingBrace(s)
+	if end < 0 {
+		return 0, "", fmt.Errorf("%w: 「${」が閉じられていません（値をシングルクォートで囲むと展開しません）", ErrInvalidReference)
+	}
+	inner := s[2:end]
+	name := identifierPrefix(inner)
+	if name == "" {
+		return 0, "", fmt.Errorf("%w: 「${」の後に変数名がありません", ErrInvalidReference)
+	}
+
+	value, ok, err := ip.resolve(name)
+	if err != nil {
+		return 0, "", err
+	}
+	switch op := inner[len(name):]; {
+	case op == "":
+	case strings.HasPrefix(op, ":-"):
+		if !ok || value == "" {
+			if value, err = ip.expand(op[2:], double); err != nil {
+				return 0, "", err
+			}
+		}
+	case strings.HasPrefix(op, ":?"):
+		if !ok || value == "" {
+			message := op[2:]
+			if message == "" {
+				message = "値を設定してください"
+			}
+			return 0, "", fmt.Errorf("%w: %s: %s", ErrRequiredVariable, name, message)
+		}
+	default:
+		return 0, "", fmt.Errorf("%w: ${%s...}（${VAR}、${VAR:-default}、${VAR:?message} が使用できます）", ErrInvalidReference, name)
+	}
+
+	return end + 1, value, nil
+}
+
+// 「${」で始まる s の対応する「}」の位置を返す（入れ子の ${...} とエスケープした文字を読み飛ばす）
+func closingBrace(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// s の先頭の変数名（英字か _ で始まり、英数字と _ が続く）を返す
+func identifierPrefix(s string) string {
+	n := 0
+	for ; n < len(s); n++ {
+		c := s[n]
+		if c != '_' && !('A' <= c && c <= 'Z') && !('a' <= c && c <= 'z') && !('0' <= c && c <= '9' && n > 0) {
+			break
+		}
+	}
+	return s[:n]
+}
@@ -0,0 +1,408 @@
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// QuoteStyle は値を囲む引用符の種類です
+type QuoteStyle int
+
+const (
+	Unquoted       QuoteStyle = iota // 引用符なし
+	SingleQuoted                     // 'value'（エスケープを解釈しない）
+	DoubleQuoted                     // "value"（エスケープを解釈する）
+	BacktickQuoted                   // `value`（エスケープを解釈しない）
+)
+
+// Entry は.envファイルから読み取った1つの変数です
+type Entry struct {
+	Key string
+	// Value は引用符とエスケープを解釈した値です
+	Value string
+	// RawValue は「=」の右側の表記です（引用符を含み、行末のコメントと空白を除く）
+	RawValue string
+	Quote    QuoteStyle
+	// Export は行頭に「export 」が付いていたかを表します
+	Export bool
+	// Comment は直前のコメント行です（複数行の場合は空白で連結）
+	Comment string
+	// InlineComment は値の後ろの「# 」以降のコメントです
+	InlineComment string
+	// Line と Column は変数のキーの位置（1から）です
+	Line   int
+	Column int
+}
+
+// Parse は.envファイルの内容を一般的なdotenvの規則で解釈し、変数を出現順に返します
+// 同じキーが複数回出現した場合は、すべての出現を返します
+//   - 空行と「#」で始まる行は無視する
+//   - 行頭の「export 」は無視する
+//   - 引用符のない値は前後の空白を取り除き、空白の後の「#」以降をコメントとして扱う
+//   - シングルクォートとバッククォートで囲んだ値は書かれたとおりに扱う
+//   - ダブルクォートで囲んだ値は \n \r \t \" \\ \$ \` のエスケープを解釈する
+//   - 引用符で囲んだ値は複数行にまたがってよい
+//   - 閉じる引用符がない値は、引用符のない値として扱う
+//   - 「=」のない行は無視する
+func Parse(data []byte) ([]Entry, error) {
+	entries, _ := ParseWithDiagnostics(data)
+	return entries, nil
+}
+
+// ParseWithDiagnostics は Parse と同じく変数を返し、あわせて書式の問題を行番号付きで返します
+// 問題のある行も Parse と同じ規則で読み取ります（無効なキー名の変数も返します）
+func ParseWithDiagnostics(data []byte) ([]Entry, Diagnostics) {
+	segments, diags := parseSegments(data)
+	var entries []Entry
+	for _, seg := range segments {
+		if seg.entry != nil {
+			entries = append(entries, *seg.entry)
+		}
+	}
+	return entries, diags
+}
+
+// segment は.envファイルの1行（複数行にまたがる値の場合はその全体）です
+// 範囲はすべて data 内の位置で、行末の改行を含みます
+type segment struct {
+	start, end int
+	entry      *Entry // 変数の行でなければ nil
+	keyStart   int
+	valueStart int // 値の表記の範囲（引用符を含み、行末のコメントを除く）
+	valueEnd   int
+}
+
+// .envファイルの内容を行ごとに区切って解析する
+func parseSegments(data []byte) ([]segment, Diagnostics) {
+	p := &parser{data: data, line: 1}
+	var segments []segment
+	var comment string
+
+	for !p.eof() {
+		seg := segment{start: p.pos}
+		p.skipSpaces()
+		switch {
+		case p.atLineEnd():
+			// 空行でコメントの対応付けをリセット
+			comment = ""
+		case p.peek() == '#':
+			text := strings.TrimSpace(string(p.restOfLine()[1:]))
+			if comment != "" {
+				comment += " " + text
+			} else {
+				comment = text
+			}
+		default:
+			if entry, ok := p.parseAssignment(); ok {
+				entry.Comment = comment
+				seg.entry = &entry
+				seg.keyStart, seg.valueStart, seg.valueEnd = p.keyStart, p.valueStart, p.valueEnd
+			}
+			comment = ""
+		}
+		p.nextLine()
+		seg.end = p.pos
+		segments = append(segments, seg)
+	}
+
+	// 重複したキーは最後の値が使われる
+	seen := make(map[string]int)
+	for _, seg := range segments {
+		e := seg.entry
+		if e == nil {
+			continue
+		}
+		if line, exists := seen[e.Key]; exists {
+			p.diags = append(p.diags, Diagnostic{
+				Line:     e.Line,
+				Column:   e.Column,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("キー %s が重複しています（%d行目の値を上書きします）", e.Key, line),
+			})
+		}
+		seen[e.Key] = e.Line
+	}
+	sortDiagnostics(p.diags)
+
+	return segments, p.diags
+}
+
+// parser は.envファイルの内容を先頭から読み進めます
+type parser struct {
+	data      []byte
+	pos       int
+	line      int
+	lineStart int // 現在の行の先頭の位置
+	diags     Diagnostics
+
+	// 最後に読んだ変数のキーと値の表記の位置
+	keyStart   int
+	valueStart int
+	valueEnd   int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.data)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.data[p.pos]
+}
+
+func (p *parser) atLineEnd() bool {
+	return p.eof() || p.peek() == '\n'
+}
+
+// pos を n まで進め、途中の改行を行番号に数える
+func (p *parser) advanceTo(n int) {
+	skipped := p.data[p.pos:n]
+	if i := bytes.LastIndexByte(skipped, '\n'); i >= 0 {
+		p.line += bytes.Count(skipped, []byte("\n"))
+		p.lineStart = p.pos + i + 1
+	}
+	p.pos = n
+}
+
+// 現在の行での pos の列番号（1から、文字単位）
+func (p *parser) column(pos int) int {
+	return utf8.RuneCount(p.data[p.lineStart:pos]) + 1
+}
+
+// pos の位置の問題を記録する
+func (p *parser) report(pos int, severity Severity, format string, args ...any) {
+	p.diags = append(p.diags, Diagnostic{
+		Line:     p.line,
+		Column:   p.column(pos),
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// 改行以外の空白を読み飛ばす
+func (p *parser) skipSpaces() {
+	for !p.eof() && isSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+// 行末（改行の手前）までを返し、行末まで進める
+func (p *parser) restOfLine() []byte {
+	start := p.pos
+	for !p.atLineEnd() {
+		p.pos++
+	}
+	return p.data[start:p.pos]
+}
+
+// 次の行の先頭まで進める
+func (p *parser) nextLine() {
+	p.restOfLine()
+	if !p.eof() {
+		p.advanceTo(p.pos + 1)
+	}
+}
+
+// 「=」・空白・改行のいずれかまでをキーとして読む
+func (p *parser) readKey() string {
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if c == '=' || c == '\n' || isSpace(c) {
+			break
+		}
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// 「[export ]KEY=VALUE」を読む。形式に合わない行は ok = false を返す
+func (p *parser) parseAssignment() (entry Entry, ok bool) {
+	lineStart := p.pos
+	keyStart := p.pos
+	entry.Key = p.readKey()
+
+	// 「export KEY=...」の export は読み飛ばす（「export=...」や「export =...」は export というキー）
+	if entry.Key == "export" && isSpace(p.peek()) {
+		p.skipSpaces()
+		if p.peek() != '=' && !p.atLineEnd() {
+			entry.Export = true
+			keyStart = p.pos
+			entry.Key = p.readKey()
+		}
+	}
+	entry.Line = p.line
+	entry.Column = p.column(keyStart)
+	p.keyStart = keyStart
+
+	p.skipSpaces()
+	if p.peek() != '=' {
+		// 秘密の値の一部かもしれないため、行の内容はメッセージに含めない
+		p.report(lineStart, SeverityError, "「KEY=VALUE」の形式ではない行です（この行は無視されます）")
+		return entry, false
+	}
+	if entry.Key == "" {
+		p.report(keyStart, SeverityError, "キー名がありません（この行は無視されます）")
+		return entry, false
+	}
+	if !IsValidKey(entry.Key) {
+		p.report(keyStart, SeverityError, "無効なキー名です: %q（英字か _ で始まり、英数字と _ のみ使用できます）", entry.Key)
+	}
+	p.pos++
+	// 空の値を設定し直すときは「=」の直後に書くため、値の位置は空白を読み飛ばす前から始める
+	p.valueStart = p.pos
+	p.skipSpaces()
+
+	if p.parseQuotedValue(&entry) {
+		return entry, true
+	}
+	p.parseUnquotedValue(&entry)
+	return entry, true
+}
+
+// 引用符で囲んだ値を読む。閉じる引用符がない場合は何も読まずに false を返す
+func (p *parser) parseQuotedValue(entry *Entry) bool {
+	quote := p.peek()
+	var style QuoteStyle
+	switch quote {
+	case '\'':
+		style = SingleQuoted
+	case '"':
+		style = DoubleQuoted
+	case '`':
+		style = BacktickQuoted
+	default:
+		return false
+	}
+
+	end := -1
+	for i := p.pos + 1; i < len(p.data); i++ {
+		if p.data[i] == '\\' && style == DoubleQuoted {
+			i++
+			continue
+		}
+		if p.data[i] == quote {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		p.report(p.pos, SeverityError, "キー %s の値の引用符 %c が閉じられていません（値は引用符なしとして扱われます）", entry.Key, quote)
+		return false
+	}
+
+	content := p.data[p.pos+1 : end]
+	p.valueStart, p.valueEnd = p.pos, end+1
+	entry.Quote = style
+	entry.RawValue = string(p.data[p.pos : end+1])
+	if style == DoubleQuoted {
+		entry.Value, _ = decodeValue(string(content), true, nil)
+	} else {
+		entry.Value = string(bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n")))
+	}
+	p.advanceTo(end + 1)
+
+	// 閉じる引用符の後はコメントのみ読む（それ以外の文字は無視する）
+	p.skipSpaces()
+	if p.peek() == '#' {
+		entry.InlineComment = strings.TrimSpace(string(p.restOfLine()[1:]))
+	} else if !p.atLineEnd() {
+		p.report(p.pos, SeverityError, "キー %s の値の引用符の後ろに余分な文字があります（無視されます）", entry.Key)
+	}
+	return true
+}
+
+// 引用符のない値を行末まで読む。空白の後の「#」以降はコメントとして扱う
+func (p *parser) parseUnquotedValue(entry *Entry) {
+	start := p.pos
+	value := p.restOfLine()
+	for i := 0; i < len(value); i++ {
+		if value[i] == '#' && (i == 0 || isSpace(value[i-1])) {
+			entry.InlineComment = strings.TrimSpace(string(value[i+1:]))
+			value = value[:i]
+			break
+		}
+	}
+	value = bytes.TrimRight(value, " \t\r")
+	if len(value) > 0 {
+		p.valueStart = start
+	}
+	p.valueEnd = p.valueStart + len(value)
+
+	entry.Quote = Unquoted
+	entry.Value = string(value)
+	entry.RawValue = entry.Value
+}
+
+// ダブルクォート内で解釈するエスケープ
+var doubleQuoteEscapes = map[byte]byte{
+	'n':  '\n',
+	'r':  '\r',
+	't':  '\t',
+	'"':  '"',
+	'\\': '\\',
+	'$':  '$',
+	'`':  '`',
+}
+
+// expandFunc は「$」で始まる s の先頭の変数参照を展開し、参照の長さと値を返します
+// 変数参照でない場合は長さ 0 を返します
+type expandFunc func(s string) (n int, value string, err error)
+
+// 値の表記を解釈する
+// double の場合はダブルクォート内のエスケープを解釈する（未知のエスケープは書かれたとおりに残す）
+// expand が nil でなければ「$」で始まる変数参照を展開し、「\$」を $ として扱う
+func decodeValue(s string, double bool, expand expandFunc) (string, error) {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && double && i+1 < len(s):
+			if r, ok := doubleQuoteEscapes[s[i+1]]; ok {
+				b.WriteByte(r)
+				i++
+				continue
+			}
+		case c == '\\' && expand != nil && i+1 < len(s) && s[i+1] == '$':
+			b.WriteByte('$')
+			i++
+			continue
+		case c == '\r' && double && i+1 < len(s) && s[i+1] == '\n':
+			// 複数行の値の改行は CRLF でも LF として扱う
+			continue
+		case c == '$' && expand != nil:
+			n, value, err := expand(s[i:])
+			if err != nil {
+				return "", err
+			}
+			if n > 0 {
+				b.WriteString(value)
+				i += n - 1
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
+
+// 改行以外の空白か
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
+
+// 問題を行・列の順に並べる
+func sortDiagnostics(ds Diagnostics) {
+	sort.SliceStable(ds, func(i, j int) bool {
+		if ds[i].Line != ds[j].Line {
+			return ds[i].Line < ds[j].Line
+		}
+		return ds[i].Column < ds[j].Column
+	})
+}
@@ -2,11 +2,16 @@ package file
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/uzulla/envault/internal/armor"
+	"github.com/uzulla/envault/internal/crypto"
 )
 
 const (
@@ -36,6 +41,16 @@ func ReadEnvFile(filePath string) ([]byte, error) {
 }
 
 func WriteVaultedFile(data []byte, outputPath string) error {
+	return WriteVaultedFileStream(outputPath, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteVaultedFileStream は write が書き込んだ内容で暗号化ファイルを作成します
+// 既存のファイルがある場合は上書きするか確認します
+// 一時ファイルに書き込んでから置き換えるため、write が失敗した場合に既存のファイルは変更されません
+func WriteVaultedFileStream(outputPath string, write func(w io.Writer) error) error {
 	if outputPath == "" {
 		outputPath = DefaultVaultedFileName
 	}
@@ -61,13 +76,121 @@ func WriteVaultedFile(data []byte, outputPath string) error {
 		}
 	}
 
-	if err := os.WriteFile(outputPath, data, 0600); err != nil {
-		return fmt.Errorf("ファイルの書き込みに失敗しました: %w", err)
+	return WriteFileAtomicStream(outputPath, 0600, write)
+}
+
+// OpenEnvFile は暗号化する.envファイルを読み込み用に開きます
+func OpenEnvFile(filePath string) (*os.File, error) {
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return nil, ErrFileNotFound
+	}
+	if err == nil && info.Mode().IsRegular() && info.Size() == 0 {
+		return nil, ErrEmptyFile
 	}
 
-	return nil
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("ファイルの読み込みに失敗しました: %w", err)
+	}
+	return f, nil
+}
+
+// OpenVaultedFile は暗号化ファイルを読み込み用に開きます
+// ASCII armor形式のファイルはチェックサムを確認するまで内容を使えないため、全体を読み込んでarmorを外した内容を返します
+// 埋め込み署名は取り除かれます
+func OpenVaultedFile(filePath string) (io.ReadCloser, error) {
+	r, _, err := OpenSignedVaultedFile(filePath)
+	return r, err
+}
+
+// OpenSignedVaultedFile は OpenVaultedFile と同様に暗号化ファイルを開き、埋め込み署名も返します
+// 署名は検証されていません
+func OpenSignedVaultedFile(filePath string) (io.ReadCloser, []*crypto.Signature, error) {
+	if filePath == "" {
+		filePath = DefaultVaultedFileName
+	}
+
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil, ErrFileNotFound
+	}
+	if err == nil && info.Mode().IsRegular() && info.Size() == 0 {
+		return nil, nil, ErrEmptyFile
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ファイルの読み込みに失敗しました: %w", err)
+	}
+
+	reader := bufio.NewReader(f)
+	// 先頭の空白を読み飛ばせるよう、開始行より長めに確認する
+	if head, _ := reader.Peek(512); !armor.IsArmored(head) {
+		var signatures []*crypto.Signature
+		var body io.Reader = reader
+		if info != nil && info.Mode().IsRegular() {
+			// 末尾の埋め込み署名だけを読み、本体はストリームのまま返す
+			trailerSize, sigs, err := readSignatureTrailer(f, info.Size())
+			if err != nil {
+				f.Close()
+				return nil, nil, fmt.Errorf("ファイル '%s' の読み込みに失敗しました: %w", filePath, err)
+			}
+			signatures = sigs
+			body = io.LimitReader(reader, info.Size()-trailerSize)
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{body, f}, signatures, nil
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ファイルの読み込みに失敗しました: %w", err)
+	}
+	data, err = armor.Decode(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ファイル '%s' の読み込みに失敗しました: %w", filePath, err)
+	}
+	data, signatures, err := crypto.SplitSignatures(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ファイル '%s' の読み込みに失敗しました: %w", filePath, err)
+	}
+	return io.NopCloser(bytes.NewReader(data)), signatures, nil
 }
 
+// readSignatureTrailer はファイル末尾の埋め込み署名を読み取り、その長さと署名を返します
+func readSignatureTrailer(f *os.File, size int64) (int64, []*crypto.Signature, error) {
+	if size < int64(crypto.SignatureFooterSize) {
+		return 0, nil, nil
+	}
+	footer := make([]byte, crypto.SignatureFooterSize)
+	if _, err := f.ReadAt(footer, size-int64(len(footer))); err != nil {
+		return 0, nil, err
+	}
+	trailerSize, err := crypto.SignatureTrailerSize(footer)
+	if err != nil || trailerSize == 0 {
+		return 0, nil, err
+	}
+	if int64(trailerSize) > size {
+		return 0, nil, crypto.ErrTruncatedFile
+	}
+
+	trailer := make([]byte, trailerSize)
+	if _, err := f.ReadAt(trailer, size-int64(trailerSize)); err != nil {
+		return 0, nil, err
+	}
+	_, signatures, err := crypto.SplitSignatures(trailer)
+	if err != nil {
+		return 0, nil, err
+	}
+	return int64(trailerSize), signatures, nil
+}
+
+// ReadVaultedFile は暗号化ファイルを読み込みます
+// ASCII armor形式のファイルは、armorを外した内容を返します
 func ReadVaultedFile(filePath string) ([]byte, error) {
 	if filePath == "" {
 		filePath = DefaultVaultedFileName
@@ -86,5 +209,107 @@ func ReadVaultedFile(filePath string) ([]byte, error) {
 		return nil, ErrEmptyFile
 	}
 
+	data, err = armor.DecodeIfArmored(data)
+	if err != nil {
+		return nil, fmt.Errorf("ファイル '%s' の読み込みに失敗しました: %w", filePath, err)
+	}
+
 	return data, nil
 }
+
+// ReplaceVaultedFile は既存の暗号化ファイルを原子的に置き換えます
+// 元のファイルがASCII armor形式の場合は、armor形式のまま書き込みます
+func ReplaceVaultedFile(filePath string, data []byte) error {
+	if original, err := os.ReadFile(filePath); err == nil && armor.IsArmored(original) {
+		data = armor.Encode(data)
+	}
+	return WriteFileAtomic(filePath, data, 0600)
+}
+
+// WriteFileAtomic は一時ファイルに書き込んでからリネームすることで、ファイルを原子的に置き換えます
+func WriteFileAtomic(filePath string, data []byte, perm os.FileMode) error {
+	return WriteFileAtomicStream(filePath, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteFileAtomicStream は write が書き込んだ内容で WriteFileAtomic と同様にファイルを置き換えます
+func WriteFileAtomicStream(filePath string, perm os.FileMode, write func(w io.Writer) error) error {
+	dir := filepath.Dir(filePath)
+	tmpFile, err := os.CreateTemp(dir, "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("一時ファイルの作成に失敗しました: %w", err)
+	}
+	tmpName := tmpFile.Name()
+	defer os.Remove(tmpName) // リネーム成功後は何もしない
+
+	// 細かい書き込みをまとめてからファイルに書き込む
+	buffered := bufio.NewWriter(tmpFile)
+	if err := write(buffered); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("ファイルの書き込みに失敗しました: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("ファイルの同期に失敗しました: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("一時ファイルのクローズに失敗しました: %w", err)
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return fmt.Errorf("パーミッションの設定に失敗しました: %w", err)
+	}
+
+	if err := os.Rename(tmpName, filePath); err != nil {
+		return fmt.Errorf("ファイルの置き換えに失敗しました: %w", err)
+	}
+
+	return nil
+}
+
+// BackupFile はファイルを「<元のパス>.bak」にコピーし、バックアップのパスを返します
+func BackupFile(filePath string) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("ファイルの読み込みに失敗しました: %w", err)
+	}
+
+	backupPath := filePath + ".bak"
+	if err := WriteFileAtomic(backupPath, data, 0600); err != nil {
+		return "", fmt.Errorf("バックアップの作成に失敗しました: %w", err)
+	}
+
+	return backupPath, nil
+}
+
+// FindVaultedFiles はディレクトリ以下を再帰的に探索し、暗号化ファイル（*.vaulted）のパスを返します
+func FindVaultedFiles(root string) ([]string, error) {
+	var paths []string
+
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// バージョン管理のディレクトリは探索しない
+			if path != root && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && strings.HasSuffix(d.Name(), ".vaulted") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ディレクトリの探索に失敗しました: %w", err)
+	}
+
+	return paths, nil
+}
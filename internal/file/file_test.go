@@ -1,9 +1,14 @@
 package file
 
 import (
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/uzulla/envault/internal/armor"
+	"github.com/uzulla/envault/internal/crypto"
 )
 
 func TestReadEnvFile(t *testing.T) {
@@ -100,3 +105,208 @@ func TestReadVaultedFile(t *testing.T) {
 	}
 
 }
+
+func TestArmoredVaultedFile(t *testing.T) {
+	tempDir := t.TempDir()
+	testFilePath := filepath.Join(tempDir, DefaultVaultedFileName)
+	testContent := []byte("ENVAULT2 暗号化されたテストデータ")
+
+	if err := os.WriteFile(testFilePath, armor.Encode(testContent), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	data, err := ReadVaultedFile(testFilePath)
+	if err != nil {
+		t.Fatalf("ReadVaultedFile() error = %v", err)
+	}
+	if string(data) != string(testContent) {
+		t.Errorf("ReadVaultedFile() = %q, want %q", data, testContent)
+	}
+
+	// armor形式のファイルを置き換えるとarmor形式のまま書き込まれること
+	updated := []byte("ENVAULT2 更新したデータ")
+	if err := ReplaceVaultedFile(testFilePath, updated); err != nil {
+		t.Fatalf("ReplaceVaultedFile() error = %v", err)
+	}
+	raw, err := os.ReadFile(testFilePath)
+	if err != nil {
+		t.Fatalf("ファイルの読み込みに失敗しました: %v", err)
+	}
+	if !armor.IsArmored(raw) {
+		t.Errorf("ReplaceVaultedFile() でarmor形式が失われました: %q", raw)
+	}
+	if data, err := ReadVaultedFile(testFilePath); err != nil || string(data) != string(updated) {
+		t.Errorf("ReadVaultedFile() = %q, %v, want %q", data, err, updated)
+	}
+
+	// チェックサムが一致しない場合はエラーになること
+	corrupted := []byte(armor.BeginLine + "\nRU5WQVVMVDI=\n=AAAA\n" + armor.EndLine + "\n")
+	if err := os.WriteFile(testFilePath, corrupted, 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+	if _, err := ReadVaultedFile(testFilePath); err == nil {
+		t.Errorf("破損したarmor形式のファイルを読み込めてしまいました")
+	}
+}
+
+func TestOpenVaultedFile(t *testing.T) {
+	tempDir := t.TempDir()
+	testContent := []byte("ENVAULT2 暗号化されたテストデータ")
+
+	for name, content := range map[string][]byte{
+		"通常の形式":         testContent,
+		"ASCII armor形式": armor.Encode(testContent),
+	} {
+		t.Run(name, func(t *testing.T) {
+			testFilePath := filepath.Join(tempDir, name+".vaulted")
+			if err := os.WriteFile(testFilePath, content, 0600); err != nil {
+				t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+			}
+
+			f, err := OpenVaultedFile(testFilePath)
+			if err != nil {
+				t.Fatalf("OpenVaultedFile() error = %v", err)
+			}
+			defer f.Close()
+			data, err := io.ReadAll(f)
+			if err != nil || string(data) != string(testContent) {
+				t.Errorf("OpenVaultedFile() の内容 = %q, %v, want %q", data, err, testContent)
+			}
+		})
+	}
+
+	if _, err := OpenVaultedFile(filepath.Join(tempDir, "nonexistent.vaulted")); err != ErrFileNotFound {
+		t.Errorf("存在しないファイルで error = %v, want %v", err, ErrFileNotFound)
+	}
+}
+
+func TestOpenSignedVaultedFile(t *testing.T) {
+	tempDir := t.TempDir()
+	testContent := []byte("ENVAULT2 暗号化されたテストデータ")
+
+	key, err := crypto.GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("署名鍵の生成に失敗しました: %v", err)
+	}
+	signature := key.Sign([]byte("digest"))
+	signed := crypto.EmbedSignatures(testContent, []*crypto.Signature{signature})
+
+	for name, content := range map[string][]byte{
+		"通常の形式":         signed,
+		"ASCII armor形式": armor.Encode(signed),
+	} {
+		t.Run(name, func(t *testing.T) {
+			testFilePath := filepath.Join(tempDir, name+".vaulted")
+			if err := os.WriteFile(testFilePath, content, 0600); err != nil {
+				t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+			}
+
+			f, signatures, err := OpenSignedVaultedFile(testFilePath)
+			if err != nil {
+				t.Fatalf("OpenSignedVaultedFile() error = %v", err)
+			}
+			defer f.Close()
+
+			// 埋め込み署名は取り除かれること
+			data, err := io.ReadAll(f)
+			if err != nil || string(data) != string(testContent) {
+				t.Errorf("OpenSignedVaultedFile() の内容 = %q, %v, want %q", data, err, testContent)
+			}
+			if len(signatures) != 1 || !signatures[0].Signer.Equal(key.Public()) {
+				t.Errorf("埋め込み署名 = %v, want 1件", signatures)
+			}
+		})
+	}
+
+	// 署名ブロックの長さがファイルより長い場合
+	broken := filepath.Join(tempDir, "broken.vaulted")
+	if err := os.WriteFile(broken, signed[len(signed)-crypto.SignatureFooterSize-1:], 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+	if _, err := OpenVaultedFile(broken); !errors.Is(err, crypto.ErrTruncatedFile) {
+		t.Errorf("壊れた埋め込み署名で error = %v, want %v", err, crypto.ErrTruncatedFile)
+	}
+}
+
+func TestWriteVaultedFileStreamError(t *testing.T) {
+	tempDir := t.TempDir()
+	testFilePath := filepath.Join(tempDir, DefaultVaultedFileName)
+
+	// 書き込みに失敗した場合はファイルが作成されないこと
+	writeErr := errors.New("暗号化に失敗しました")
+	err := WriteVaultedFileStream(testFilePath, func(w io.Writer) error {
+		w.Write([]byte("途中まで書き込んだデータ"))
+		return writeErr
+	})
+	if !errors.Is(err, writeErr) {
+		t.Errorf("WriteVaultedFileStream() error = %v, want %v", err, writeErr)
+	}
+	if _, err := os.Stat(testFilePath); !os.IsNotExist(err) {
+		t.Errorf("書き込みに失敗したファイルが残っています: %v", err)
+	}
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+		t.Errorf("一時ファイルが残っています: %v", entries)
+	}
+}
+
+func TestWriteFileAtomicAndBackup(t *testing.T) {
+	tempDir := t.TempDir()
+	testFilePath := filepath.Join(tempDir, DefaultVaultedFileName)
+
+	if err := os.WriteFile(testFilePath, []byte("old"), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	backupPath, err := BackupFile(testFilePath)
+	if err != nil {
+		t.Fatalf("BackupFile() error = %v", err)
+	}
+	if backupPath != testFilePath+".bak" {
+		t.Errorf("BackupFile() = %v, want %v", backupPath, testFilePath+".bak")
+	}
+
+	if err := WriteFileAtomic(testFilePath, []byte("new"), 0600); err != nil {
+		t.Fatalf("WriteFileAtomic() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(testFilePath)
+	if string(data) != "new" {
+		t.Errorf("ファイルの内容が期待と異なります。期待: new, 実際: %s", data)
+	}
+	backup, _ := os.ReadFile(backupPath)
+	if string(backup) != "old" {
+		t.Errorf("バックアップの内容が期待と異なります。期待: old, 実際: %s", backup)
+	}
+
+	entries, _ := os.ReadDir(tempDir)
+	if len(entries) != 2 {
+		t.Errorf("一時ファイルが残っています: %v", entries)
+	}
+}
+
+func TestFindVaultedFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{
+		filepath.Join(tempDir, DefaultVaultedFileName),
+		filepath.Join(tempDir, "app", DefaultVaultedFileName),
+		filepath.Join(tempDir, "app", "custom.vaulted"),
+		filepath.Join(tempDir, "app", ".env"),
+		filepath.Join(tempDir, ".git", DefaultVaultedFileName),
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatalf("ディレクトリの作成に失敗しました: %v", err)
+		}
+		if err := os.WriteFile(f, []byte("x"), 0600); err != nil {
+			t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+		}
+	}
+
+	paths, err := FindVaultedFiles(tempDir)
+	if err != nil {
+		t.Fatalf("FindVaultedFiles() error = %v", err)
+	}
+	if len(paths) != 3 {
+		t.Errorf("FindVaultedFiles() = %v, want 3 files", paths)
+	}
+}
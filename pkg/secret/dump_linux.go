@@ -0,0 +1,17 @@
+package secret
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// DisableCoreDumps はプロセスのコアダンプを無効にします
+// Linux では PR_SET_DUMPABLE を 0 にし、同じユーザーの他のプロセスから ptrace でメモリを読まれることも防ぎます
+// この設定は exec した子プロセス（export --new-shell のシェルなど）には引き継がれません
+func DisableCoreDumps() error {
+	return unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0)
+}
+
+// バッファのメモリをコアダンプから除外する（プロセス全体のコアダンプを無効にできない場合の備え）
+func excludeFromDump(mem []byte) {
+	unix.Madvise(mem, unix.MADV_DONTDUMP)
+}
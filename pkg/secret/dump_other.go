@@ -0,0 +1,8 @@
+//go:build !unix
+
+package secret
+
+// DisableCoreDumps はこの環境では何もしません
+func DisableCoreDumps() error {
+	return nil
+}
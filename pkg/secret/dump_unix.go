@@ -0,0 +1,20 @@
+//go:build unix && !linux
+
+package secret
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// DisableCoreDumps はコアファイルのサイズの上限（ソフトリミット）を 0 にして、プロセスのコアダンプを無効にします
+// この上限は子プロセスにも引き継がれます
+func DisableCoreDumps() error {
+	var limit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_CORE, &limit); err != nil {
+		return err
+	}
+	limit.Cur = 0
+	return unix.Setrlimit(unix.RLIMIT_CORE, &limit)
+}
+
+func excludeFromDump(mem []byte) {}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package secret
+
+// この環境ではメモリのロックに対応していないため、通常のメモリを使用する（Destroy でのゼロ埋めは行われる）
+func allocMemory(size int) (mem []byte, mapped, locked bool) {
+	return make([]byte, size), false, false
+}
+
+func freeMemory(mem []byte, mapped, locked bool) {
+	Wipe(mem)
+}
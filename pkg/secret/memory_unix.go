@@ -0,0 +1,34 @@
+//go:build unix
+
+package secret
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ガベージコレクタの管理外に匿名メモリを確保し、ロックとコアダンプからの除外を試みる
+// 確保できない場合は通常のメモリを使用する
+func allocMemory(size int) (mem []byte, mapped, locked bool) {
+	pageSize := os.Getpagesize()
+	mapSize := (size + pageSize - 1) / pageSize * pageSize
+	mem, err := unix.Mmap(-1, 0, mapSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return make([]byte, size), false, false
+	}
+	excludeFromDump(mem)
+	return mem[:size], true, unix.Mlock(mem) == nil
+}
+
+func freeMemory(mem []byte, mapped, locked bool) {
+	Wipe(mem)
+	if !mapped {
+		return
+	}
+	mem = mem[:cap(mem)]
+	if locked {
+		unix.Munlock(mem)
+	}
+	unix.Munmap(mem)
+}
@@ -0,0 +1,192 @@
+// Package secret はパスワード・鍵・復号化した平文などの秘密を保持するバッファを提供します
+//
+// 可能な環境では、バッファをガベージコレクタの管理外のメモリに確保して mlock でスワップへの書き出しを防ぎ、
+// コアダンプからも除外します（Linux の MADV_DONTDUMP）。Destroy はゼロ埋めしてからメモリを解放します
+// ロックできない環境（RLIMIT_MEMLOCK の上限に達した場合など）でも、ゼロ埋めは行われます
+//
+// Goの文字列に変換した値は消去できないため、秘密はできるだけ []byte のまま扱ってください
+package secret
+
+import (
+	"crypto/subtle"
+	"io"
+	"runtime"
+)
+
+const minGrowSize = 64
+
+// Buffer は秘密を保持するバッファです
+// Bytes で得たスライスは Buffer が到達可能な間だけ有効です。スライスだけを保持せず、Buffer も保持してください
+// ゼロ値の Buffer（および nil）は空のバッファとして使用できます
+type Buffer struct {
+	mem    []byte // 確保したメモリ全体
+	n      int    // 使用している長さ
+	mapped bool   // ガベージコレクタの管理外に確保したか
+	locked bool   // mlock でロックしたか
+}
+
+// New は長さ size のゼロ埋めされたバッファを返します
+func New(size int) *Buffer {
+	b := &Buffer{}
+	if size > 0 {
+		b.alloc(size)
+		b.n = size
+	}
+	return b
+}
+
+// FromBytes は data をコピーしたバッファを返します
+// 元の data は呼び出し側で消去してください
+func FromBytes(data []byte) *Buffer {
+	b := &Buffer{}
+	b.Write(data)
+	return b
+}
+
+// FromString は s をコピーしたバッファを返します
+// 元の文字列は消去できないため、文字列で受け取るAPIとの互換のためだけに使用してください
+func FromString(s string) *Buffer {
+	b := &Buffer{}
+	if len(s) > 0 {
+		b.alloc(len(s))
+		b.n = copy(b.mem, s)
+	}
+	return b
+}
+
+// Bytes はバッファの内容を返します。Destroy の後は nil を返します
+func (b *Buffer) Bytes() []byte {
+	if b == nil || b.mem == nil {
+		return nil
+	}
+	return b.mem[:b.n]
+}
+
+// Len はバッファの内容の長さを返します
+func (b *Buffer) Len() int {
+	if b == nil {
+		return 0
+	}
+	return b.n
+}
+
+// Locked はバッファがスワップに書き出されないようロックされているかを返します
+func (b *Buffer) Locked() bool {
+	return b != nil && b.locked
+}
+
+// Write はバッファの末尾に p を追加します
+// 容量が足りない場合は新しいメモリに移し、古いメモリはゼロ埋めして解放します
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.grow(len(p))
+	copy(b.mem[b.n:], p)
+	b.n += len(p)
+	return len(p), nil
+}
+
+// WriteString はバッファの末尾に s を追加します（[]byte への変換によるコピーを作りません）
+func (b *Buffer) WriteString(s string) (int, error) {
+	b.grow(len(s))
+	copy(b.mem[b.n:], s)
+	b.n += len(s)
+	return len(s), nil
+}
+
+// WriteByte はバッファの末尾に c を追加します
+func (b *Buffer) WriteByte(c byte) error {
+	b.grow(1)
+	b.mem[b.n] = c
+	b.n++
+	return nil
+}
+
+// ReadFrom は r の終わりまでをバッファに直接読み込みます
+// io.Copy で使用すると、途中のコピー用バッファを経由せずに読み込めます
+func (b *Buffer) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	for {
+		b.grow(minGrowSize)
+		n, err := r.Read(b.mem[b.n:])
+		b.n += n
+		total += int64(n)
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// TrimSpace は前後の空白と改行を取り除きます（取り除いた部分はゼロ埋めされます）
+func (b *Buffer) TrimSpace() {
+	data := b.Bytes()
+	start, end := 0, len(data)
+	for start < end && isSpace(data[start]) {
+		start++
+	}
+	for end > start && isSpace(data[end-1]) {
+		end--
+	}
+	if start == 0 && end == len(data) {
+		return
+	}
+	n := copy(data, data[start:end])
+	clear(data[n:])
+	b.n = n
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// Equal は2つのバッファの内容が等しいかを、内容によらない時間で比較します
+func (b *Buffer) Equal(other *Buffer) bool {
+	return subtle.ConstantTimeCompare(b.Bytes(), other.Bytes()) == 1 && b.Len() == other.Len()
+}
+
+// String は内容を含まない固定の文字列を返します
+// ログやエラーメッセージに誤って秘密を出力しないためのものです
+func (b *Buffer) String() string {
+	return "[secret]"
+}
+
+// Destroy はバッファをゼロ埋めし、メモリを解放します
+// 何度呼び出してもよく、呼び出した後のバッファは空のバッファとして再利用できます
+func (b *Buffer) Destroy() {
+	if b == nil || b.mem == nil {
+		return
+	}
+	freeMemory(b.mem, b.mapped, b.locked)
+	b.mem, b.n, b.mapped, b.locked = nil, 0, false, false
+	runtime.SetFinalizer(b, nil)
+}
+
+// 少なくとも n バイトを追加できるようにする
+func (b *Buffer) grow(n int) {
+	if b.n+n <= len(b.mem) {
+		return
+	}
+	old := *b
+	b.alloc(max(2*len(old.mem), old.n+n, minGrowSize))
+	b.n = copy(b.mem, old.mem[:old.n])
+	if old.mem != nil {
+		freeMemory(old.mem, old.mapped, old.locked)
+	}
+}
+
+func (b *Buffer) alloc(size int) {
+	first := b.mem == nil
+	b.mem, b.mapped, b.locked = allocMemory(size)
+	if first {
+		// Destroy されずに到達できなくなったバッファも、ゼロ埋めしてから解放する
+		runtime.SetFinalizer(b, (*Buffer).Destroy)
+	}
+}
+
+// Wipe は data をゼロ埋めします
+func Wipe(data []byte) {
+	clear(data)
+	// ゼロ埋めが最適化で取り除かれないよう、data を使用し続ける
+	runtime.KeepAlive(data)
+}
@@ -0,0 +1,87 @@
+package secret
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBuffer(t *testing.T) {
+	b := FromBytes([]byte("  password\n"))
+	if b.String() != "[secret]" {
+		t.Errorf("String() = %q, 内容を含まない文字列であるべきです", b.String())
+	}
+	b.TrimSpace()
+	if string(b.Bytes()) != "password" || b.Len() != len("password") {
+		t.Errorf("TrimSpace() 後の内容 = %q", b.Bytes())
+	}
+	if !b.Equal(FromString("password")) || b.Equal(FromString("passwor")) || b.Equal(FromString("passworD")) {
+		t.Error("Equal() の結果が期待と異なります")
+	}
+
+	// 容量を超えて書き込んでも内容が保たれること
+	for i := 0; i < 1000; i++ {
+		b.WriteByte('x')
+	}
+	if want := "password" + strings.Repeat("x", 1000); string(b.Bytes()) != want {
+		t.Errorf("書き込み後の長さ = %d, want %d", b.Len(), len(want))
+	}
+
+	// 取り除いた部分はゼロ埋めされること
+	padded := FromBytes([]byte("secret  "))
+	data := padded.Bytes()
+	padded.TrimSpace()
+	if string(data) != "secret\x00\x00" {
+		t.Errorf("TrimSpace() で取り除いた部分 = %q, want ゼロ埋め", data)
+	}
+	padded.Destroy()
+
+	// 通常のメモリに確保した場合も、Destroy でゼロ埋めされること
+	heap := []byte("secret")
+	unmapped := &Buffer{mem: heap, n: len(heap)}
+	unmapped.Destroy()
+	if !bytes.Equal(heap, make([]byte, len(heap))) {
+		t.Errorf("Destroy() 後のメモリ = %q, want ゼロ埋め", heap)
+	}
+
+	b.Destroy()
+	b.Destroy()
+	if b.Bytes() != nil || b.Len() != 0 {
+		t.Errorf("Destroy() 後の内容 = %q", b.Bytes())
+	}
+
+	// Destroy した後も空のバッファとして再利用できる
+	b.Write([]byte("again"))
+	if string(b.Bytes()) != "again" {
+		t.Errorf("再利用したバッファの内容 = %q", b.Bytes())
+	}
+	b.Destroy()
+
+	var nilBuffer *Buffer
+	if nilBuffer.Bytes() != nil || nilBuffer.Len() != 0 || nilBuffer.Locked() {
+		t.Error("nil のバッファが空として扱われません")
+	}
+	nilBuffer.Destroy()
+}
+
+func TestBufferReadFrom(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	var b Buffer
+	n, err := b.ReadFrom(bytes.NewReader(data))
+	if err != nil || n != int64(len(data)) || !bytes.Equal(b.Bytes(), data) {
+		t.Errorf("ReadFrom() = %d, %v", n, err)
+	}
+	b.Destroy()
+
+	sized := New(32)
+	if sized.Len() != 32 || !bytes.Equal(sized.Bytes(), make([]byte, 32)) {
+		t.Errorf("New(32) の内容 = %v", sized.Bytes())
+	}
+	sized.Destroy()
+}
+
+func TestDisableCoreDumps(t *testing.T) {
+	if err := DisableCoreDumps(); err != nil {
+		t.Errorf("DisableCoreDumps() error = %v", err)
+	}
+}
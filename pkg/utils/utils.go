@@ -1,29 +1,90 @@
 package utils
 
 import (
-	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
-	"strings"
 	"syscall"
 
+	"github.com/uzulla/envault/pkg/secret"
 	"golang.org/x/term"
 )
 
-func GetPasswordFromStdin() (string, error) {
-	reader := bufio.NewReader(os.Stdin)
-	password, err := reader.ReadString('\n')
+// 標準入力から1行読み込んでパスワードとして返します
+// 続けて呼び出すと次の行を読み込めるよう、改行より先は読み込みません
+// 使用後は呼び出し側で Destroy してください
+func GetPasswordFromStdin() (*secret.Buffer, error) {
+	password := &secret.Buffer{}
+	if err := readLineFromStdin(password); err != nil {
+		password.Destroy()
+		return nil, fmt.Errorf("パスワードの読み込みに失敗しました: %w", err)
+	}
+
+	password.TrimSpace()
+
+	return password, nil
+}
+
+// ReadLineFromStdin は標準入力から改行までの1行を読み込みます（改行は含みません）
+// パスワードなど後続の入力を読み込めるよう、改行より先は読み込みません
+// 入力の終わりに達した場合は、読み込んだ行がなければ io.EOF を返します
+func ReadLineFromStdin() (string, error) {
+	line := &secret.Buffer{}
+	defer line.Destroy()
+	if err := readLineFromStdin(line); err != nil {
+		return "", err
+	}
+	return string(line.Bytes()), nil
+}
+
+func readLineFromStdin(line *secret.Buffer) error {
+	var buf [1]byte
+	defer secret.Wipe(buf[:])
+	for {
+		n, err := os.Stdin.Read(buf[:])
+		if n > 0 {
+			if buf[0] == '\n' {
+				break
+			}
+			line.WriteByte(buf[0])
+		}
+		if err == io.EOF && line.Len() > 0 {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ファイルの1行目を読み込んでパスワードとして返します
+// /dev/fd/3 のようなファイルディスクリプタのパスも指定できます
+// 使用後は呼び出し側で Destroy してください
+func GetPasswordFromFile(path string) (*secret.Buffer, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return "", fmt.Errorf("パスワードの読み込みに失敗しました: %w", err)
+		return nil, fmt.Errorf("パスワードファイルの読み込みに失敗しました: %w", err)
 	}
-	
-	password = strings.TrimSpace(password)
-	
+	defer f.Close()
+
+	data := &secret.Buffer{}
+	defer data.Destroy()
+	if _, err := data.ReadFrom(f); err != nil {
+		return nil, fmt.Errorf("パスワードファイルの読み込みに失敗しました: %w", err)
+	}
+
+	line, _, _ := bytes.Cut(data.Bytes(), []byte("\n"))
+	password := secret.FromBytes(line)
+	password.TrimSpace()
+
 	return password, nil
 }
 
-func GetPasswordInteractive(prompt string) (string, error) {
+// 端末からエコーせずにパスワードを読み込みます
+// 使用後は呼び出し側で Destroy してください
+func GetPasswordInteractive(prompt string) (*secret.Buffer, error) {
 	if prompt == "" {
 		prompt = "パスワードを入力してください: "
 	}
@@ -31,18 +92,21 @@ func GetPasswordInteractive(prompt string) (string, error) {
 	fmt.Print(prompt)
 	
 	passwordBytes, err := term.ReadPassword(int(syscall.Stdin))
+	defer secret.Wipe(passwordBytes)
 	fmt.Println() // 改行を追加
 	
 	if err != nil {
-		return "", fmt.Errorf("パスワードの読み込みに失敗しました: %w", err)
+		return nil, fmt.Errorf("パスワードの読み込みに失敗しました: %w", err)
 	}
 	
-	password := strings.TrimSpace(string(passwordBytes))
+	password := secret.FromBytes(passwordBytes)
+	password.TrimSpace()
 	
 	return password, nil
 }
 
-func ExecuteScript(script string) error {
+// ExecuteScript はスクリプトを一時ファイルに書き出し、source するコマンドを出力します
+func ExecuteScript(script []byte) error {
 	tmpFile, err := os.CreateTemp("", "envault-*.sh")
 	if err != nil {
 		return fmt.Errorf("一時ファイルの作成に失敗しました: %w", err)
@@ -54,7 +118,7 @@ func ExecuteScript(script string) error {
 		}
 	}()
 	
-	if _, err := io.WriteString(tmpFile, script); err != nil {
+	if _, err := tmpFile.Write(script); err != nil {
 		return fmt.Errorf("スクリプトの書き込みに失敗しました: %w", err)
 	}
 	
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -25,16 +26,17 @@ func TestGetPasswordFromStdin(t *testing.T) {
 		t.Errorf("GetPasswordFromStdin() error = %v", err)
 	}
 
+	defer password.Destroy()
 	expectedPassword := strings.TrimSpace(testPassword)
-	if password != expectedPassword {
-		t.Errorf("GetPasswordFromStdin() = %v, want %v", password, expectedPassword)
+	if string(password.Bytes()) != expectedPassword {
+		t.Errorf("GetPasswordFromStdin() = %q, want %q", password.Bytes(), expectedPassword)
 	}
 }
 
 func TestExecuteScript(t *testing.T) {
 	testScript := "#!/bin/bash\necho 'Test script executed'"
 
-	err := ExecuteScript(testScript)
+	err := ExecuteScript([]byte(testScript))
 	if err != nil {
 		t.Errorf("ExecuteScript() error = %v", err)
 	}
@@ -44,3 +46,46 @@ func TestExecuteScript(t *testing.T) {
 func TestGetPasswordInteractive(t *testing.T) {
 	t.Skip("このテストは対話的な入力が必要なため、スキップします")
 }
+
+func TestGetPasswordFromStdinMultipleLines(t *testing.T) {
+	oldStdin := os.Stdin
+	r, w, _ := os.Pipe()
+	os.Stdin = r
+	defer func() {
+		os.Stdin = oldStdin
+	}()
+
+	go func() {
+		w.Write([]byte("first\nsecond"))
+		w.Close()
+	}()
+
+	for _, want := range []string{"first", "second"} {
+		password, err := GetPasswordFromStdin()
+		if err != nil {
+			t.Fatalf("GetPasswordFromStdin() error = %v", err)
+		}
+		if string(password.Bytes()) != want {
+			t.Errorf("GetPasswordFromStdin() = %q, want %q", password.Bytes(), want)
+		}
+	}
+}
+
+func TestGetPasswordFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password.txt")
+	if err := os.WriteFile(path, []byte("filepassword\nignored\n"), 0600); err != nil {
+		t.Fatalf("テストファイルの作成に失敗しました: %v", err)
+	}
+
+	password, err := GetPasswordFromFile(path)
+	if err != nil {
+		t.Errorf("GetPasswordFromFile() error = %v", err)
+	}
+	if string(password.Bytes()) != "filepassword" {
+		t.Errorf("GetPasswordFromFile() = %q, want %q", password.Bytes(), "filepassword")
+	}
+
+	if _, err := GetPasswordFromFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Errorf("存在しないファイルの読み込みが成功しました")
+	}
+}